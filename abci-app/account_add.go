@@ -29,7 +29,11 @@ import (
 	"github.com/eeonevision/anychaindb/transaction"
 )
 
-func checkAccountAddTransaction(tx *transaction.Transaction, s *state.State) error {
+// checkAccountAddTransaction function checks that new account passes admission
+// policy of the chain and is signed by its own key, which proves possession
+// of the registered public key. Legacy unsigned transactions are accepted
+// only if allowUnsigned is set.
+func checkAccountAddTransaction(tx *transaction.Transaction, s *state.State, allowUnsigned bool) error {
 	data := &state.Account{}
 	_, err := data.UnmarshalMsg(tx.Data)
 	if err != nil {
@@ -38,9 +42,36 @@ func checkAccountAddTransaction(tx *transaction.Transaction, s *state.State) err
 	if s.HasAccount(data.ID) {
 		return errors.New("account exists")
 	}
-	if _, err := crypto.NewFromStrings(data.PubKey, ""); err != nil {
+	k, err := crypto.NewFromTypedStrings(crypto.KeyType(data.KeyType), data.PubKey, "")
+	if err != nil {
 		return err
 	}
+	if data.EncPubKey != "" {
+		if data.EncPubKey == data.PubKey {
+			return errors.New("encryption key should differ from signing key")
+		}
+		if _, err := crypto.NewFromTypedStrings(crypto.KeyType(data.EncKeyType), data.EncPubKey, ""); err != nil {
+			return errors.New("invalid encryption key: " + err.Error())
+		}
+	}
+	if len(data.Roles) > 0 {
+		return errors.New("roles of account are granted only by admin")
+	}
+	if err := checkAccountAdmission(data, s); err != nil {
+		return err
+	}
+	if tx.Signature == "" {
+		if allowUnsigned {
+			return nil
+		}
+		return errors.New("tx is not signed by key of account")
+	}
+	if tx.Signer != data.ID {
+		return errors.New("tx signer does not match account id")
+	}
+	if err := tx.Verify(k, s.ChainID()); err != nil {
+		return errors.New("tx can't be verified by key of account: " + err.Error())
+	}
 	return nil
 }
 
@@ -50,5 +81,32 @@ func deliverAccountAddTransaction(tx *transaction.Transaction, s *state.State) e
 	if err != nil {
 		return err
 	}
+	return addAccount(data, s, blockHeight(s))
+}
+
+// addAccount function adds new account with keys, which are active since
+// given height.
+func addAccount(data *state.Account, s *state.State, height int64) error {
+	k, err := crypto.NewFromTypedStrings(crypto.KeyType(data.KeyType), data.PubKey, "")
+	if err != nil {
+		return err
+	}
+	// Account starts with the first nonce and its own key
+	data.Nonce = 0
+	data.KeyType = string(k.Type())
+	if data.EncPubKey != "" {
+		enc, err := crypto.NewFromTypedStrings(crypto.KeyType(data.EncKeyType), data.EncPubKey, "")
+		if err != nil {
+			return err
+		}
+		data.EncKeyType = string(enc.Type())
+	}
+	data.KeyHistory = []state.KeyRecord{{
+		PubKey:     data.PubKey,
+		KeyType:    data.KeyType,
+		EncPubKey:  data.EncPubKey,
+		EncKeyType: data.EncKeyType,
+		Height:     height,
+	}}
 	return s.AddAccount(data)
 }
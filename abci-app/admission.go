@@ -0,0 +1,80 @@
+/*
+ * Copyright (C) 2018 eeonevision
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy of
+ * this software and associated documentation files (the "Software"), to deal in
+ * the Software without restriction, including without limitation the rights to
+ * use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+ * the Software, and to permit persons to whom the Software is furnished to do so,
+ * subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+ * FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+ * COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+ * IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+ * CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ */
+
+package app
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/eeonevision/anychaindb/state"
+)
+
+// checkAccountAdmission function checks that new account passes admission
+// policy of the chain: it solves proof-of-work of chain difficulty, or it is
+// co-signed by whitelisted registrar. Accounts of permissioned network are
+// co-signed by account with registrar role.
+func checkAccountAdmission(acc *state.Account, s *state.State) error {
+	params := s.Params()
+	switch params.AccountAdmission {
+	case state.AdmissionPoW:
+		if bits := acc.WorkBits(s.ChainID()); bits < int(params.PoWDifficulty) {
+			return fmt.Errorf("proof-of-work has %d bits, %d bits required", bits, params.PoWDifficulty)
+		}
+	case state.AdmissionRegistrar:
+		if !params.IsRegistrar(acc.Registrar) {
+			return errors.New("account is not co-signed by registrar")
+		}
+		if _, err := checkRegistrarSignature(acc, s); err != nil {
+			return err
+		}
+	}
+	if params.Permissioned {
+		registrar, err := checkRegistrarSignature(acc, s)
+		if err != nil {
+			return err
+		}
+		if !registrar.HasRole(state.RoleRegistrar) {
+			return errors.New("account is not co-signed by account with registrar role")
+		}
+	}
+	return nil
+}
+
+// checkRegistrarSignature function verifies co-signature of new account by
+// its registrar and returns account of registrar.
+func checkRegistrarSignature(acc *state.Account, s *state.State) (*state.Account, error) {
+	if acc.Registrar == "" {
+		return nil, errors.New("account is not co-signed by registrar")
+	}
+	registrar, err := s.GetAccount(acc.Registrar)
+	if err != nil {
+		return nil, errors.New("registrar account can't be loaded: " + err.Error())
+	}
+	key, err := s.GetAccountPubKey(acc.Registrar)
+	if err != nil {
+		return nil, errors.New("registrar account can't be loaded: " + err.Error())
+	}
+	if err := key.Verify(acc.AdmissionHash(s.ChainID()), acc.RegistrarSignature); err != nil {
+		return nil, errors.New("registrar signature can't be verified: " + err.Error())
+	}
+	return registrar, nil
+}
@@ -22,14 +22,15 @@
 package app
 
 import (
+	"encoding/base64"
 	"encoding/json"
+	"fmt"
+	"time"
 
 	"github.com/tendermint/tendermint/libs/log"
 
 	"github.com/eeonevision/anychaindb/state"
 	"github.com/eeonevision/anychaindb/transaction"
-	"github.com/globalsign/mgo"
-	"github.com/globalsign/mgo/bson"
 	"github.com/tendermint/tendermint/abci/types"
 )
 
@@ -39,20 +40,45 @@ const (
 	resOffset = 0
 )
 
-// Application inherits BaseApplication and keeps state of anychaindb
+// Application inherits BaseApplication and keeps state of anychaindb.
+// Transactions of mempool are checked against checkState, which keeps
+// effects of accepted but not yet committed transactions over the
+// committed state and is reset on every commit.
 type Application struct {
 	types.BaseApplication
-	state  *state.State
-	logger log.Logger
+	state        *state.State
+	checkState   *state.State
+	blockHeight  int64
+	blockTime    time.Time
+	txTimeWindow time.Duration
+	// Unsigned AccountAdd transactions are accepted below this height
+	unsignedAccountsHeight int64
+	logger                 log.Logger
 }
 
-// NewApplication method initializes new application with MongoDB state
-func NewApplication(dbHost, dbName string) *Application {
-	db, err := mgo.Dial(dbHost)
+// NewApplication method initializes new application with state
+// kept in chosen storage backend: mongodb, leveldb or memory.
+func NewApplication(dbBackend, dbHost, dbName string) *Application {
+	s := newState(dbBackend, dbHost, dbName)
+	return &Application{
+		state:        s,
+		checkState:   s.NewCheckState(),
+		txTimeWindow: DefaultTxTimeWindow,
+		logger:       log.NewNopLogger(),
+	}
+}
+
+// newState method opens storage and loads state from it.
+func newState(dbBackend, dbHost, dbName string) *state.State {
+	store, err := state.NewStore(dbBackend, dbHost, dbName)
+	if err != nil {
+		panic("Error initialize " + dbBackend + " storage: " + err.Error())
+	}
+	s, err := state.NewState(store)
 	if err != nil {
-		panic("Error initialize Mongo DB: " + err.Error())
+		panic("Error loading state: " + err.Error())
 	}
-	return &Application{state: state.NewStateFromDB(db.DB(dbName))}
+	return s
 }
 
 // SetLogger method set logger for Application
@@ -60,11 +86,65 @@ func (app *Application) SetLogger(l log.Logger) {
 	app.logger = l
 }
 
+// SetTxTimeWindow method sets allowed difference between timestamp
+// of transaction and time of block. Zero window disables the check.
+func (app *Application) SetTxTimeWindow(window time.Duration) {
+	app.txTimeWindow = window
+}
+
+// SetUnsignedAccountsHeight method sets height, below which legacy AccountAdd
+// transactions without proof-of-possession signature are accepted.
+func (app *Application) SetUnsignedAccountsHeight(height int64) {
+	app.unsignedAccountsHeight = height
+}
+
+// InitChain method keeps id of the chain, which is included into
+// hashes of signed transactions, and loads application state of genesis.
+// Validators of app_state override validators of genesis. Invalid genesis
+// stops the node.
+func (app *Application) InitChain(req types.RequestInitChain) types.ResponseInitChain {
+	app.state.SetChainID(req.ChainId)
+	app.checkState.SetChainID(req.ChainId)
+	validators, err := app.loadGenesisState(req.AppStateBytes, req.Validators)
+	if err != nil {
+		panic("Error loading genesis app_state: " + err.Error())
+	}
+	return types.ResponseInitChain{Validators: validators}
+}
+
+// BeginBlock method keeps time of the block for checking timestamps of
+// its transactions. Chain id is taken from the header, if state was
+// written before chain id was kept in it.
+func (app *Application) BeginBlock(req types.RequestBeginBlock) types.ResponseBeginBlock {
+	app.blockHeight = req.Header.Height
+	app.blockTime = time.Unix(req.Header.Time, 0)
+	if app.state.ChainID() == "" {
+		app.state.SetChainID(req.Header.ChainID)
+		app.checkState.SetChainID(req.Header.ChainID)
+	}
+	return types.ResponseBeginBlock{}
+}
+
+// checkReplay method rejects transaction, which was signed for other time
+// or breaks the order of transactions of its signer. It returns response code
+// together with error.
+func (app *Application) checkReplay(tx *transaction.Transaction, s *state.State, now time.Time) (uint32, error) {
+	if err := checkTxTimestamp(tx, now, app.txTimeWindow); err != nil {
+		return CodeTypeBadTimestamp, err
+	}
+	if isSigned(tx) {
+		if err := checkTxNonce(tx, s); err != nil {
+			return CodeTypeBadNonce, err
+		}
+	}
+	return CodeTypeOK, nil
+}
+
 // Info method returns information about current state.
 // All sizes represented in kilobytes.
 func (app *Application) Info() (resInfo types.ResponseInfo) {
-	var stats map[string]interface{}
-	if err := app.state.DB.Run(bson.M{"dbStats": 1}, &stats); err != nil {
+	stats, err := app.state.Stats()
+	if err != nil {
 		app.logger.Error("Getting state info error", "error", err.Error())
 		return
 	}
@@ -77,6 +157,8 @@ func (app *Application) Info() (resInfo types.ResponseInfo) {
 }
 
 // DeliverTx method responsible for deliver chosen transaction type.
+// Transaction is checked again, because block may contain transactions
+// which were not checked by mempool of this node.
 func (app *Application) DeliverTx(txBytes []byte) types.ResponseDeliverTx {
 	tx := &transaction.Transaction{}
 	if err := tx.FromBytes(txBytes); err != nil {
@@ -85,9 +167,22 @@ func (app *Application) DeliverTx(txBytes []byte) types.ResponseDeliverTx {
 			Log:  err.Error(),
 		}
 	}
+	if code, err := app.checkReplay(tx, app.state, app.blockTime); err != nil {
+		return types.ResponseDeliverTx{
+			Code: code,
+			Log:  err.Error(),
+		}
+	}
 	switch tx.Type {
 	case transaction.AccountAdd:
 		{
+			allowUnsigned := app.blockHeight < app.unsignedAccountsHeight
+			if err := checkAccountAddTransaction(tx, app.state, allowUnsigned); err != nil {
+				return types.ResponseDeliverTx{
+					Code: CodeTypeDeliverTxError,
+					Log:  err.Error(),
+				}
+			}
 			if err := deliverAccountAddTransaction(tx, app.state); err != nil {
 				return types.ResponseDeliverTx{
 					Code: CodeTypeDeliverTxError,
@@ -97,6 +192,12 @@ func (app *Application) DeliverTx(txBytes []byte) types.ResponseDeliverTx {
 		}
 	case transaction.PayloadAdd:
 		{
+			if err := checkPayloadAddTransaction(tx, app.state); err != nil {
+				return types.ResponseDeliverTx{
+					Code: CodeTypeDeliverTxError,
+					Log:  err.Error(),
+				}
+			}
 			if err := deliverPayloadAddTransaction(tx, app.state); err != nil {
 				return types.ResponseDeliverTx{
 					Code: CodeTypeDeliverTxError,
@@ -104,6 +205,96 @@ func (app *Application) DeliverTx(txBytes []byte) types.ResponseDeliverTx {
 				}
 			}
 		}
+	case transaction.PayloadUpdate:
+		{
+			if err := checkPayloadUpdateTransaction(tx, app.state); err != nil {
+				return types.ResponseDeliverTx{
+					Code: CodeTypeDeliverTxError,
+					Log:  err.Error(),
+				}
+			}
+			if err := deliverPayloadUpdateTransaction(tx, app.state); err != nil {
+				return types.ResponseDeliverTx{
+					Code: CodeTypeDeliverTxError,
+					Log:  err.Error(),
+				}
+			}
+		}
+	case transaction.PayloadRevoke:
+		{
+			if err := checkPayloadRevokeTransaction(tx, app.state); err != nil {
+				return types.ResponseDeliverTx{
+					Code: CodeTypeDeliverTxError,
+					Log:  err.Error(),
+				}
+			}
+			if err := deliverPayloadRevokeTransaction(tx, app.state); err != nil {
+				return types.ResponseDeliverTx{
+					Code: CodeTypeDeliverTxError,
+					Log:  err.Error(),
+				}
+			}
+		}
+	case transaction.PrivateDataGrant:
+		{
+			if err := checkPrivateDataGrantTransaction(tx, app.state); err != nil {
+				return types.ResponseDeliverTx{
+					Code: CodeTypeDeliverTxError,
+					Log:  err.Error(),
+				}
+			}
+			if err := deliverPrivateDataGrantTransaction(tx, app.state); err != nil {
+				return types.ResponseDeliverTx{
+					Code: CodeTypeDeliverTxError,
+					Log:  err.Error(),
+				}
+			}
+		}
+	case transaction.KeyRotate:
+		{
+			if err := checkKeyRotateTransaction(tx, app.state); err != nil {
+				return types.ResponseDeliverTx{
+					Code: CodeTypeDeliverTxError,
+					Log:  err.Error(),
+				}
+			}
+			if err := deliverKeyRotateTransaction(tx, app.state); err != nil {
+				return types.ResponseDeliverTx{
+					Code: CodeTypeDeliverTxError,
+					Log:  err.Error(),
+				}
+			}
+		}
+	case transaction.RoleGrant, transaction.RoleRevoke:
+		{
+			if err := checkRoleChangeTransaction(tx, app.state); err != nil {
+				return types.ResponseDeliverTx{
+					Code: CodeTypeDeliverTxError,
+					Log:  err.Error(),
+				}
+			}
+			if err := deliverRoleChangeTransaction(tx, app.state); err != nil {
+				return types.ResponseDeliverTx{
+					Code: CodeTypeDeliverTxError,
+					Log:  err.Error(),
+				}
+			}
+		}
+	case transaction.ValidatorUpdate:
+		{
+			if err := checkValidatorUpdateTransaction(tx, app.state); err != nil {
+				return types.ResponseDeliverTx{
+					Code: CodeTypeDeliverTxError,
+					Log:  err.Error(),
+				}
+			}
+			if err := deliverValidatorUpdateTransaction(tx, app.state); err != nil {
+				return types.ResponseDeliverTx{
+					Code: CodeTypeDeliverTxError,
+					Log:  err.Error(),
+				}
+			}
+		}
 	default:
 		{
 			return types.ResponseDeliverTx{
@@ -118,6 +309,8 @@ func (app *Application) DeliverTx(txBytes []byte) types.ResponseDeliverTx {
 }
 
 // CheckTx method responsible for check transaction on validity.
+// Effects of valid transaction are applied to the check state, so
+// duplicated and conflicting transactions are rejected in mempool.
 func (app *Application) CheckTx(txBytes []byte) types.ResponseCheckTx {
 	tx := &transaction.Transaction{}
 	if err := tx.FromBytes(txBytes); err != nil {
@@ -126,10 +319,23 @@ func (app *Application) CheckTx(txBytes []byte) types.ResponseCheckTx {
 			Log:  err.Error(),
 		}
 	}
+	if code, err := app.checkReplay(tx, app.checkState, time.Now()); err != nil {
+		return types.ResponseCheckTx{
+			Code: code,
+			Log:  err.Error(),
+		}
+	}
 	switch tx.Type {
 	case transaction.AccountAdd:
 		{
-			if err := checkAccountAddTransaction(tx, app.state); err != nil {
+			allowUnsigned := app.checkState.LastBlock().Height+1 < app.unsignedAccountsHeight
+			if err := checkAccountAddTransaction(tx, app.checkState, allowUnsigned); err != nil {
+				return types.ResponseCheckTx{
+					Code: CodeTypeCheckTxError,
+					Log:  err.Error(),
+				}
+			}
+			if err := deliverAccountAddTransaction(tx, app.checkState); err != nil {
 				return types.ResponseCheckTx{
 					Code: CodeTypeCheckTxError,
 					Log:  err.Error(),
@@ -138,7 +344,103 @@ func (app *Application) CheckTx(txBytes []byte) types.ResponseCheckTx {
 		}
 	case transaction.PayloadAdd:
 		{
-			if err := checkPayloadAddTransaction(tx, app.state); err != nil {
+			if err := checkPayloadAddTransaction(tx, app.checkState); err != nil {
+				return types.ResponseCheckTx{
+					Code: CodeTypeCheckTxError,
+					Log:  err.Error(),
+				}
+			}
+			if err := deliverPayloadAddTransaction(tx, app.checkState); err != nil {
+				return types.ResponseCheckTx{
+					Code: CodeTypeCheckTxError,
+					Log:  err.Error(),
+				}
+			}
+		}
+	case transaction.PayloadUpdate:
+		{
+			if err := checkPayloadUpdateTransaction(tx, app.checkState); err != nil {
+				return types.ResponseCheckTx{
+					Code: CodeTypeCheckTxError,
+					Log:  err.Error(),
+				}
+			}
+			if err := deliverPayloadUpdateTransaction(tx, app.checkState); err != nil {
+				return types.ResponseCheckTx{
+					Code: CodeTypeCheckTxError,
+					Log:  err.Error(),
+				}
+			}
+		}
+	case transaction.PayloadRevoke:
+		{
+			if err := checkPayloadRevokeTransaction(tx, app.checkState); err != nil {
+				return types.ResponseCheckTx{
+					Code: CodeTypeCheckTxError,
+					Log:  err.Error(),
+				}
+			}
+			if err := deliverPayloadRevokeTransaction(tx, app.checkState); err != nil {
+				return types.ResponseCheckTx{
+					Code: CodeTypeCheckTxError,
+					Log:  err.Error(),
+				}
+			}
+		}
+	case transaction.PrivateDataGrant:
+		{
+			if err := checkPrivateDataGrantTransaction(tx, app.checkState); err != nil {
+				return types.ResponseCheckTx{
+					Code: CodeTypeCheckTxError,
+					Log:  err.Error(),
+				}
+			}
+			if err := deliverPrivateDataGrantTransaction(tx, app.checkState); err != nil {
+				return types.ResponseCheckTx{
+					Code: CodeTypeCheckTxError,
+					Log:  err.Error(),
+				}
+			}
+		}
+	case transaction.KeyRotate:
+		{
+			if err := checkKeyRotateTransaction(tx, app.checkState); err != nil {
+				return types.ResponseCheckTx{
+					Code: CodeTypeCheckTxError,
+					Log:  err.Error(),
+				}
+			}
+			if err := deliverKeyRotateTransaction(tx, app.checkState); err != nil {
+				return types.ResponseCheckTx{
+					Code: CodeTypeCheckTxError,
+					Log:  err.Error(),
+				}
+			}
+		}
+	case transaction.RoleGrant, transaction.RoleRevoke:
+		{
+			if err := checkRoleChangeTransaction(tx, app.checkState); err != nil {
+				return types.ResponseCheckTx{
+					Code: CodeTypeCheckTxError,
+					Log:  err.Error(),
+				}
+			}
+			if err := deliverRoleChangeTransaction(tx, app.checkState); err != nil {
+				return types.ResponseCheckTx{
+					Code: CodeTypeCheckTxError,
+					Log:  err.Error(),
+				}
+			}
+		}
+	case transaction.ValidatorUpdate:
+		{
+			if err := checkValidatorUpdateTransaction(tx, app.checkState); err != nil {
+				return types.ResponseCheckTx{
+					Code: CodeTypeCheckTxError,
+					Log:  err.Error(),
+				}
+			}
+			if err := deliverValidatorUpdateTransaction(tx, app.checkState); err != nil {
 				return types.ResponseCheckTx{
 					Code: CodeTypeCheckTxError,
 					Log:  err.Error(),
@@ -158,24 +460,82 @@ func (app *Application) CheckTx(txBytes []byte) types.ResponseCheckTx {
 	}
 }
 
-// Commit method generates hash of current state.
-func (app *Application) Commit() types.ResponseCommit {
-	var hash map[string]interface{}
-	for {
-		if err := app.state.DB.Run(bson.M{
-			"dbhash":      1,
-			"collections": []string{"accounts", "transitions", "conversions"},
-		}, &hash); err == nil {
-			return types.ResponseCommit{Data: []byte(hash["md5"].(string))}
+// EndBlock method returns updates of validators, which were applied by the block.
+func (app *Application) EndBlock(req types.RequestEndBlock) types.ResponseEndBlock {
+	var updates []types.Validator
+	for _, u := range app.state.ValidatorUpdates() {
+		// Updates are validated by CheckTx and DeliverTx, so invalid one
+		// means that state of the node is corrupted
+		if err := u.Validate(); err != nil {
+			panic(fmt.Sprintf("Error updating validator %s at block %d: %s", u.PubKey, req.Height, err.Error()))
 		}
+		pub, _ := base64.StdEncoding.DecodeString(u.PubKey)
+		updates = append(updates, types.Ed25519Validator(pub, u.Power))
+	}
+	return types.ResponseEndBlock{ValidatorUpdates: updates}
+}
+
+// Commit method writes changes of the block to the state and
+// returns root hash of Merkle tree of the state.
+// The tree is updated by every delivered transaction, so the hash
+// commits to all accounts and payloads applied up to this block.
+func (app *Application) Commit() types.ResponseCommit {
+	return app.commit(app.state.LastBlock().Height + 1)
+}
+
+// commit method writes the block with given height to the state.
+// The node can't continue if the block was not written, because
+// its state would diverge from the rest of network.
+func (app *Application) commit(height int64) types.ResponseCommit {
+	appHash, err := app.state.Commit(height)
+	if err != nil {
+		panic(fmt.Sprintf("Error committing block %d: %s", height, err.Error()))
 	}
+	// Mempool is rechecked against the new committed state
+	app.checkState = app.state.NewCheckState()
+	return types.ResponseCommit{Data: appHash}
 }
 
 // mongoQuery is a struct for parse search query from a user.
 type mongoQuery struct {
-	Query  interface{} `json:"query,omitempty"`
-	Limit  int         `json:"limit,omitempty"`
-	Offset int         `json:"offset,omitempty"`
+	Query          interface{} `json:"query,omitempty"`
+	Limit          int         `json:"limit,omitempty"`
+	Offset         int         `json:"offset,omitempty"`
+	IncludeRevoked bool        `json:"include_revoked,omitempty"`
+}
+
+// revisionQuery is a struct for parse request of payload revision.
+type revisionQuery struct {
+	ID       string `json:"_id"`
+	Revision uint32 `json:"revision"`
+}
+
+// proveQuery method returns committed object found by key together with Merkle
+// proof of its inclusion in the app hash of last committed block.
+// Absent object is reported as not found error with proof of its absence.
+func (app *Application) proveQuery(reqQuery types.RequestQuery, key string, obj interface{}, found bool, proof *state.Proof, err error) (resQuery types.ResponseQuery) {
+	lastBlock := app.state.LastBlock()
+	if reqQuery.Height != 0 && reqQuery.Height != lastBlock.Height {
+		resQuery.Code = CodeTypeQueryError
+		resQuery.Log = fmt.Sprintf("proofs are available only for last committed height %d", lastBlock.Height)
+		return
+	}
+	if err != nil {
+		resQuery.Code = CodeTypeQueryError
+		resQuery.Log = err.Error()
+		return
+	}
+	resQuery.Key = []byte(key)
+	resQuery.Height = lastBlock.Height
+	resQuery.Proof, _ = json.Marshal(proof)
+	if !found {
+		resQuery.Code = CodeTypeQueryError
+		resQuery.Log = state.ErrNotFound.Error()
+		return
+	}
+	resQuery.Value, _ = state.CanonicalJSON(obj)
+	resQuery.Code = CodeTypeOK
+	return
 }
 
 // Query method processes user's request.
@@ -184,6 +544,8 @@ type mongoQuery struct {
 // The limit and offset fields are optional. All mongo query places in query field of struct.
 // Check mongo query syntax at:
 // https://docs.mongodb.com/manual/tutorial/query-documents/
+// Requests of accounts and payloads by id with prove flag return committed
+// objects with Merkle proofs against the app hash of last committed block.
 func (app *Application) Query(reqQuery types.RequestQuery) (resQuery types.ResponseQuery) {
 	var (
 		result interface{}
@@ -197,6 +559,11 @@ func (app *Application) Query(reqQuery types.RequestQuery) (resQuery types.Respo
 				resQuery.Log = "id is not presented in query"
 				return
 			}
+			if reqQuery.Prove {
+				id := string(reqQuery.Data)
+				obj, proof, err := app.state.ProveAccount(id)
+				return app.proveQuery(reqQuery, state.AccountKey(id), obj, obj != nil, proof, err)
+			}
 			result, err = app.state.GetAccount(string(reqQuery.Data))
 			if err != nil {
 				resQuery.Code = CodeTypeQueryError
@@ -237,6 +604,33 @@ func (app *Application) Query(reqQuery types.RequestQuery) (resQuery types.Respo
 			bs, _ := json.Marshal(result)
 			resQuery.Value = bs
 		}
+	case "accounts/nonce":
+		{
+			if reqQuery.Data == nil {
+				resQuery.Code = CodeTypeQueryError
+				resQuery.Log = "id is not presented in query"
+				return
+			}
+			// Nonce includes transactions accepted by mempool
+			nonce, err := app.checkState.GetAccountNonce(string(reqQuery.Data))
+			if err != nil {
+				resQuery.Code = CodeTypeQueryError
+				resQuery.Log = err.Error()
+				return
+			}
+			bs, _ := json.Marshal(nonce)
+			resQuery.Value = bs
+		}
+	case "params":
+		{
+			bs, _ := json.Marshal(app.state.Params())
+			resQuery.Value = bs
+		}
+	case "validators":
+		{
+			bs, _ := json.Marshal(app.state.Validators())
+			resQuery.Value = bs
+		}
 	case "payloads":
 		{
 			if reqQuery.Data == nil {
@@ -244,6 +638,11 @@ func (app *Application) Query(reqQuery types.RequestQuery) (resQuery types.Respo
 				resQuery.Log = "id is not presented in query"
 				return
 			}
+			if reqQuery.Prove {
+				id := string(reqQuery.Data)
+				obj, proof, err := app.state.ProvePayload(id)
+				return app.proveQuery(reqQuery, state.PayloadKey(id), obj, obj != nil, proof, err)
+			}
 			result, err = app.state.GetPayload(string(reqQuery.Data))
 			if err != nil {
 				resQuery.Code = CodeTypeQueryError
@@ -253,6 +652,39 @@ func (app *Application) Query(reqQuery types.RequestQuery) (resQuery types.Respo
 			bs, _ := json.Marshal(result)
 			resQuery.Value = bs
 		}
+	case "payloads/revision":
+		{
+			var revQuery revisionQuery
+			if err = json.Unmarshal(reqQuery.Data, &revQuery); err != nil || revQuery.ID == "" {
+				resQuery.Code = CodeTypeQueryError
+				resQuery.Log = "id and revision are not presented in query"
+				return
+			}
+			result, err = app.state.GetPayloadRevision(revQuery.ID, revQuery.Revision)
+			if err != nil {
+				resQuery.Code = CodeTypeQueryError
+				resQuery.Log = err.Error()
+				return
+			}
+			bs, _ := json.Marshal(result)
+			resQuery.Value = bs
+		}
+	case "payloads/revisions":
+		{
+			if reqQuery.Data == nil {
+				resQuery.Code = CodeTypeQueryError
+				resQuery.Log = "id is not presented in query"
+				return
+			}
+			result, err = app.state.ListPayloadRevisions(string(reqQuery.Data))
+			if err != nil {
+				resQuery.Code = CodeTypeQueryError
+				resQuery.Log = err.Error()
+				return
+			}
+			bs, _ := json.Marshal(result)
+			resQuery.Value = bs
+		}
 	case "payloads/search":
 		{
 			if reqQuery.Data == nil {
@@ -275,7 +707,7 @@ func (app *Application) Query(reqQuery types.RequestQuery) (resQuery types.Respo
 				mgoQuery.Offset = resOffset
 			}
 			// Search transaction data in Database
-			result, err = app.state.SearchPayloads(mgoQuery.Query, mgoQuery.Limit, mgoQuery.Offset)
+			result, err = app.state.SearchPayloads(mgoQuery.Query, mgoQuery.Limit, mgoQuery.Offset, mgoQuery.IncludeRevoked)
 			if err != nil {
 				resQuery.Code = CodeParseSearchQueryError
 				resQuery.Log = err.Error()
@@ -33,4 +33,5 @@ const (
 	CodeTypeQueryError        uint32 = 7
 	CodeEmptySearchQuery      uint32 = 8
 	CodeParseSearchQueryError uint32 = 9
+	CodeTypeBadTimestamp      uint32 = 10
 )
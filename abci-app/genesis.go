@@ -0,0 +1,192 @@
+/*
+ * Copyright (C) 2018 eeonevision
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy of
+ * this software and associated documentation files (the "Software"), to deal in
+ * the Software without restriction, including without limitation the rights to
+ * use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+ * the Software, and to permit persons to whom the Software is furnished to do so,
+ * subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+ * FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+ * COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+ * IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+ * CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ */
+
+package app
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strconv"
+
+	"github.com/eeonevision/anychaindb/crypto"
+	"github.com/eeonevision/anychaindb/state"
+	"github.com/tendermint/tendermint/abci/types"
+)
+
+// GenesisState struct keeps application state of genesis (app_state),
+// which is loaded into state of the chain on its initialization.
+// Schema of app_state is described in docs/genesis.md.
+//   - Params are parameters of the chain, e.g. account admission policy;
+//   - Accounts are admitted without admission checks, e.g. registrars. Their roles
+//     bootstrap admins of permissioned network;
+//   - Payloads are initial payloads of genesis accounts;
+//   - Validators override validators of genesis, if they are given.
+type GenesisState struct {
+	Params     state.Params       `json:"params"`
+	Accounts   []*state.Account   `json:"accounts,omitempty"`
+	Payloads   []*state.Payload   `json:"payloads,omitempty"`
+	Validators []GenesisValidator `json:"validators,omitempty"`
+}
+
+// GenesisValidator struct keeps validator of genesis.
+//   - PubKey is base64 encoded Ed25519 public key of validator;
+//   - Power is voting power of validator;
+//   - AccountID is optional genesis account of validator's operator.
+type GenesisValidator struct {
+	PubKey    string `json:"pub_key"`
+	Power     int64  `json:"power"`
+	AccountID string `json:"account_id,omitempty"`
+}
+
+// Validate method checks that genesis state is consistent: accounts and
+// payloads are unique, their keys are valid and they refer to genesis accounts.
+func (g *GenesisState) Validate() error {
+	if err := g.Params.Validate(); err != nil {
+		return err
+	}
+	accounts := make(map[string]*state.Account)
+	hasAdmin := false
+	for _, acc := range g.Accounts {
+		if acc.ID == "" {
+			return errors.New("genesis account has no id")
+		}
+		if accounts[acc.ID] != nil {
+			return errors.New("genesis account " + acc.ID + " is duplicated")
+		}
+		accounts[acc.ID] = acc
+		if _, err := crypto.NewFromTypedStrings(crypto.KeyType(acc.KeyType), acc.PubKey, ""); err != nil {
+			return errors.New("invalid key of genesis account " + acc.ID + ": " + err.Error())
+		}
+		if acc.EncPubKey != "" {
+			if _, err := crypto.NewFromTypedStrings(crypto.KeyType(acc.EncKeyType), acc.EncPubKey, ""); err != nil {
+				return errors.New("invalid encryption key of genesis account " + acc.ID + ": " + err.Error())
+			}
+		}
+		for _, role := range acc.Roles {
+			if !state.IsRole(role) {
+				return errors.New("unknown role " + role + " of genesis account " + acc.ID)
+			}
+		}
+		hasAdmin = hasAdmin || acc.HasRole(state.RoleAdmin)
+	}
+	if g.Params.Permissioned && !hasAdmin {
+		return errors.New("permissioned network requires admin account in genesis")
+	}
+	payloads := make(map[string]bool)
+	for _, p := range g.Payloads {
+		if p.ID == "" {
+			return errors.New("genesis payload has no id")
+		}
+		if payloads[p.ID] {
+			return errors.New("genesis payload " + p.ID + " is duplicated")
+		}
+		payloads[p.ID] = true
+		if accounts[p.SenderAccountID] == nil {
+			return errors.New("sender of genesis payload " + p.ID + " is not genesis account")
+		}
+		for _, data := range p.PrivateData {
+			if accounts[data.ReceiverAccountID] == nil {
+				return errors.New("receiver of genesis payload " + p.ID + " is not genesis account")
+			}
+			if data.Envelope != "" && p.GetEnvelope(data.Envelope) == nil {
+				return errors.New("envelope " + data.Envelope + " of genesis payload " + p.ID + " is not found")
+			}
+		}
+	}
+	validators := make(map[string]bool)
+	for i, v := range g.Validators {
+		pub, err := base64.StdEncoding.DecodeString(v.PubKey)
+		if err != nil || len(pub) != 32 {
+			return errors.New("invalid public key of genesis validator " + strconv.Itoa(i))
+		}
+		if validators[v.PubKey] {
+			return errors.New("genesis validator " + strconv.Itoa(i) + " is duplicated")
+		}
+		validators[v.PubKey] = true
+		if v.Power <= 0 {
+			return errors.New("power of genesis validator " + strconv.Itoa(i) + " should be positive")
+		}
+		if v.AccountID != "" && accounts[v.AccountID] == nil {
+			return errors.New("account of genesis validator " + strconv.Itoa(i) + " is not genesis account")
+		}
+	}
+	return nil
+}
+
+// loadGenesisState method parses and validates application state of genesis,
+// loads it into state together with validators of genesis and returns
+// validators, which override validators of genesis.
+func (app *Application) loadGenesisState(appState []byte, genesisValidators []types.Validator) ([]types.Validator, error) {
+	var genesis GenesisState
+	if len(appState) > 0 {
+		if err := json.Unmarshal(appState, &genesis); err != nil {
+			return nil, err
+		}
+	}
+	if err := genesis.Validate(); err != nil {
+		return nil, err
+	}
+	validators := make([]state.Validator, 0, len(genesisValidators))
+	for _, v := range genesisValidators {
+		validators = append(validators, state.Validator{PubKey: base64.StdEncoding.EncodeToString(v.PubKey.Data), Power: v.Power})
+	}
+	var override []types.Validator
+	if len(genesis.Validators) > 0 {
+		validators = validators[:0]
+		for _, v := range genesis.Validators {
+			pub, err := base64.StdEncoding.DecodeString(v.PubKey)
+			if err != nil {
+				return nil, err
+			}
+			override = append(override, types.Ed25519Validator(pub, v.Power))
+			validators = append(validators, state.Validator{PubKey: v.PubKey, Power: v.Power, AccountID: v.AccountID})
+		}
+	}
+	// Check state sees genesis before the first block is committed. Every state
+	// decodes own objects of genesis, so changes of check state are never
+	// applied to objects of deliver state.
+	for _, s := range []*state.State{app.state, app.checkState} {
+		var objects GenesisState
+		if len(appState) > 0 {
+			if err := json.Unmarshal(appState, &objects); err != nil {
+				return nil, err
+			}
+		}
+		if err := s.SetParams(objects.Params); err != nil {
+			return nil, err
+		}
+		if err := s.SetValidators(append([]state.Validator{}, validators...)); err != nil {
+			return nil, err
+		}
+		for _, acc := range objects.Accounts {
+			if err := addAccount(acc, s, 0); err != nil {
+				return nil, errors.New("invalid genesis account " + acc.ID + ": " + err.Error())
+			}
+		}
+		for _, p := range objects.Payloads {
+			if err := s.AddPayload(p); err != nil {
+				return nil, errors.New("invalid genesis payload " + p.ID + ": " + err.Error())
+			}
+		}
+	}
+	return override, nil
+}
@@ -0,0 +1,89 @@
+/*
+ * Copyright (C) 2018 eeonevision
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy of
+ * this software and associated documentation files (the "Software"), to deal in
+ * the Software without restriction, including without limitation the rights to
+ * use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+ * the Software, and to permit persons to whom the Software is furnished to do so,
+ * subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+ * FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+ * COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+ * IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+ * CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ */
+
+package app
+
+import (
+	"errors"
+
+	"github.com/eeonevision/anychaindb/crypto"
+	"github.com/eeonevision/anychaindb/state"
+	"github.com/eeonevision/anychaindb/transaction"
+)
+
+func checkKeyRotateTransaction(tx *transaction.Transaction, s *state.State) error {
+	data := &state.KeyRotation{}
+	_, err := data.UnmarshalMsg(tx.Data)
+	if err != nil {
+		return err
+	}
+	if tx.Signer != data.AccountID {
+		return errors.New("key can be rotated only by account itself")
+	}
+	acc, err := s.GetAccount(data.AccountID)
+	if err != nil {
+		return errors.New("account can't be loaded: " + err.Error())
+	}
+	if data.PubKey == acc.PubKey {
+		return errors.New("new key is the same as current key")
+	}
+	if _, err := crypto.NewFromTypedStrings(crypto.KeyType(data.KeyType), data.PubKey, ""); err != nil {
+		return errors.New("invalid new key: " + err.Error())
+	}
+	if data.EncPubKey != "" {
+		if data.EncPubKey == acc.EncPubKey {
+			return errors.New("new encryption key is the same as current key")
+		}
+		if _, err := crypto.NewFromTypedStrings(crypto.KeyType(data.EncKeyType), data.EncPubKey, ""); err != nil {
+			return errors.New("invalid new encryption key: " + err.Error())
+		}
+	}
+	// Rotation is signed by the current key
+	k, err := s.GetAccountPubKey(acc.ID)
+	if err != nil {
+		return err
+	}
+	if err := tx.Verify(k, s.ChainID()); err != nil {
+		return errors.New("tx can't be verified: " + err.Error())
+	}
+	return nil
+}
+
+func deliverKeyRotateTransaction(tx *transaction.Transaction, s *state.State) error {
+	data := &state.KeyRotation{}
+	_, err := data.UnmarshalMsg(tx.Data)
+	if err != nil {
+		return err
+	}
+	k, err := crypto.NewFromTypedStrings(crypto.KeyType(data.KeyType), data.PubKey, "")
+	if err != nil {
+		return err
+	}
+	data.KeyType = string(k.Type())
+	if data.EncPubKey != "" {
+		enc, err := crypto.NewFromTypedStrings(crypto.KeyType(data.EncKeyType), data.EncPubKey, "")
+		if err != nil {
+			return err
+		}
+		data.EncKeyType = string(enc.Type())
+	}
+	return s.RotateAccountKey(data, blockHeight(s))
+}
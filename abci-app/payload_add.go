@@ -37,11 +37,23 @@ func checkPayloadAddTransaction(tx *transaction.Transaction, s *state.State) err
 	if s.HasPayload(data.ID) {
 		return errors.New("payload exists")
 	}
-	k, err := s.GetAccountPubKey(tx.Signer)
+	// Sender has rights on payload, so it is only the signer
+	if data.SenderAccountID != tx.Signer {
+		return errors.New("sender of payload should be signer of transaction")
+	}
+	for _, p := range data.PrivateData {
+		if p.Envelope != "" && data.GetEnvelope(p.Envelope) == nil {
+			return errors.New("envelope " + p.Envelope + " of private data is not found")
+		}
+	}
+	if err := checkWriter(tx, s); err != nil {
+		return err
+	}
+	k, err := s.GetAccountPubKeyAt(tx.Signer, blockHeight(s))
 	if err != nil {
 		return errors.New("pubkey for account can't be loaded: " + err.Error())
 	}
-	if err := tx.Verify(k); err != nil {
+	if err := tx.Verify(k, s.ChainID()); err != nil {
 		return errors.New("tx can't be verified: " + err.Error())
 	}
 	return nil
@@ -53,5 +65,8 @@ func deliverPayloadAddTransaction(tx *transaction.Transaction, s *state.State) e
 	if err != nil {
 		return err
 	}
-	return s.AddPayload(data)
+	if err := s.AddPayload(data); err != nil {
+		return err
+	}
+	return s.IncAccountNonce(tx.Signer)
 }
@@ -0,0 +1,68 @@
+/*
+ * Copyright (C) 2018 eeonevision
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy of
+ * this software and associated documentation files (the "Software"), to deal in
+ * the Software without restriction, including without limitation the rights to
+ * use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+ * the Software, and to permit persons to whom the Software is furnished to do so,
+ * subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+ * FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+ * COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+ * IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+ * CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ */
+
+package app
+
+import (
+	"errors"
+
+	"github.com/eeonevision/anychaindb/state"
+	"github.com/eeonevision/anychaindb/transaction"
+)
+
+func checkPayloadUpdateTransaction(tx *transaction.Transaction, s *state.State) error {
+	data := &state.PayloadUpdate{}
+	_, err := data.UnmarshalMsg(tx.Data)
+	if err != nil {
+		return err
+	}
+	payload, err := s.GetPayload(data.ID)
+	if err != nil {
+		return errors.New("payload can't be loaded: " + err.Error())
+	}
+	if tx.Signer != payload.SenderAccountID {
+		return errors.New("payload can be updated only by its sender")
+	}
+	if err := checkWriter(tx, s); err != nil {
+		return err
+	}
+	k, err := s.GetAccountPubKeyAt(tx.Signer, blockHeight(s))
+	if err != nil {
+		return errors.New("pubkey for account can't be loaded: " + err.Error())
+	}
+	if err := tx.Verify(k, s.ChainID()); err != nil {
+		return errors.New("tx can't be verified: " + err.Error())
+	}
+	return nil
+}
+
+func deliverPayloadUpdateTransaction(tx *transaction.Transaction, s *state.State) error {
+	data := &state.PayloadUpdate{}
+	_, err := data.UnmarshalMsg(tx.Data)
+	if err != nil {
+		return err
+	}
+	// Time of update is taken from signed transaction, so it's the same on all nodes
+	if err := s.UpdatePayload(data, float64(tx.Timestamp/1000000)); err != nil {
+		return err
+	}
+	return s.IncAccountNonce(tx.Signer)
+}
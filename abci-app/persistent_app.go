@@ -22,11 +22,12 @@
 package app
 
 import (
+	"fmt"
+	"time"
+
 	"github.com/tendermint/tendermint/libs/log"
 
 	"github.com/eeonevision/anychaindb/state"
-	"github.com/globalsign/mgo"
-	"github.com/globalsign/mgo/bson"
 	"github.com/tendermint/tendermint/abci/types"
 )
 
@@ -37,13 +38,10 @@ type PersistentApplication struct {
 }
 
 // NewPersistentApplication method construct application with persistent state
-func NewPersistentApplication(dbHost, dbName string) *PersistentApplication {
-	stateDB, err := mgo.Dial(dbHost)
-	if err != nil {
-		panic("Error initialize Mongo DB: " + err.Error())
-	}
+// kept in chosen storage backend: mongodb, leveldb or memory.
+func NewPersistentApplication(dbBackend, dbHost, dbName string) *PersistentApplication {
 	return &PersistentApplication{
-		app: &Application{state: state.NewStateFromDB(stateDB.DB(dbName))},
+		app: NewApplication(dbBackend, dbHost, dbName),
 	}
 }
 
@@ -52,7 +50,9 @@ func (app *PersistentApplication) SetLogger(l log.Logger) {
 	app.app.SetLogger(l)
 }
 
-// Info method returns application info with last block height and hash
+// Info method returns application info with last block height and hash.
+// Block info is written together with the state of block, so Tendermint
+// replays exactly the blocks which are missed in the state.
 func (app *PersistentApplication) Info(req types.RequestInfo) (resInfo types.ResponseInfo) {
 	resInfo = app.app.Info()
 	lastBlock := app.LoadLastBlock()
@@ -76,16 +76,12 @@ func (app *PersistentApplication) CheckTx(tx []byte) types.ResponseCheckTx {
 	return app.app.CheckTx(tx)
 }
 
-// Commit method commits the state and returns the application state hash
+// Commit method atomically writes all changes of the block together with
+// its height and returns the application state hash
 func (app *PersistentApplication) Commit() types.ResponseCommit {
-	appCommit := app.app.Commit()
-
-	lastBlock := LastBlockInfo{
-		Height:  app.blockHeader.Height,
-		AppHash: appCommit.Data, // this hash will be in the next block header
-	}
-
-	app.SaveLastBlock(lastBlock)
+	// this hash will be in the next block header
+	appCommit := app.app.commit(app.blockHeader.Height)
+	app.app.logger.Info("Committed block", "height", app.blockHeader.Height, "hash", fmt.Sprintf("%X", appCommit.Data))
 	return appCommit
 }
 
@@ -94,50 +90,43 @@ func (app *PersistentApplication) Query(reqQuery types.RequestQuery) types.Respo
 	return app.app.Query(reqQuery)
 }
 
+// SetTxTimeWindow method sets allowed difference between timestamp
+// of transaction and time of block
+func (app *PersistentApplication) SetTxTimeWindow(window time.Duration) {
+	app.app.SetTxTimeWindow(window)
+}
+
+// SetUnsignedAccountsHeight method sets height, below which unsigned
+// AccountAdd transactions are accepted
+func (app *PersistentApplication) SetUnsignedAccountsHeight(height int64) {
+	app.app.SetUnsignedAccountsHeight(height)
+}
+
 // InitChain method initializes Anychaindb
 func (app *PersistentApplication) InitChain(req types.RequestInitChain) types.ResponseInitChain {
-	return types.ResponseInitChain{}
+	return app.app.InitChain(req)
 }
 
 // BeginBlock method tracks the block hash and header information
 func (app *PersistentApplication) BeginBlock(req types.RequestBeginBlock) (resBeginBlock types.ResponseBeginBlock) {
 	// update latest block info
 	app.blockHeader = req.Header
+	app.app.BeginBlock(req)
 
 	// reset valset changes
 	app.changes = make([]types.Validator, 0)
 	return types.ResponseBeginBlock{}
 }
 
-// EndBlock method should in future update the validator set
+// EndBlock method returns updates of the validator set applied by the block
 func (app *PersistentApplication) EndBlock(reqEndBlock types.RequestEndBlock) (resEndBlock types.ResponseEndBlock) {
+	app.changes = append(app.changes, app.app.EndBlock(reqEndBlock).ValidatorUpdates...)
 	return types.ResponseEndBlock{ValidatorUpdates: app.changes}
 }
 
-type LastBlockInfo struct {
-	Height  int64  `bson:"height"`
-	AppHash []byte `bson:"app_hash"`
-}
-
-// LoadLastBlock method load last confirmed block from DB
-func (app *PersistentApplication) LoadLastBlock() (lastBlock LastBlockInfo) {
-	if err := app.app.state.DB.C("blocks").Find(nil).One(&lastBlock); err != mgo.ErrNotFound && err != nil {
-		app.app.logger.Error("Block loading error", "error", err.Error())
-		return
-	}
-	app.app.logger.Info("Loaded block", "hash", string(lastBlock.AppHash))
+// LoadLastBlock method returns last committed block
+func (app *PersistentApplication) LoadLastBlock() state.LastBlockInfo {
+	lastBlock := app.app.state.LastBlock()
+	app.app.logger.Info("Loaded block", "height", lastBlock.Height, "hash", fmt.Sprintf("%X", lastBlock.AppHash))
 	return lastBlock
 }
-
-// SaveLastBlock method saves appHash of loast confirmed block in DB
-func (app *PersistentApplication) SaveLastBlock(lastBlock LastBlockInfo) {
-	lb := app.LoadLastBlock()
-	selector := bson.M{"height": lb.Height}
-	updator := bson.M{"$set": bson.M{"height": lastBlock.Height, "app_hash": lastBlock.AppHash}}
-	_, err := app.app.state.DB.C("blocks").Upsert(selector, updator)
-	if err != nil {
-		app.app.logger.Error("Block saving error", "error", err.Error())
-		return
-	}
-	app.app.logger.Info("Saved block", "height", lastBlock.Height, "hash", string(lastBlock.AppHash))
-}
@@ -0,0 +1,71 @@
+/*
+ * Copyright (C) 2018 eeonevision
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy of
+ * this software and associated documentation files (the "Software"), to deal in
+ * the Software without restriction, including without limitation the rights to
+ * use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+ * the Software, and to permit persons to whom the Software is furnished to do so,
+ * subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+ * FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+ * COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+ * IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+ * CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ */
+
+package app
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/eeonevision/anychaindb/state"
+	"github.com/eeonevision/anychaindb/transaction"
+)
+
+// DefaultTxTimeWindow is the default allowed difference between
+// timestamp of transaction and time of block.
+const DefaultTxTimeWindow = 10 * time.Minute
+
+// blockHeight function returns height of block, which is built over the state.
+func blockHeight(s *state.State) int64 {
+	return s.LastBlock().Height + 1
+}
+
+// isSigned function reports whether transaction is signed by existing
+// account and therefore should follow the nonce of signer.
+func isSigned(tx *transaction.Transaction) bool {
+	return tx.Type != transaction.AccountAdd
+}
+
+// checkTxTimestamp function rejects transaction, which timestamp is
+// outside of given window around time of block. Zero window disables check.
+func checkTxTimestamp(tx *transaction.Transaction, blockTime time.Time, window time.Duration) error {
+	if window <= 0 {
+		return nil
+	}
+	diff := time.Unix(0, tx.Timestamp).Sub(blockTime)
+	if diff > window || diff < -window {
+		return fmt.Errorf("tx timestamp differs from block time by %s, allowed %s", diff, window)
+	}
+	return nil
+}
+
+// checkTxNonce function rejects transaction, which nonce differs
+// from the next nonce of signer account.
+func checkTxNonce(tx *transaction.Transaction, s *state.State) error {
+	nonce, err := s.GetAccountNonce(tx.Signer)
+	if err != nil {
+		return fmt.Errorf("nonce for account can't be loaded: %s", err.Error())
+	}
+	if tx.Nonce != nonce {
+		return fmt.Errorf("invalid nonce %d, expected %d", tx.Nonce, nonce)
+	}
+	return nil
+}
@@ -0,0 +1,104 @@
+/*
+ * Copyright (C) 2018 eeonevision
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy of
+ * this software and associated documentation files (the "Software"), to deal in
+ * the Software without restriction, including without limitation the rights to
+ * use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+ * the Software, and to permit persons to whom the Software is furnished to do so,
+ * subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+ * FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+ * COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+ * IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+ * CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ */
+
+package app
+
+import (
+	"errors"
+
+	"github.com/eeonevision/anychaindb/state"
+	"github.com/eeonevision/anychaindb/transaction"
+)
+
+// checkRoleChangeTransaction function checks that role is granted or revoked
+// by admin account.
+func checkRoleChangeTransaction(tx *transaction.Transaction, s *state.State) error {
+	data := &state.RoleChange{}
+	_, err := data.UnmarshalMsg(tx.Data)
+	if err != nil {
+		return err
+	}
+	if !state.IsRole(data.Role) {
+		return errors.New("unknown role " + data.Role)
+	}
+	signer, err := s.GetAccount(tx.Signer)
+	if err != nil {
+		return errors.New("signer account can't be loaded: " + err.Error())
+	}
+	if !signer.HasRole(state.RoleAdmin) {
+		return errors.New("roles can be changed only by admin")
+	}
+	acc, err := s.GetAccount(data.AccountID)
+	if err != nil {
+		return errors.New("account can't be loaded: " + err.Error())
+	}
+	hasRole := false
+	for _, r := range acc.Roles {
+		hasRole = hasRole || r == data.Role
+	}
+	if tx.Type == transaction.RoleGrant && hasRole {
+		return errors.New("account already has role " + data.Role)
+	}
+	if tx.Type == transaction.RoleRevoke && !hasRole {
+		return errors.New("account has no role " + data.Role)
+	}
+	k, err := s.GetAccountPubKeyAt(tx.Signer, blockHeight(s))
+	if err != nil {
+		return errors.New("pubkey for account can't be loaded: " + err.Error())
+	}
+	if err := tx.Verify(k, s.ChainID()); err != nil {
+		return errors.New("tx can't be verified: " + err.Error())
+	}
+	return nil
+}
+
+func deliverRoleChangeTransaction(tx *transaction.Transaction, s *state.State) error {
+	data := &state.RoleChange{}
+	_, err := data.UnmarshalMsg(tx.Data)
+	if err != nil {
+		return err
+	}
+	if tx.Type == transaction.RoleGrant {
+		err = s.GrantRole(data.AccountID, data.Role)
+	} else {
+		err = s.RevokeRole(data.AccountID, data.Role)
+	}
+	if err != nil {
+		return err
+	}
+	return s.IncAccountNonce(tx.Signer)
+}
+
+// checkWriter function checks that signer of payload transaction has writer
+// role, if network is permissioned.
+func checkWriter(tx *transaction.Transaction, s *state.State) error {
+	if !s.Params().Permissioned {
+		return nil
+	}
+	acc, err := s.GetAccount(tx.Signer)
+	if err != nil {
+		return errors.New("signer account can't be loaded: " + err.Error())
+	}
+	if !acc.HasRole(state.RoleWriter) {
+		return errors.New("account has no writer role")
+	}
+	return nil
+}
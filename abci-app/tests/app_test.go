@@ -0,0 +1,803 @@
+/*
+ * Copyright (C) 2018 eeonevision
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy of
+ * this software and associated documentation files (the "Software"), to deal in
+ * the Software without restriction, including without limitation the rights to
+ * use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+ * the Software, and to permit persons to whom the Software is furnished to do so,
+ * subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+ * FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+ * COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+ * IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+ * CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ */
+package tests
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	app "github.com/eeonevision/anychaindb/abci-app"
+	"github.com/eeonevision/anychaindb/client"
+	"github.com/eeonevision/anychaindb/crypto"
+	"github.com/eeonevision/anychaindb/state"
+	"github.com/eeonevision/anychaindb/transaction"
+	"github.com/tendermint/tendermint/abci/types"
+)
+
+const testChainID = "test-chain"
+
+func newApplication() *app.Application {
+	a := app.NewApplication(state.MemoryBackend, "", "")
+	a.InitChain(types.RequestInitChain{ChainId: testChainID})
+	a.BeginBlock(types.RequestBeginBlock{Header: types.Header{ChainID: testChainID, Time: time.Now().Unix()}})
+	return a
+}
+
+func accountAddTx(t *testing.T, id string) []byte {
+	key, err := crypto.CreateKeyPair()
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	data, err := (&state.Account{ID: id, PubKey: key.GetPubString()}).MarshalMsg(nil)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	tx := transaction.New(transaction.AccountAdd, id, data)
+	if err := tx.Sign(key, testChainID); err != nil {
+		t.Fatalf("%s", err)
+	}
+	bs, err := tx.ToBytes()
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	return bs
+}
+
+func TestCheckTxRejectsPendingDuplicates(t *testing.T) {
+	a := newApplication()
+	tx1, tx2 := accountAddTx(t, "1"), accountAddTx(t, "1")
+	if res := a.CheckTx(tx1); res.Code != app.CodeTypeOK {
+		t.Fatalf("first tx was rejected: %s", res.Log)
+	}
+	if res := a.CheckTx(tx2); res.Code != app.CodeTypeCheckTxError {
+		t.Fatalf("duplicated tx was accepted, code: %d", res.Code)
+	}
+	// Only first tx is included into block
+	if res := a.DeliverTx(tx1); res.Code != app.CodeTypeOK {
+		t.Fatalf("tx was not delivered: %s", res.Log)
+	}
+	a.Commit()
+	if res := a.CheckTx(tx2); res.Code != app.CodeTypeCheckTxError {
+		t.Fatalf("duplicated tx was accepted after commit, code: %d", res.Code)
+	}
+	if res := a.CheckTx(accountAddTx(t, "2")); res.Code != app.CodeTypeOK {
+		t.Fatalf("tx was rejected after commit: %s", res.Log)
+	}
+}
+
+func payloadAddTx(t *testing.T, key *crypto.Key, signer, id, chainID string, nonce uint32) *transaction.Transaction {
+	data, err := (&state.Payload{ID: id, SenderAccountID: signer}).MarshalMsg(nil)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	tx := transaction.New(transaction.PayloadAdd, signer, data)
+	tx.Nonce = nonce
+	if err := tx.Sign(key, chainID); err != nil {
+		t.Fatalf("%s", err)
+	}
+	return tx
+}
+
+func TestReplayProtection(t *testing.T) {
+	a := newApplication()
+	key, err := crypto.CreateKeyPair()
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	data, _ := (&state.Account{ID: "1", PubKey: key.GetPubString(), Nonce: 5}).MarshalMsg(nil)
+	accTx := transaction.New(transaction.AccountAdd, "1", data)
+	if err := accTx.Sign(key, testChainID); err != nil {
+		t.Fatalf("%s", err)
+	}
+	accBytes, _ := accTx.ToBytes()
+	if res := a.DeliverTx(accBytes); res.Code != app.CodeTypeOK {
+		t.Fatalf("account was not delivered: %s", res.Log)
+	}
+	a.Commit()
+
+	first, _ := payloadAddTx(t, key, "1", "p1", testChainID, 0).ToBytes()
+	if res := a.CheckTx(first); res.Code != app.CodeTypeOK {
+		t.Fatalf("tx with first nonce was rejected: %s", res.Log)
+	}
+	if res := a.CheckTx(first); res.Code != app.CodeTypeBadNonce {
+		t.Fatalf("replayed tx was accepted, code: %d", res.Code)
+	}
+	second, _ := payloadAddTx(t, key, "1", "p2", testChainID, 1).ToBytes()
+	if res := a.CheckTx(second); res.Code != app.CodeTypeOK {
+		t.Fatalf("tx with next nonce was rejected: %s", res.Log)
+	}
+	if res := a.DeliverTx(second); res.Code != app.CodeTypeBadNonce {
+		t.Fatalf("tx with skipped nonce was delivered, code: %d", res.Code)
+	}
+	other, _ := payloadAddTx(t, key, "1", "p3", "other-chain", 0).ToBytes()
+	if res := a.DeliverTx(other); res.Code != app.CodeTypeDeliverTxError {
+		t.Fatalf("tx signed for other chain was delivered, code: %d", res.Code)
+	}
+	stale := payloadAddTx(t, key, "1", "p4", testChainID, 0)
+	stale.Timestamp = time.Now().Add(-time.Hour).UnixNano()
+	if err := stale.Sign(key, testChainID); err != nil {
+		t.Fatalf("%s", err)
+	}
+	staleBytes, _ := stale.ToBytes()
+	if res := a.DeliverTx(staleBytes); res.Code != app.CodeTypeBadTimestamp {
+		t.Fatalf("stale tx was delivered, code: %d", res.Code)
+	}
+	if res := a.DeliverTx(first); res.Code != app.CodeTypeOK {
+		t.Fatalf("tx was not delivered: %s", res.Log)
+	}
+	a.Commit()
+	res := a.Query(types.RequestQuery{Path: "accounts/nonce", Data: []byte("1")})
+	if string(res.Value) != "1" {
+		t.Fatalf("wrong next nonce: %s %s", res.Value, res.Log)
+	}
+}
+
+func TestAccountAddProofOfPossession(t *testing.T) {
+	a := newApplication()
+	owner, _ := crypto.CreateKeyPair()
+	other, _ := crypto.CreateKeyPair()
+	data, _ := (&state.Account{ID: "1", PubKey: owner.GetPubString()}).MarshalMsg(nil)
+
+	unsigned, _ := transaction.New(transaction.AccountAdd, "1", data).ToBytes()
+	if res := a.CheckTx(unsigned); res.Code != app.CodeTypeCheckTxError {
+		t.Fatalf("unsigned account was accepted, code: %d", res.Code)
+	}
+	forged := transaction.New(transaction.AccountAdd, "1", data)
+	forged.Sign(other, testChainID)
+	forgedBytes, _ := forged.ToBytes()
+	if res := a.CheckTx(forgedBytes); res.Code != app.CodeTypeCheckTxError {
+		t.Fatalf("account signed by other key was accepted, code: %d", res.Code)
+	}
+	if res := a.DeliverTx(forgedBytes); res.Code != app.CodeTypeDeliverTxError {
+		t.Fatalf("account signed by other key was delivered, code: %d", res.Code)
+	}
+
+	a.SetUnsignedAccountsHeight(10)
+	if res := a.DeliverTx(unsigned); res.Code != app.CodeTypeOK {
+		t.Fatalf("legacy account was not delivered below activation height: %s", res.Log)
+	}
+}
+
+func TestKeyRotation(t *testing.T) {
+	a := newApplication()
+	oldKey, _ := crypto.CreateKeyPair()
+	newKey, _ := crypto.CreateKeyPair()
+	data, _ := (&state.Account{ID: "1", PubKey: oldKey.GetPubString()}).MarshalMsg(nil)
+	accTx := transaction.New(transaction.AccountAdd, "1", data)
+	accTx.Sign(oldKey, testChainID)
+	accBytes, _ := accTx.ToBytes()
+	if res := a.DeliverTx(accBytes); res.Code != app.CodeTypeOK {
+		t.Fatalf("account was not delivered: %s", res.Log)
+	}
+	a.Commit()
+
+	data, _ = (&state.KeyRotation{AccountID: "1", PubKey: newKey.GetPubString()}).MarshalMsg(nil)
+	forged := transaction.New(transaction.KeyRotate, "1", data)
+	forged.Sign(newKey, testChainID)
+	forgedBytes, _ := forged.ToBytes()
+	if res := a.DeliverTx(forgedBytes); res.Code != app.CodeTypeDeliverTxError {
+		t.Fatalf("rotation signed by new key was delivered, code: %d", res.Code)
+	}
+	rotation := transaction.New(transaction.KeyRotate, "1", data)
+	rotation.Sign(oldKey, testChainID)
+	rotationBytes, _ := rotation.ToBytes()
+	if res := a.DeliverTx(rotationBytes); res.Code != app.CodeTypeOK {
+		t.Fatalf("rotation was not delivered: %s", res.Log)
+	}
+	a.Commit()
+
+	old, _ := payloadAddTx(t, oldKey, "1", "p1", testChainID, 1).ToBytes()
+	if res := a.DeliverTx(old); res.Code != app.CodeTypeDeliverTxError {
+		t.Fatalf("tx signed by rotated key was delivered, code: %d", res.Code)
+	}
+	current, _ := payloadAddTx(t, newKey, "1", "p1", testChainID, 1).ToBytes()
+	if res := a.DeliverTx(current); res.Code != app.CodeTypeOK {
+		t.Fatalf("tx signed by new key was not delivered: %s", res.Log)
+	}
+	a.Commit()
+	res := a.Query(types.RequestQuery{Path: "accounts", Data: []byte("1")})
+	acc := &state.Account{}
+	if err := json.Unmarshal(res.Value, acc); err != nil {
+		t.Fatalf("%s", err)
+	}
+	if len(acc.KeyHistory) != 2 || acc.PubKey != newKey.GetPubString() || acc.PubKeyAt(1) != oldKey.GetPubString() {
+		t.Fatalf("wrong key history: %+v", acc)
+	}
+}
+
+func deliverAccount(t *testing.T, a *app.Application, id string) *crypto.Key {
+	key, _ := crypto.CreateKeyPair()
+	data, _ := (&state.Account{ID: id, PubKey: key.GetPubString()}).MarshalMsg(nil)
+	tx := transaction.New(transaction.AccountAdd, id, data)
+	tx.Sign(key, testChainID)
+	bs, _ := tx.ToBytes()
+	if res := a.DeliverTx(bs); res.Code != app.CodeTypeOK {
+		t.Fatalf("account was not delivered: %s", res.Log)
+	}
+	return key
+}
+
+func TestPrivateDataGrant(t *testing.T) {
+	a := newApplication()
+	sender := deliverAccount(t, a, "1")
+	receiver := deliverAccount(t, a, "2")
+	deliverAccount(t, a, "3")
+	payload, _ := payloadAddTx(t, sender, "1", "p1", testChainID, 0).ToBytes()
+	if res := a.DeliverTx(payload); res.Code != app.CodeTypeOK {
+		t.Fatalf("payload was not delivered: %s", res.Log)
+	}
+	a.Commit()
+
+	grantTx := func(key *crypto.Key, signer, receiverID string, nonce uint32) []byte {
+		data, _ := (&state.PrivateDataGrant{
+			ID:          "p1",
+			PrivateData: &state.PrivateData{ReceiverAccountID: receiverID, Data: "c2VjcmV0"},
+		}).MarshalMsg(nil)
+		tx := transaction.New(transaction.PrivateDataGrant, signer, data)
+		tx.Nonce = nonce
+		tx.Sign(key, testChainID)
+		bs, _ := tx.ToBytes()
+		return bs
+	}
+	if res := a.DeliverTx(grantTx(receiver, "2", "3", 0)); res.Code != app.CodeTypeDeliverTxError {
+		t.Fatalf("grant signed by receiver was delivered, code: %d", res.Code)
+	}
+	if res := a.DeliverTx(grantTx(sender, "1", "4", 1)); res.Code != app.CodeTypeDeliverTxError {
+		t.Fatalf("grant to unknown account was delivered, code: %d", res.Code)
+	}
+	if res := a.DeliverTx(grantTx(sender, "1", "3", 1)); res.Code != app.CodeTypeOK {
+		t.Fatalf("grant was not delivered: %s", res.Log)
+	}
+	if res := a.DeliverTx(grantTx(sender, "1", "3", 2)); res.Code != app.CodeTypeDeliverTxError {
+		t.Fatalf("duplicated grant was delivered, code: %d", res.Code)
+	}
+	a.Commit()
+	res := a.Query(types.RequestQuery{Path: "payloads", Data: []byte("p1")})
+	p := &state.Payload{}
+	if err := json.Unmarshal(res.Value, p); err != nil {
+		t.Fatalf("%s", err)
+	}
+	if len(p.PrivateData) != 1 || p.PrivateData[0].ReceiverAccountID != "3" || p.Revision != 1 {
+		t.Fatalf("wrong payload after grant: %+v", p)
+	}
+}
+
+func TestPayloadSender(t *testing.T) {
+	a := newApplication()
+	deliverAccount(t, a, "1")
+	forger := deliverAccount(t, a, "2")
+	a.Commit()
+
+	// Payload is attributed to other account
+	data, _ := (&state.Payload{ID: "p1", SenderAccountID: "1"}).MarshalMsg(nil)
+	tx := transaction.New(transaction.PayloadAdd, "2", data)
+	if err := tx.Sign(forger, testChainID); err != nil {
+		t.Fatalf("%s", err)
+	}
+	bs, _ := tx.ToBytes()
+	if res := a.CheckTx(bs); res.Code != app.CodeTypeCheckTxError {
+		t.Fatalf("payload of other sender was checked, code: %d", res.Code)
+	}
+	if res := a.DeliverTx(bs); res.Code != app.CodeTypeDeliverTxError {
+		t.Fatalf("payload of other sender was delivered, code: %d", res.Code)
+	}
+	own, _ := payloadAddTx(t, forger, "2", "p1", testChainID, 0).ToBytes()
+	if res := a.DeliverTx(own); res.Code != app.CodeTypeOK {
+		t.Fatalf("payload of signer was not delivered: %s", res.Log)
+	}
+}
+
+func TestPayloadUpdateAndRevoke(t *testing.T) {
+	a := newApplication()
+	owner := deliverAccount(t, a, "1")
+	other := deliverAccount(t, a, "2")
+	first, _ := payloadAddTx(t, owner, "1", "p1", testChainID, 0).ToBytes()
+	if res := a.DeliverTx(first); res.Code != app.CodeTypeOK {
+		t.Fatalf("payload was not delivered: %s", res.Log)
+	}
+	a.Commit()
+	nonces := map[string]uint32{"1": 1}
+	keys := map[string]*crypto.Key{"1": owner, "2": other}
+	build := func(id string, fn func(b *client.Builder) (*transaction.Transaction, error)) []byte {
+		tx, err := fn(client.NewBuilder(keys[id], id, testChainID, nonces[id]))
+		if err != nil {
+			t.Fatalf("%s", err)
+		}
+		bs, _ := tx.ToBytes()
+		return bs
+	}
+	// Rejected transactions are rejected both in mempool and in block
+	reject := func(name string, bs []byte) {
+		if res := a.CheckTx(bs); res.Code != app.CodeTypeCheckTxError {
+			t.Fatalf("%s was checked, code: %d", name, res.Code)
+		}
+		if res := a.DeliverTx(bs); res.Code != app.CodeTypeDeliverTxError {
+			t.Fatalf("%s was delivered, code: %d", name, res.Code)
+		}
+	}
+	deliver := func(id string, bs []byte) {
+		if res := a.DeliverTx(bs); res.Code != app.CodeTypeOK {
+			t.Fatalf("tx of %s was not delivered: %s", id, res.Log)
+		}
+		nonces[id]++
+		a.Commit()
+	}
+	update := func(revision uint32) func(b *client.Builder) (*transaction.Transaction, error) {
+		return func(b *client.Builder) (*transaction.Transaction, error) {
+			return b.UpdatePayload(&state.PayloadUpdate{ID: "p1", PublicData: "updated", ExpectedRevision: &revision})
+		}
+	}
+	revoke := func(b *client.Builder) (*transaction.Transaction, error) {
+		return b.RevokePayload("p1", "posted by mistake")
+	}
+
+	reject("update of other account", build("2", update(0)))
+	reject("update of stale revision", build("1", update(1)))
+	deliver("1", build("1", update(0)))
+	reject("revocation of other account", build("2", revoke))
+	deliver("1", build("1", revoke))
+	reject("update of revoked payload", build("1", update(2)))
+	reject("repeated revocation", build("1", revoke))
+
+	query := a.Query(types.RequestQuery{Path: "payloads", Data: []byte("p1")})
+	p := &state.Payload{}
+	if err := json.Unmarshal(query.Value, p); err != nil || p.Revision != 2 || p.PublicData != "updated" || p.Revoked == nil {
+		t.Fatalf("wrong payload after update and revocation: %s, %v", query.Value, err)
+	}
+}
+
+func TestAccountKeyTypes(t *testing.T) {
+	a := newApplication()
+	for i, keyType := range []crypto.KeyType{crypto.KeyTypeSecp256k1, crypto.KeyTypeEd25519} {
+		id := string(keyType)
+		key, err := crypto.CreateKeyPairOfType(keyType)
+		if err != nil {
+			t.Fatalf("%s", err)
+		}
+		data, _ := (&state.Account{ID: id, PubKey: key.GetPubString()}).MarshalMsg(nil)
+		tx := transaction.New(transaction.AccountAdd, id, data)
+		tx.Sign(key, testChainID)
+		bs, _ := tx.ToBytes()
+		if res := a.DeliverTx(bs); res.Code != app.CodeTypeOK {
+			t.Fatalf("%s account was not delivered: %s", keyType, res.Log)
+		}
+		payload, _ := payloadAddTx(t, key, id, "p"+strconv.Itoa(i), testChainID, 0).ToBytes()
+		if res := a.DeliverTx(payload); res.Code != app.CodeTypeOK {
+			t.Fatalf("payload signed by %s key was not delivered: %s", keyType, res.Log)
+		}
+	}
+	a.Commit()
+	res := a.Query(types.RequestQuery{Path: "accounts", Data: []byte(crypto.KeyTypeEd25519)})
+	acc := &state.Account{}
+	if err := json.Unmarshal(res.Value, acc); err != nil {
+		t.Fatalf("%s", err)
+	}
+	if acc.KeyType != string(crypto.KeyTypeEd25519) {
+		t.Errorf("key type of account was not recorded: %q", acc.KeyType)
+	}
+
+	// Declared key type should match the key
+	key, _ := crypto.CreateKeyPairOfType(crypto.KeyTypeEd25519)
+	data, _ := (&state.Account{ID: "3", PubKey: key.GetPubString(), KeyType: string(crypto.KeyTypeSecp256k1)}).MarshalMsg(nil)
+	tx := transaction.New(transaction.AccountAdd, "3", data)
+	tx.Sign(key, testChainID)
+	bs, _ := tx.ToBytes()
+	if res := a.CheckTx(bs); res.Code != app.CodeTypeCheckTxError {
+		t.Fatalf("account with mismatched key type was accepted, code: %d", res.Code)
+	}
+}
+
+func TestAccountEncryptionKey(t *testing.T) {
+	a := newApplication()
+	key, _ := crypto.CreateKeyPair()
+	encKey, _ := crypto.CreateKeyPairOfType(crypto.KeyTypeEd25519)
+	accountTx := func(id, encPub string) []byte {
+		data, _ := (&state.Account{ID: id, PubKey: key.GetPubString(), EncPubKey: encPub}).MarshalMsg(nil)
+		tx := transaction.New(transaction.AccountAdd, id, data)
+		tx.Sign(key, testChainID)
+		bs, _ := tx.ToBytes()
+		return bs
+	}
+	if res := a.CheckTx(accountTx("1", key.GetPubString())); res.Code != app.CodeTypeCheckTxError {
+		t.Fatalf("account with the same signing and encryption keys was accepted, code: %d", res.Code)
+	}
+	if res := a.DeliverTx(accountTx("1", encKey.GetPubString())); res.Code != app.CodeTypeOK {
+		t.Fatalf("account was not delivered: %s", res.Log)
+	}
+	a.Commit()
+	res := a.Query(types.RequestQuery{Path: "accounts", Data: []byte("1")})
+	acc := &state.Account{}
+	if err := json.Unmarshal(res.Value, acc); err != nil {
+		t.Fatalf("%s", err)
+	}
+	if pub, keyType := acc.EncryptionKey(); pub != encKey.GetPubString() || keyType != string(crypto.KeyTypeEd25519) {
+		t.Errorf("wrong encryption key of account: %s %s", keyType, pub)
+	}
+	legacy := &state.Account{PubKey: key.GetPubString()}
+	if pub, _ := legacy.EncryptionKey(); pub != key.GetPubString() {
+		t.Errorf("account without encryption key does not fall back to signing key")
+	}
+}
+
+func TestEncryptionKeyRotation(t *testing.T) {
+	a := newApplication()
+	key, _ := crypto.CreateKeyPair()
+	encKey, _ := crypto.CreateKeyPair()
+	acc := &state.Account{ID: "1", PubKey: key.GetPubString(), EncPubKey: encKey.GetPubString()}
+	tx, err := client.NewBuilder(key, "1", testChainID, 0).AddAccount(acc)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	bs, _ := tx.ToBytes()
+	if res := a.DeliverTx(bs); res.Code != app.CodeTypeOK {
+		t.Fatalf("account was not delivered: %s", res.Log)
+	}
+	a.Commit()
+
+	newKey, _ := crypto.CreateKeyPair()
+	tx, _ = client.NewBuilder(key, "1", testChainID, 0).RotateKey(newKey, encKey)
+	bs, _ = tx.ToBytes()
+	if res := a.DeliverTx(bs); res.Code != app.CodeTypeDeliverTxError {
+		t.Fatalf("rotation to the same encryption key was delivered, code: %d", res.Code)
+	}
+	newEncKey, _ := crypto.CreateKeyPair()
+	tx, _ = client.NewBuilder(key, "1", testChainID, 0).RotateKey(newKey, newEncKey)
+	bs, _ = tx.ToBytes()
+	if res := a.DeliverTx(bs); res.Code != app.CodeTypeOK {
+		t.Fatalf("rotation was not delivered: %s", res.Log)
+	}
+	a.Commit()
+	res := a.Query(types.RequestQuery{Path: "accounts", Data: []byte("1")})
+	if err := json.Unmarshal(res.Value, acc); err != nil {
+		t.Fatalf("%s", err)
+	}
+	// History keeps public keys only
+	if acc.EncPubKey != newEncKey.GetPubString() || len(acc.KeyHistory) != 2 ||
+		acc.KeyHistory[0].EncPubKey != encKey.GetPubString() || acc.KeyHistory[1].EncPubKey != newEncKey.GetPubString() {
+		t.Fatalf("encryption key was not rotated: %+v", acc)
+	}
+	if strings.Contains(string(res.Value), encKey.GetPrivString()) || strings.Contains(string(res.Value), key.GetPrivString()) {
+		t.Fatalf("previous private key is published: %s", res.Value)
+	}
+}
+
+func TestAccountAdmission(t *testing.T) {
+	registrarKey, _ := crypto.CreateKeyPair()
+	newAccount := func(id string) (*state.Account, *crypto.Key) {
+		key, _ := crypto.CreateKeyPair()
+		return &state.Account{ID: id, PubKey: key.GetPubString()}, key
+	}
+	initApp := func(genesis string) *app.Application {
+		a := app.NewApplication(state.MemoryBackend, "", "")
+		a.InitChain(types.RequestInitChain{ChainId: testChainID, AppStateBytes: []byte(genesis)})
+		a.BeginBlock(types.RequestBeginBlock{Header: types.Header{ChainID: testChainID, Time: time.Now().Unix()}})
+		return a
+	}
+	deliver := func(a *app.Application, acc *state.Account, key *crypto.Key) types.ResponseDeliverTx {
+		tx, err := client.NewBuilder(key, acc.ID, testChainID, 0).AddAccount(acc)
+		if err != nil {
+			t.Fatalf("%s", err)
+		}
+		bs, _ := tx.ToBytes()
+		return a.DeliverTx(bs)
+	}
+
+	// Proof-of-work of chain difficulty is required
+	a := initApp(`{"params": {"account_admission": "pow", "pow_difficulty": 8}}`)
+	acc, key := newAccount("1")
+	for acc.WorkBits(testChainID) >= 8 {
+		acc.WorkNonce++
+	}
+	if res := deliver(a, acc, key); res.Code != app.CodeTypeDeliverTxError {
+		t.Fatalf("account without proof-of-work was accepted, code: %d", res.Code)
+	}
+	client.SolveProofOfWork(acc, testChainID, 8)
+	if res := deliver(a, acc, key); res.Code != app.CodeTypeOK {
+		t.Fatalf("account with proof-of-work was not delivered: %s", res.Log)
+	}
+
+	// Registrar from genesis co-signs new accounts
+	a = initApp(`{"params": {"account_admission": "registrar", "registrars": ["r"]},
+		"accounts": [{"_id": "r", "public_key": "` + registrarKey.GetPubString() + `"}]}`)
+	acc, key = newAccount("2")
+	if res := deliver(a, acc, key); res.Code != app.CodeTypeDeliverTxError {
+		t.Fatalf("account without registrar was accepted, code: %d", res.Code)
+	}
+	other, otherKey := newAccount("3")
+	if err := client.NewBuilder(key, acc.ID, testChainID, 0).Register(other); err != nil {
+		t.Fatalf("%s", err)
+	}
+	if res := deliver(a, other, otherKey); res.Code != app.CodeTypeDeliverTxError {
+		t.Fatalf("account co-signed by unknown registrar was accepted, code: %d", res.Code)
+	}
+	if err := client.NewBuilder(registrarKey, "r", testChainID, 0).Register(acc); err != nil {
+		t.Fatalf("%s", err)
+	}
+	if res := deliver(a, acc, key); res.Code != app.CodeTypeOK {
+		t.Fatalf("account co-signed by registrar was not delivered: %s", res.Log)
+	}
+}
+
+func TestAccountRoles(t *testing.T) {
+	adminKey, _ := crypto.CreateKeyPair()
+	a := app.NewApplication(state.MemoryBackend, "", "")
+	a.InitChain(types.RequestInitChain{ChainId: testChainID, AppStateBytes: []byte(`{"params": {"permissioned": true},
+		"accounts": [{"_id": "a", "public_key": "` + adminKey.GetPubString() + `", "roles": ["admin"]}]}`)})
+	a.BeginBlock(types.RequestBeginBlock{Header: types.Header{ChainID: testChainID, Time: time.Now().Unix()}})
+	deliver := func(tx *transaction.Transaction, err error) types.ResponseDeliverTx {
+		if err != nil {
+			t.Fatalf("%s", err)
+		}
+		bs, _ := tx.ToBytes()
+		return a.DeliverTx(bs)
+	}
+	admin := client.NewBuilder(adminKey, "a", testChainID, 0)
+
+	// New account is co-signed by registrar
+	key, _ := crypto.CreateKeyPair()
+	acc := &state.Account{ID: "w", PubKey: key.GetPubString()}
+	writer := client.NewBuilder(key, acc.ID, testChainID, 0)
+	if res := deliver(writer.AddAccount(acc)); res.Code != app.CodeTypeDeliverTxError {
+		t.Fatalf("account without registrar was accepted, code: %d", res.Code)
+	}
+	admin.Register(acc)
+	if res := deliver(writer.AddAccount(acc)); res.Code != app.CodeTypeOK {
+		t.Fatalf("account co-signed by admin was not delivered: %s", res.Log)
+	}
+
+	// Payloads are posted only by writers
+	if res := deliver(writer.RevokePayload("p1", "")); res.Code != app.CodeTypeDeliverTxError {
+		t.Fatalf("payload tx of account without role was accepted, code: %d", res.Code)
+	}
+	writer = client.NewBuilder(key, acc.ID, testChainID, 0)
+	if res := deliver(writer.GrantRole("w", state.RoleWriter)); res.Code != app.CodeTypeDeliverTxError {
+		t.Fatalf("role was granted by non-admin, code: %d", res.Code)
+	}
+	if res := deliver(admin.GrantRole("w", state.RoleWriter)); res.Code != app.CodeTypeOK {
+		t.Fatalf("role was not granted: %s", res.Log)
+	}
+	writer = client.NewBuilder(key, acc.ID, testChainID, 0)
+	if res := deliver(writer.AddPayload("p1", "public", nil, nil)); res.Code != app.CodeTypeOK {
+		t.Fatalf("payload of writer was not delivered: %s", res.Log)
+	}
+	if res := deliver(admin.RevokeRole("w", state.RoleWriter)); res.Code != app.CodeTypeOK {
+		t.Fatalf("role was not revoked: %s", res.Log)
+	}
+	if res := deliver(writer.AddPayload("p2", "public", nil, nil)); res.Code != app.CodeTypeDeliverTxError {
+		t.Fatalf("payload of revoked writer was accepted, code: %d", res.Code)
+	}
+	// Sender withdraws own payload without writer role
+	writer = client.NewBuilder(key, acc.ID, testChainID, 1)
+	if res := deliver(writer.RevokePayload("p1", "withdrawn")); res.Code != app.CodeTypeOK {
+		t.Fatalf("payload was not revoked by its sender: %s", res.Log)
+	}
+}
+
+func TestGenesisState(t *testing.T) {
+	key, _ := crypto.CreateKeyPair()
+	validator := base64.StdEncoding.EncodeToString(make([]byte, 32))
+	genesis := `{
+		"params": {"account_admission": "open"},
+		"accounts": [{"_id": "1", "public_key": "` + key.GetPubString() + `", "roles": ["admin"]}],
+		"payloads": [{"_id": "p0", "sender_account_id": "1", "public_data": "genesis"}],
+		"validators": [{"pub_key": "` + validator + `", "power": 10, "account_id": "1"}]
+	}`
+	a := app.NewApplication(state.MemoryBackend, "", "")
+	res := a.InitChain(types.RequestInitChain{ChainId: testChainID, AppStateBytes: []byte(genesis)})
+	if len(res.Validators) != 1 || res.Validators[0].Power != 10 {
+		t.Fatalf("validators were not overridden: %+v", res.Validators)
+	}
+	// Genesis account posts payloads before the first block is committed
+	tx, _ := payloadAddTx(t, key, "1", "p1", testChainID, 0).ToBytes()
+	if res := a.CheckTx(tx); res.Code != app.CodeTypeOK {
+		t.Fatalf("tx of genesis account was rejected: %s", res.Log)
+	}
+	// Nonce of genesis account checked in mempool is not changed in deliver state
+	a.BeginBlock(types.RequestBeginBlock{Header: types.Header{ChainID: testChainID, Height: 1, Time: time.Now().Unix()}})
+	if res := a.DeliverTx(tx); res.Code != app.CodeTypeOK {
+		t.Fatalf("checked tx of genesis account was not delivered: %s", res.Log)
+	}
+	a.Commit()
+	query := a.Query(types.RequestQuery{Path: "payloads", Data: []byte("p0")})
+	p := &state.Payload{}
+	if err := json.Unmarshal(query.Value, p); err != nil || p.PublicData != "genesis" {
+		t.Fatalf("genesis payload was not loaded: %s, %v", query.Value, err)
+	}
+
+	// Inconsistent genesis is rejected
+	defer func() {
+		if recover() == nil {
+			t.Fatalf("payload of unknown sender was accepted in genesis")
+		}
+	}()
+	app.NewApplication(state.MemoryBackend, "", "").InitChain(types.RequestInitChain{
+		ChainId:       testChainID,
+		AppStateBytes: []byte(`{"payloads": [{"_id": "p0", "sender_account_id": "2"}]}`),
+	})
+}
+
+func TestValidatorUpdates(t *testing.T) {
+	pubKey := func(b byte) string {
+		pub := make([]byte, 32)
+		pub[0] = b
+		return base64.StdEncoding.EncodeToString(pub)
+	}
+	keys := make(map[string]*crypto.Key)
+	var accounts, validators []string
+	for i, id := range []string{"a", "v1", "v2", "v3", "u"} {
+		keys[id], _ = crypto.CreateKeyPair()
+		roles := `[]`
+		if id == "a" {
+			roles = `["admin"]`
+		}
+		accounts = append(accounts, `{"_id": "`+id+`", "public_key": "`+keys[id].GetPubString()+`", "roles": `+roles+`}`)
+		if id[0] == 'v' {
+			validators = append(validators, `{"pub_key": "`+pubKey(byte(i))+`", "power": 10, "account_id": "`+id+`"}`)
+		}
+	}
+	a := app.NewApplication(state.MemoryBackend, "", "")
+	a.InitChain(types.RequestInitChain{ChainId: testChainID, AppStateBytes: []byte(`{
+		"accounts": [` + strings.Join(accounts, ",") + `],
+		"validators": [` + strings.Join(validators, ",") + `]}`)})
+	a.BeginBlock(types.RequestBeginBlock{Header: types.Header{ChainID: testChainID, Height: 1, Time: time.Now().Unix()}})
+	nonces := make(map[string]uint32)
+	update := func(id, pub string, power int64) types.ResponseDeliverTx {
+		tx, err := client.NewBuilder(keys[id], id, testChainID, nonces[id]).UpdateValidator(pub, power, "")
+		if err != nil {
+			t.Fatalf("%s", err)
+		}
+		bs, _ := tx.ToBytes()
+		res := a.DeliverTx(bs)
+		if res.Code == app.CodeTypeOK {
+			nonces[id]++
+		}
+		return res
+	}
+
+	// Public key of validator should be Ed25519 key
+	for _, pub := range []string{"not base64", base64.StdEncoding.EncodeToString(make([]byte, 31))} {
+		if res := update("a", pub, 5); res.Code != app.CodeTypeDeliverTxError {
+			t.Fatalf("update with invalid public key %q was accepted, code: %d", pub, res.Code)
+		}
+	}
+	// Validators vote for update until 2/3 of power is reached
+	if res := update("u", pubKey(9), 5); res.Code != app.CodeTypeDeliverTxError {
+		t.Fatalf("update of account without rights was accepted, code: %d", res.Code)
+	}
+	for _, id := range []string{"v1", "v2"} {
+		if res := update(id, pubKey(9), 5); res.Code != app.CodeTypeOK {
+			t.Fatalf("vote of %s was not delivered: %s", id, res.Log)
+		}
+	}
+	if res := update("v1", pubKey(9), 5); res.Code != app.CodeTypeDeliverTxError {
+		t.Fatalf("repeated vote was accepted, code: %d", res.Code)
+	}
+	if updates := a.EndBlock(types.RequestEndBlock{}).ValidatorUpdates; len(updates) != 0 {
+		t.Fatalf("update was applied without quorum: %+v", updates)
+	}
+	if res := update("v3", pubKey(9), 5); res.Code != app.CodeTypeOK {
+		t.Fatalf("vote of v3 was not delivered: %s", res.Log)
+	}
+	// Admin updates validators at once
+	if res := update("a", pubKey(1), 0); res.Code != app.CodeTypeOK {
+		t.Fatalf("update of admin was not delivered: %s", res.Log)
+	}
+	if res := update("a", pubKey(8), 0); res.Code != app.CodeTypeDeliverTxError {
+		t.Fatalf("removal of unknown validator was accepted, code: %d", res.Code)
+	}
+	updates := a.EndBlock(types.RequestEndBlock{}).ValidatorUpdates
+	if len(updates) != 2 || updates[0].Power != 5 || updates[1].Power != 0 {
+		t.Fatalf("wrong updates of validators: %+v", updates)
+	}
+	a.Commit()
+	query := a.Query(types.RequestQuery{Path: "validators"})
+	var current []state.Validator
+	if err := json.Unmarshal(query.Value, &current); err != nil || len(current) != 3 {
+		t.Fatalf("wrong validators after commit: %s, %v", query.Value, err)
+	}
+}
+
+func TestValidatorVotesOfOperator(t *testing.T) {
+	pubKey := func(b byte) string {
+		pub := make([]byte, 32)
+		pub[0] = b
+		return base64.StdEncoding.EncodeToString(pub)
+	}
+	key, _ := crypto.CreateKeyPair()
+	other, _ := crypto.CreateKeyPair()
+	// Operator "v1" runs three validators of four
+	a := app.NewApplication(state.MemoryBackend, "", "")
+	a.InitChain(types.RequestInitChain{ChainId: testChainID, AppStateBytes: []byte(`{
+		"accounts": [
+			{"_id": "v1", "public_key": "` + key.GetPubString() + `"},
+			{"_id": "v2", "public_key": "` + other.GetPubString() + `"}],
+		"validators": [
+			{"pub_key": "` + pubKey(1) + `", "power": 10, "account_id": "v1"},
+			{"pub_key": "` + pubKey(2) + `", "power": 10, "account_id": "v1"},
+			{"pub_key": "` + pubKey(3) + `", "power": 10, "account_id": "v1"},
+			{"pub_key": "` + pubKey(4) + `", "power": 10, "account_id": "v2"}]}`)})
+	a.BeginBlock(types.RequestBeginBlock{Header: types.Header{ChainID: testChainID, Height: 1, Time: time.Now().Unix()}})
+
+	tx, err := client.NewBuilder(key, "v1", testChainID, 0).UpdateValidator(pubKey(9), 5, "")
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	bs, _ := tx.ToBytes()
+	if res := a.DeliverTx(bs); res.Code != app.CodeTypeOK {
+		t.Fatalf("vote was not delivered: %s", res.Log)
+	}
+	// Power of all validators of operator is counted
+	if updates := a.EndBlock(types.RequestEndBlock{}).ValidatorUpdates; len(updates) != 1 || updates[0].Power != 5 {
+		t.Fatalf("update was not applied by 3/4 of power: %+v", updates)
+	}
+}
+
+func TestStaleValidatorVotes(t *testing.T) {
+	pubKey := func(b byte) string {
+		pub := make([]byte, 32)
+		pub[0] = b
+		return base64.StdEncoding.EncodeToString(pub)
+	}
+	keys := make(map[string]*crypto.Key)
+	var accounts []string
+	for _, id := range []string{"a", "v1", "v2", "v3"} {
+		keys[id], _ = crypto.CreateKeyPair()
+		accounts = append(accounts, `{"_id": "`+id+`", "public_key": "`+keys[id].GetPubString()+`", "roles": []}`)
+	}
+	accounts[0] = strings.Replace(accounts[0], `[]`, `["admin"]`, 1)
+	a := app.NewApplication(state.MemoryBackend, "", "")
+	a.InitChain(types.RequestInitChain{ChainId: testChainID, AppStateBytes: []byte(`{
+		"accounts": [` + strings.Join(accounts, ",") + `],
+		"validators": [
+			{"pub_key": "` + pubKey(1) + `", "power": 10, "account_id": "v1"},
+			{"pub_key": "` + pubKey(2) + `", "power": 10, "account_id": "v2"},
+			{"pub_key": "` + pubKey(3) + `", "power": 10, "account_id": "v3"}]}`)})
+	a.BeginBlock(types.RequestBeginBlock{Header: types.Header{ChainID: testChainID, Height: 1, Time: time.Now().Unix()}})
+	nonces := make(map[string]uint32)
+	update := func(id, pub string, power int64) {
+		tx, err := client.NewBuilder(keys[id], id, testChainID, nonces[id]).UpdateValidator(pub, power, "")
+		if err != nil {
+			t.Fatalf("%s", err)
+		}
+		bs, _ := tx.ToBytes()
+		if res := a.DeliverTx(bs); res.Code != app.CodeTypeOK {
+			t.Fatalf("update of %s was not delivered: %s", id, res.Log)
+		}
+		nonces[id]++
+	}
+
+	// Vote of v1 is given by power of the previous validators
+	update("v1", pubKey(9), 5)
+	update("a", pubKey(3), 0)
+	update("v2", pubKey(9), 5)
+	if updates := a.EndBlock(types.RequestEndBlock{}).ValidatorUpdates; len(updates) != 1 || updates[0].Power != 0 {
+		t.Fatalf("update was applied by stale vote: %+v", updates)
+	}
+	// Operators vote again for the current validators
+	update("v1", pubKey(9), 5)
+	if updates := a.EndBlock(types.RequestEndBlock{}).ValidatorUpdates; len(updates) != 2 || updates[1].Power != 5 {
+		t.Fatalf("update was not applied by votes of current validators: %+v", updates)
+	}
+}
@@ -0,0 +1,90 @@
+/*
+ * Copyright (C) 2018 eeonevision
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy of
+ * this software and associated documentation files (the "Software"), to deal in
+ * the Software without restriction, including without limitation the rights to
+ * use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+ * the Software, and to permit persons to whom the Software is furnished to do so,
+ * subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+ * FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+ * COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+ * IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+ * CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ */
+
+package app
+
+import (
+	"errors"
+
+	"github.com/eeonevision/anychaindb/state"
+	"github.com/eeonevision/anychaindb/transaction"
+)
+
+// checkValidatorUpdateTransaction function checks that update of validator is
+// signed by admin account or by operator of validator, which votes for it.
+func checkValidatorUpdateTransaction(tx *transaction.Transaction, s *state.State) error {
+	data := &state.ValidatorUpdate{}
+	_, err := data.UnmarshalMsg(tx.Data)
+	if err != nil {
+		return err
+	}
+	// Public key should be valid Ed25519 key to be passed to Tendermint
+	if err := s.CheckValidatorUpdate(data); err != nil {
+		return err
+	}
+	if data.AccountID != "" && !s.HasAccount(data.AccountID) {
+		return errors.New("account of validator does not exist")
+	}
+	signer, err := s.GetAccount(tx.Signer)
+	if err != nil {
+		return errors.New("signer account can't be loaded: " + err.Error())
+	}
+	if !signer.HasRole(state.RoleAdmin) {
+		if s.AccountPower(tx.Signer) == 0 {
+			return errors.New("validators can be updated only by admin or by vote of validators")
+		}
+		if s.HasVoted(data, tx.Signer) {
+			return errors.New("validator already voted for update")
+		}
+	}
+	k, err := s.GetAccountPubKeyAt(tx.Signer, blockHeight(s))
+	if err != nil {
+		return errors.New("pubkey for account can't be loaded: " + err.Error())
+	}
+	if err := tx.Verify(k, s.ChainID()); err != nil {
+		return errors.New("tx can't be verified: " + err.Error())
+	}
+	return nil
+}
+
+// deliverValidatorUpdateTransaction function applies update of admin at once.
+// Update of validator's operator is applied, when validators with more than
+// 2/3 of total power voted for it.
+func deliverValidatorUpdateTransaction(tx *transaction.Transaction, s *state.State) error {
+	data := &state.ValidatorUpdate{}
+	_, err := data.UnmarshalMsg(tx.Data)
+	if err != nil {
+		return err
+	}
+	signer, err := s.GetAccount(tx.Signer)
+	if err != nil {
+		return err
+	}
+	if signer.HasRole(state.RoleAdmin) {
+		err = s.UpdateValidator(data)
+	} else {
+		_, err = s.VoteValidatorUpdate(data, tx.Signer)
+	}
+	if err != nil {
+		return err
+	}
+	return s.IncAccountNonce(tx.Signer)
+}
@@ -56,12 +56,23 @@ func NewHTTPServer(GRPCEndpoint, listenIP, httpPort string) *server {
 	m.GET("/v1/accounts", handler.GetAccountsHandler)
 	m.GET("/v1/accounts/:id", handler.GetAccountDetailsHandler)
 	m.POST("/v1/accounts", handler.PostAccountsHandler)
+	m.POST("/v1/accounts/:id/keys", handler.PostAccountKeysHandler)
 	// Payloads
 	m.GET("/v1/payloads", handler.GetPayloadsHandler)
 	m.GET("/v1/payloads/:id", handler.GetPayloadDetailsHandler)
 	m.POST("/v1/payloads", handler.PostPayloadsHandler)
-
-	http.Handle("/", m)
+	m.PUT("/v1/payloads/:id", handler.PutPayloadHandler)
+	m.GET("/v1/payloads/:id/revisions", handler.GetPayloadRevisionsHandler)
+	m.POST("/v1/payloads/:id/revoke", handler.PostPayloadRevokeHandler)
+	// Authentication
+	m.POST("/v1/auth/challenge", handler.PostAuthChallengeHandler)
+	m.POST("/v1/auth/token", handler.PostAuthTokenHandler)
+	// API keys
+	m.POST("/v1/apikeys", handler.PostAPIKeysHandler)
+	// Transactions
+	m.POST("/v1/transactions", handler.PostTransactionsHandler)
+
+	http.Handle("/", handler.RateLimiter(m))
 
 	return &res
 }
@@ -74,7 +85,7 @@ func (s *server) Serve() {
 	listenString := s.ListenHost + ":" + s.ListenPort
 
 	// subscribe to SIGINT signals
-	stopChan := make(chan os.Signal)
+	stopChan := make(chan os.Signal, 1)
 	signal.Notify(stopChan, os.Interrupt)
 
 	srv := &http.Server{
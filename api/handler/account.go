@@ -27,6 +27,7 @@ import (
 	"strconv"
 
 	"github.com/eeonevision/anychaindb/client"
+	"github.com/eeonevision/anychaindb/crypto"
 	"github.com/julienschmidt/httprouter"
 )
 
@@ -35,13 +36,19 @@ import (
 // ID - unique identifier of account in blockchain
 // Priv - private key of account
 // Pub - public key of account
+// EncPriv - private key of account, which decrypts private data
+// EncPub - public key of account, which encrypts private data
 type Account struct {
-	ID   string `json:"_id"`
-	Priv string `json:"private_key"`
-	Pub  string `json:"public_key"`
+	ID      string `json:"_id"`
+	Priv    string `json:"private_key"`
+	Pub     string `json:"public_key"`
+	EncPriv string `json:"encryption_private_key,omitempty"`
+	EncPub  string `json:"encryption_public_key,omitempty"`
 }
 
-// PostAccountsHandler uses FastAPI for sends new accounts requests in async mode to blockchain
+// PostAccountsHandler uses FastAPI for sends new accounts requests in async mode to blockchain.
+// Accounts with keys derived from mnemonic are registered by transactions, which are
+// built and signed by client, so mnemonic never reaches server.
 func PostAccountsHandler(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
 	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
 	defer r.Body.Close()
@@ -52,8 +59,8 @@ func PostAccountsHandler(w http.ResponseWriter, r *http.Request, _ httprouter.Pa
 	}
 
 	// Add account to blockchain
-	api := client.NewAPI(endpoint, mode, nil, "")
-	id, pub, priv, err := api.CreateAccount()
+	api := client.NewAPI(endpoint, mode, nil, "", keyTypeOptions(r)...)
+	id, pub, priv, encPub, encPriv, err := api.CreateAccount("")
 	if err != nil {
 		writeResult(http.StatusBadRequest, err.Error(), nil, w)
 		return
@@ -61,13 +68,73 @@ func PostAccountsHandler(w http.ResponseWriter, r *http.Request, _ httprouter.Pa
 
 	writeResult(http.StatusAccepted, "Accepted",
 		Account{
-			ID:   id,
-			Priv: priv,
-			Pub:  pub,
+			ID:      id,
+			Priv:    priv,
+			Pub:     pub,
+			EncPriv: encPriv,
+			EncPub:  encPub,
 		}, w)
 	return
 }
 
+// PostAccountKeysHandler uses FastAPI for rotate key of account.
+// Request should be authorized by current key pair of account,
+// new key pairs are generated and returned in response.
+func PostAccountKeysHandler(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	defer r.Body.Close()
+
+	var mode string
+	if m := r.URL.Query().Get("mode"); m != "" {
+		mode = m
+	}
+
+	id := ps.ByName("id")
+	if id == "" {
+		writeResult(http.StatusBadRequest,
+			"ID should not be empty", nil, w)
+		return
+	}
+	var req Request
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeResult(http.StatusBadRequest, "request decode error: "+err.Error(), nil, w)
+		return
+	}
+	key, err := crypto.NewFromStrings(req.PubKey, req.PrivKey)
+	if err != nil {
+		writeResult(http.StatusUnauthorized, err.Error(), nil, w)
+		return
+	}
+
+	// Rotate key of account in blockchain
+	api := client.NewAPI(endpoint, mode, key, id, keyTypeOptions(r)...)
+	pub, priv, encPub, encPriv, err := api.RotateKey()
+	if err != nil {
+		writeResult(http.StatusBadRequest, err.Error(), nil, w)
+		return
+	}
+
+	writeResult(http.StatusAccepted, "Accepted",
+		Account{
+			ID:      id,
+			Priv:    priv,
+			Pub:     pub,
+			EncPriv: encPriv,
+			EncPub:  encPub,
+		}, w)
+	return
+}
+
+// keyTypeOptions function returns client options with type of generated keys,
+// which is requested by key_type query parameter.
+func keyTypeOptions(r *http.Request) []client.Option {
+	opts := append([]client.Option{}, clientOptions...)
+	if t := r.URL.Query().Get("key_type"); t != "" {
+		opts = append(opts, client.WithKeyType(crypto.KeyType(t)))
+	}
+	return opts
+}
+
 // GetAccountsHandler uses BaseAPI for search and list accounts.
 // Query parameters: Query, Limit, Offset can be optional.
 // Query - MongoDB query string.
@@ -106,7 +173,7 @@ func GetAccountsHandler(w http.ResponseWriter, r *http.Request, _ httprouter.Par
 	if offset < 0 {
 		offset = 0
 	}
-	api := client.NewAPI(endpoint, "", nil, "")
+	api := client.NewAPI(endpoint, "", nil, "", clientOptions...)
 	searchReq := mongoQuery{
 		Query:  query,
 		Limit:  limit,
@@ -134,7 +201,7 @@ func GetAccountDetailsHandler(w http.ResponseWriter, r *http.Request, ps httprou
 			"ID should not be empty", nil, w)
 		return
 	}
-	api := client.NewAPI(endpoint, "", nil, "")
+	api := client.NewAPI(endpoint, "", nil, "", clientOptions...)
 	acc, err := api.GetAccount(id)
 
 	// Temporary solution in case of introduce more right way of error handling
@@ -0,0 +1,155 @@
+/*
+ * Copyright (C) 2018 eeonevision
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy of
+ * this software and associated documentation files (the "Software"), to deal in
+ * the Software without restriction, including without limitation the rights to
+ * use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+ * the Software, and to permit persons to whom the Software is furnished to do so,
+ * subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+ * FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+ * COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+ * IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+ * CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ */
+
+package handler
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+// adminKeyHeader is header, which passes admin key for issuance of API keys.
+const adminKeyHeader = "X-Admin-Key"
+
+// APIKey struct keeps fields of API key. Key itself is returned only once on
+// issuance, only its hash is kept by server.
+type APIKey struct {
+	Key       string `json:"key,omitempty"`
+	Name      string `json:"name"`
+	CreatedAt int64  `json:"created_at"`
+}
+
+// keyStore struct keeps hashes of issued API keys and persists them to file.
+type keyStore struct {
+	sync.RWMutex
+	keys     map[string]APIKey
+	path     string
+	adminKey string
+}
+
+var apiKeys = &keyStore{keys: make(map[string]APIKey)}
+
+// SetAdminKey method defines admin key, which authorizes issuance of API keys.
+// Issuance is disabled if admin key is empty.
+func SetAdminKey(key string) {
+	apiKeys.Lock()
+	apiKeys.adminKey = key
+	apiKeys.Unlock()
+}
+
+// LoadAPIKeys method loads issued API keys from file and saves new keys to it.
+// Missing file is created on the first issuance.
+func LoadAPIKeys(path string) error {
+	apiKeys.Lock()
+	defer apiKeys.Unlock()
+	apiKeys.path = path
+	bs, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(bs, &apiKeys.keys)
+}
+
+// valid method checks if API key was issued.
+func (s *keyStore) valid(key string) bool {
+	s.RLock()
+	defer s.RUnlock()
+	_, ok := s.keys[hashAPIKey(key)]
+	return ok
+}
+
+// issue method generates new API key and saves its hash. Key is valid only
+// after it was saved to file, failed issuance leaves no key.
+func (s *keyStore) issue(name string) (APIKey, error) {
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return APIKey{}, err
+	}
+	key := APIKey{Name: name, CreatedAt: time.Now().Unix()}
+	hash := hashAPIKey(base64.RawURLEncoding.EncodeToString(raw))
+
+	s.Lock()
+	defer s.Unlock()
+	s.keys[hash] = key
+	if s.path != "" {
+		bs, err := json.MarshalIndent(s.keys, "", "  ")
+		if err == nil {
+			err = ioutil.WriteFile(s.path, bs, 0600)
+		}
+		if err != nil {
+			delete(s.keys, hash)
+			return APIKey{}, err
+		}
+	}
+	key.Key = base64.RawURLEncoding.EncodeToString(raw)
+	return key, nil
+}
+
+func hashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// PostAPIKeysHandler issues new API key. Request should be authorized by
+// admin key in X-Admin-Key header.
+func PostAPIKeysHandler(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	defer r.Body.Close()
+
+	apiKeys.RLock()
+	adminKey := apiKeys.adminKey
+	apiKeys.RUnlock()
+	if adminKey == "" {
+		writeResult(http.StatusForbidden, "issuance of API keys is disabled", nil, w)
+		return
+	}
+	if subtle.ConstantTimeCompare([]byte(r.Header.Get(adminKeyHeader)), []byte(adminKey)) != 1 {
+		writeResult(http.StatusUnauthorized, "invalid admin key", nil, w)
+		return
+	}
+	var req APIKey
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeResult(http.StatusBadRequest, "request decode error: "+err.Error(), nil, w)
+		return
+	}
+	key, err := apiKeys.issue(req.Name)
+	if err != nil {
+		writeResult(http.StatusInternalServerError, err.Error(), nil, w)
+		return
+	}
+
+	writeResult(http.StatusOK, "OK", key, w)
+	return
+}
@@ -0,0 +1,299 @@
+/*
+ * Copyright (C) 2018 eeonevision
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy of
+ * this software and associated documentation files (the "Software"), to deal in
+ * the Software without restriction, including without limitation the rights to
+ * use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+ * the Software, and to permit persons to whom the Software is furnished to do so,
+ * subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+ * FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+ * COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+ * IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+ * CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ */
+
+package handler
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/eeonevision/anychaindb/client"
+	"github.com/eeonevision/anychaindb/crypto"
+	"github.com/julienschmidt/httprouter"
+)
+
+// Lifetimes of authentication challenges and session tokens.
+const (
+	ChallengeTTL = time.Minute
+	TokenTTL     = 15 * time.Minute
+)
+
+// challengeSize is size of random challenge in bytes.
+const challengeSize = 32
+
+// maxChallenges is maximum number of pending challenges.
+const maxChallenges = 10000
+
+// encryptionKeyHeader is header, which passes private key delegated by
+// token owner for decryption of its private data on server.
+const encryptionKeyHeader = "X-Encryption-Key"
+
+var errTooManyChallenges = errors.New("too many pending challenges, try again later")
+
+var tokenSecret = randomSecret()
+
+// allowBasicAuth enables deprecated basic authorization of reads by private key.
+var allowBasicAuth = true
+
+var challenges = &challengeStore{issued: make(map[string]challenge)}
+
+// challengeStore struct keeps pending challenges by their nonces.
+type challengeStore struct {
+	sync.Mutex
+	issued map[string]challenge
+}
+
+type challenge struct {
+	accountID string
+	expiresAt time.Time
+}
+
+// AuthChallenge struct keeps fields of authentication challenge.
+type AuthChallenge struct {
+	AccountID string `json:"account_id"`
+	Challenge string `json:"challenge,omitempty"`
+	Signature string `json:"signature,omitempty"`
+	ExpiresAt int64  `json:"expires_at,omitempty"`
+}
+
+// AuthToken struct keeps session token and its expiration time in UNIX time.
+type AuthToken struct {
+	Token     string `json:"token"`
+	ExpiresAt int64  `json:"expires_at"`
+}
+
+// tokenClaims struct keeps fields, which are signed in session token.
+type tokenClaims struct {
+	AccountID string `json:"account_id"`
+	ExpiresAt int64  `json:"expires_at"`
+}
+
+// SetTokenSecret method defines secret, which signs session tokens, so tokens
+// are accepted by several REST API servers. Random secret is used by default.
+func SetTokenSecret(secret []byte) {
+	tokenSecret = secret
+}
+
+// SetAllowBasicAuth method enables or disables deprecated basic authorization
+// of reads by account id and private key. It is enabled by default.
+func SetAllowBasicAuth(allow bool) {
+	allowBasicAuth = allow
+}
+
+func randomSecret() []byte {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		panic(err)
+	}
+	return secret
+}
+
+// PostAuthChallengeHandler issues random challenge for account. Challenge
+// should be signed by account key and exchanged to session token once.
+func PostAuthChallengeHandler(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	defer r.Body.Close()
+
+	var req AuthChallenge
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeResult(http.StatusBadRequest, "request decode error: "+err.Error(), nil, w)
+		return
+	}
+	if req.AccountID == "" {
+		writeResult(http.StatusBadRequest, "account id should not be empty", nil, w)
+		return
+	}
+	nonce, c, err := challenges.issue(req.AccountID, time.Now())
+	if err == errTooManyChallenges {
+		writeResult(http.StatusServiceUnavailable, err.Error(), nil, w)
+		return
+	}
+	if err != nil {
+		writeResult(http.StatusInternalServerError, err.Error(), nil, w)
+		return
+	}
+
+	writeResult(http.StatusOK, "OK", AuthChallenge{
+		AccountID: req.AccountID,
+		Challenge: nonce,
+		ExpiresAt: c.expiresAt.Unix(),
+	}, w)
+	return
+}
+
+// PostAuthTokenHandler verifies signature of challenge by the current key of
+// account in blockchain and issues short-lived session token.
+func PostAuthTokenHandler(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	defer r.Body.Close()
+
+	var req AuthChallenge
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeResult(http.StatusBadRequest, "request decode error: "+err.Error(), nil, w)
+		return
+	}
+	// Challenge is used only once
+	if !challenges.take(req.Challenge, req.AccountID, time.Now()) {
+		writeResult(http.StatusUnauthorized, "unknown or expired challenge", nil, w)
+		return
+	}
+
+	api := client.NewAPI(endpoint, "", nil, "", clientOptions...)
+	acc, err := api.GetAccount(req.AccountID)
+	if err != nil {
+		writeResult(http.StatusUnauthorized, "cannot get account: "+err.Error(), nil, w)
+		return
+	}
+	key, err := crypto.NewFromTypedStrings(crypto.KeyType(acc.KeyType), acc.PubKey, "")
+	if err != nil {
+		writeResult(http.StatusInternalServerError, err.Error(), nil, w)
+		return
+	}
+	hash, err := client.ChallengeHash(req.AccountID, req.Challenge)
+	if err != nil {
+		writeResult(http.StatusBadRequest, err.Error(), nil, w)
+		return
+	}
+	if err := key.Verify(hash, req.Signature); err != nil {
+		writeResult(http.StatusUnauthorized, "invalid signature of challenge: "+err.Error(), nil, w)
+		return
+	}
+
+	claims := tokenClaims{AccountID: req.AccountID, ExpiresAt: time.Now().Add(TokenTTL).Unix()}
+	writeResult(http.StatusOK, "OK", AuthToken{Token: signToken(claims), ExpiresAt: claims.ExpiresAt}, w)
+	return
+}
+
+// issue method keeps new random challenge of account and returns its base64
+// encoded nonce. Expired challenges are dropped when store is full.
+func (s *challengeStore) issue(accountID string, now time.Time) (string, challenge, error) {
+	bs := make([]byte, challengeSize)
+	if _, err := rand.Read(bs); err != nil {
+		return "", challenge{}, err
+	}
+	nonce := base64.StdEncoding.EncodeToString(bs)
+	c := challenge{accountID: accountID, expiresAt: now.Add(ChallengeTTL)}
+
+	s.Lock()
+	defer s.Unlock()
+	if len(s.issued) >= maxChallenges {
+		for k, v := range s.issued {
+			if now.After(v.expiresAt) {
+				delete(s.issued, k)
+			}
+		}
+		if len(s.issued) >= maxChallenges {
+			return "", challenge{}, errTooManyChallenges
+		}
+	}
+	s.issued[nonce] = c
+	return nonce, c, nil
+}
+
+// take method removes challenge, so it is verified only once, and reports if
+// it was issued for account and is not expired.
+func (s *challengeStore) take(nonce, accountID string, now time.Time) bool {
+	s.Lock()
+	c, ok := s.issued[nonce]
+	delete(s.issued, nonce)
+	s.Unlock()
+	return ok && c.accountID == accountID && !now.After(c.expiresAt)
+}
+
+// signToken function encodes claims of token and signs them by token secret.
+func signToken(claims tokenClaims) string {
+	bs, _ := json.Marshal(claims)
+	payload := base64.RawURLEncoding.EncodeToString(bs)
+	return payload + "." + base64.RawURLEncoding.EncodeToString(tokenMAC(payload))
+}
+
+func tokenMAC(payload string) []byte {
+	mac := hmac.New(sha256.New, tokenSecret)
+	mac.Write([]byte(payload))
+	return mac.Sum(nil)
+}
+
+// parseToken function checks signature and expiration time of session token
+// and returns account id of its owner.
+func parseToken(token string) (string, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 2 {
+		return "", errors.New("malformed token")
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil || !hmac.Equal(sig, tokenMAC(parts[0])) {
+		return "", errors.New("invalid token signature")
+	}
+	bs, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return "", errors.New("malformed token")
+	}
+	var claims tokenClaims
+	if err := json.Unmarshal(bs, &claims); err != nil {
+		return "", errors.New("malformed token")
+	}
+	if time.Now().Unix() > claims.ExpiresAt {
+		return "", errors.New("token is expired")
+	}
+	return claims.AccountID, nil
+}
+
+// readerCredentials function returns account id and private keys, which decrypt
+// private data of request. Account is authorized by session token in bearer
+// authorization header, its private data is decrypted only if private keys are
+// delegated explicitly in X-Encryption-Key header, otherwise only private data
+// of account is returned encrypted for decryption on client side. Private keys
+// of previous keys of account are passed separated by comma. Basic
+// authorization with private key of account is deprecated and may be disabled
+// by SetAllowBasicAuth.
+func readerCredentials(r *http.Request) (receiverID string, privKeys []string, err error) {
+	auth := r.Header.Get("Authorization")
+	if !strings.HasPrefix(auth, "Bearer ") {
+		id, key, ok := r.BasicAuth()
+		if ok && !allowBasicAuth {
+			return "", nil, errors.New("basic authorization is disabled, use session token")
+		}
+		return id, splitKeys(key), nil
+	}
+	receiverID, err = parseToken(strings.TrimPrefix(auth, "Bearer "))
+	if err != nil {
+		return "", nil, err
+	}
+	return receiverID, splitKeys(strings.Join(r.Header[encryptionKeyHeader], ",")), nil
+}
+
+// splitKeys function splits comma separated list of private keys.
+func splitKeys(s string) (keys []string) {
+	for _, k := range strings.Split(s, ",") {
+		if k = strings.TrimSpace(k); k != "" {
+			keys = append(keys, k)
+		}
+	}
+	return keys
+}
@@ -25,10 +25,14 @@ import (
 	"encoding/json"
 	"errors"
 	"net/http"
+
+	"github.com/eeonevision/anychaindb/client"
 )
 
 var endpoint string
 
+var clientOptions []client.Option
+
 // errNotFound error returned when a document could not be found
 var errNotFound = errors.New("not found")
 
@@ -37,12 +41,14 @@ var errNotFound = errors.New("not found")
 // AccountID - unique identifier of request-maker in blockchain
 // PrivKey - private key of account
 // PubKey - public key of account
+// EncPrivKey - private key of account, which decrypts private data (optional)
 // Data - arbitrary passed data (maybe any supported in system)
 type Request struct {
-	AccountID string      `json:"account_id,omitempty"`
-	PrivKey   string      `json:"private_key,omitempty"`
-	PubKey    string      `json:"public_key,omitempty"`
-	Data      interface{} `json:"data"`
+	AccountID  string      `json:"account_id,omitempty"`
+	PrivKey    string      `json:"private_key,omitempty"`
+	PubKey     string      `json:"public_key,omitempty"`
+	EncPrivKey string      `json:"encryption_private_key,omitempty"`
+	Data       interface{} `json:"data"`
 }
 
 // Result struct represents response from Anychaindb API.
@@ -54,9 +60,10 @@ type Result struct {
 
 // MongoQuery is a struct for parse search query from a user.
 type mongoQuery struct {
-	Query  interface{} `json:"query"`
-	Limit  int         `json:"limit,omitempty"`
-	Offset int         `json:"offset,omitempty"`
+	Query          interface{} `json:"query"`
+	Limit          int         `json:"limit,omitempty"`
+	Offset         int         `json:"offset,omitempty"`
+	IncludeRevoked bool        `json:"include_revoked,omitempty"`
 }
 
 func writeResult(code int, message string, data interface{}, w http.ResponseWriter) {
@@ -73,3 +80,8 @@ func writeResult(code int, message string, data interface{}, w http.ResponseWrit
 func SetEndpoint(addr string) {
 	endpoint = addr
 }
+
+// SetClientOptions method defines options of clients, used by handlers.
+func SetClientOptions(opts ...client.Option) {
+	clientOptions = opts
+}
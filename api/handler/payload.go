@@ -28,6 +28,7 @@ import (
 
 	"github.com/eeonevision/anychaindb/client"
 	"github.com/eeonevision/anychaindb/crypto"
+	"github.com/eeonevision/anychaindb/state"
 	"github.com/julienschmidt/httprouter"
 	"github.com/mitchellh/mapstructure"
 )
@@ -82,7 +83,11 @@ func PostPayloadsHandler(w http.ResponseWriter, r *http.Request, _ httprouter.Pa
 		writeResult(http.StatusUnauthorized, err.Error(), nil, w)
 		return
 	}
-	api := client.NewAPI(endpoint, mode, key, req.AccountID)
+	opts := clientOptions
+	if r.URL.Query().Get("sender_copy") == "true" {
+		opts = append(append([]client.Option{}, clientOptions...), client.WithSenderCopy())
+	}
+	api := client.NewAPI(endpoint, mode, key, req.AccountID, opts...)
 	privMrsh, err := json.Marshal(data.PrivateData)
 	if err != nil {
 		writeResult(http.StatusBadRequest, err.Error(), nil, w)
@@ -137,8 +142,12 @@ func GetPayloadsHandler(w http.ResponseWriter, r *http.Request, _ httprouter.Par
 			return
 		}
 	}
-	// Get basic auth data: receiver's account id and private key
-	re, pk, _ := r.BasicAuth()
+	// Get authorized receiver's account id and private key
+	re, pk, err := readerCredentials(r)
+	if err != nil {
+		writeResult(http.StatusUnauthorized, err.Error(), nil, w)
+		return
+	}
 
 	// Check limits
 	if limit > 500 || limit <= 0 {
@@ -147,11 +156,12 @@ func GetPayloadsHandler(w http.ResponseWriter, r *http.Request, _ httprouter.Par
 	if offset < 0 {
 		offset = 0
 	}
-	api := client.NewAPI(endpoint, "", nil, "")
+	api := client.NewAPI(endpoint, "", nil, "", clientOptions...)
 	searchReq := mongoQuery{
-		Query:  query,
-		Limit:  limit,
-		Offset: offset,
+		Query:          query,
+		Limit:          limit,
+		Offset:         offset,
+		IncludeRevoked: r.URL.Query().Get("include_revoked") == "true",
 	}
 	searchReqStr, _ := json.Marshal(searchReq)
 	cnv, err := api.SearchPayloads(searchReqStr, re, pk)
@@ -165,7 +175,7 @@ func GetPayloadsHandler(w http.ResponseWriter, r *http.Request, _ httprouter.Par
 }
 
 // GetPayloadDetailsHandler uses BaseAPI for get payload details by it id.
-// Query parameters ID is required.
+// Query parameters ID is required, revision and include_revoked are optional.
 func GetPayloadDetailsHandler(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
 
@@ -175,11 +185,26 @@ func GetPayloadDetailsHandler(w http.ResponseWriter, r *http.Request, ps httprou
 			"id should not be empty", nil, w)
 		return
 	}
-	// Get basic auth data: receiver's account id and private key
-	re, pk, _ := r.BasicAuth()
+	// Get authorized receiver's account id and private key
+	re, pk, err := readerCredentials(r)
+	if err != nil {
+		writeResult(http.StatusUnauthorized, err.Error(), nil, w)
+		return
+	}
 
-	api := client.NewAPI(endpoint, "", nil, "")
-	cnv, err := api.GetPayload(id, re, pk)
+	api := client.NewAPI(endpoint, "", nil, "", clientOptions...)
+	var cnv *state.Payload
+	if rev := r.URL.Query().Get("revision"); rev != "" {
+		revision, parseErr := strconv.ParseUint(rev, 10, 32)
+		if parseErr != nil {
+			writeResult(http.StatusBadRequest,
+				"cannot parse revision parameter: "+parseErr.Error(), nil, w)
+			return
+		}
+		cnv, err = api.GetPayloadRevision(id, uint32(revision), re, pk)
+	} else {
+		cnv, err = api.GetPayload(id, re, pk)
+	}
 
 	// Temporary solution in case of introduce more right way of error handling
 	if err != nil {
@@ -191,7 +216,146 @@ func GetPayloadDetailsHandler(w http.ResponseWriter, r *http.Request, ps httprou
 		}
 		return
 	}
+	// Revoked payload is gone unless it is requested explicitly
+	if cnv != nil && cnv.Revoked != nil && r.URL.Query().Get("include_revoked") != "true" {
+		writeResult(http.StatusGone, "payload is revoked: "+cnv.Revoked.Reason, cnv.Revoked, w)
+		return
+	}
 
 	writeResult(http.StatusOK, "OK", cnv, w)
 	return
 }
+
+// PayloadUpdate struct keeps fields of payload update request.
+//   - PublicData replaces public data of payload or is applied as JSON merge patch if MergePatch is set;
+//   - ExpectedRevision is optional revision, which payload should have before update.
+type PayloadUpdate struct {
+	PublicData       interface{} `json:"public_data" mapstructure:"public_data"`
+	MergePatch       bool        `json:"merge_patch" mapstructure:"merge_patch"`
+	ExpectedRevision *uint32     `json:"expected_revision,omitempty" mapstructure:"expected_revision"`
+}
+
+// PutPayloadHandler uses FastAPI for sends payload update requests to blockchain.
+// Only sender of payload can update it.
+func PutPayloadHandler(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	defer r.Body.Close()
+
+	var mode string
+	if m := r.URL.Query().Get("mode"); m != "" {
+		mode = m
+	}
+
+	id := ps.ByName("id")
+	if id == "" {
+		writeResult(http.StatusBadRequest,
+			"id should not be empty", nil, w)
+		return
+	}
+	var req Request
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeResult(http.StatusBadRequest, "request decode error: "+err.Error(), nil, w)
+		return
+	}
+	var data PayloadUpdate
+	if err := mapstructure.Decode(req.Data, &data); err != nil {
+		writeResult(http.StatusBadRequest, "payload update decode error: "+err.Error(), nil, w)
+		return
+	}
+
+	// Update payload in blockchain
+	key, err := crypto.NewFromStrings(req.PubKey, req.PrivKey)
+	if err != nil {
+		writeResult(http.StatusUnauthorized, err.Error(), nil, w)
+		return
+	}
+	api := client.NewAPI(endpoint, mode, key, req.AccountID, clientOptions...)
+	if err := api.UpdatePayload(id, data.PublicData, data.MergePatch, data.ExpectedRevision); err != nil {
+		writeResult(http.StatusBadRequest, err.Error(), nil, w)
+		return
+	}
+
+	writeResult(http.StatusAccepted, "payload updated", Payload{ID: id}, w)
+	return
+}
+
+// GetPayloadRevisionsHandler uses BaseAPI for get history of payload revisions by it id.
+func GetPayloadRevisionsHandler(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+
+	id := ps.ByName("id")
+	if id == "" {
+		writeResult(http.StatusBadRequest,
+			"id should not be empty", nil, w)
+		return
+	}
+	// Get authorized receiver's account id and private key
+	re, pk, err := readerCredentials(r)
+	if err != nil {
+		writeResult(http.StatusUnauthorized, err.Error(), nil, w)
+		return
+	}
+
+	api := client.NewAPI(endpoint, "", nil, "", clientOptions...)
+	revisions, err := api.GetPayloadRevisions(id, re, pk)
+	if err != nil {
+		if err.Error() == errNotFound.Error() {
+			writeResult(http.StatusNotFound, err.Error(), nil, w)
+		} else {
+			writeResult(http.StatusBadRequest, err.Error(), nil, w)
+		}
+		return
+	}
+
+	writeResult(http.StatusOK, "OK", revisions, w)
+	return
+}
+
+// PayloadRevocation struct keeps reason of payload revocation request.
+type PayloadRevocation struct {
+	Reason string `json:"reason" mapstructure:"reason"`
+}
+
+// PostPayloadRevokeHandler uses FastAPI for sends payload revocation requests to blockchain.
+// Only sender of payload can revoke it.
+func PostPayloadRevokeHandler(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	defer r.Body.Close()
+
+	var mode string
+	if m := r.URL.Query().Get("mode"); m != "" {
+		mode = m
+	}
+
+	id := ps.ByName("id")
+	if id == "" {
+		writeResult(http.StatusBadRequest,
+			"id should not be empty", nil, w)
+		return
+	}
+	var req Request
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeResult(http.StatusBadRequest, "request decode error: "+err.Error(), nil, w)
+		return
+	}
+	var data PayloadRevocation
+	if err := mapstructure.Decode(req.Data, &data); err != nil {
+		writeResult(http.StatusBadRequest, "payload revocation decode error: "+err.Error(), nil, w)
+		return
+	}
+
+	// Revoke payload in blockchain
+	key, err := crypto.NewFromStrings(req.PubKey, req.PrivKey)
+	if err != nil {
+		writeResult(http.StatusUnauthorized, err.Error(), nil, w)
+		return
+	}
+	api := client.NewAPI(endpoint, mode, key, req.AccountID, clientOptions...)
+	if err := api.RevokePayload(id, data.Reason); err != nil {
+		writeResult(http.StatusBadRequest, err.Error(), nil, w)
+		return
+	}
+
+	writeResult(http.StatusAccepted, "payload revoked", Payload{ID: id}, w)
+	return
+}
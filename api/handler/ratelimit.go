@@ -0,0 +1,253 @@
+/*
+ * Copyright (C) 2018 eeonevision
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy of
+ * this software and associated documentation files (the "Software"), to deal in
+ * the Software without restriction, including without limitation the rights to
+ * use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+ * the Software, and to permit persons to whom the Software is furnished to do so,
+ * subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+ * FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+ * COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+ * IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+ * CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ */
+
+package handler
+
+import (
+	"errors"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RateLimit struct defines token bucket: Rate tokens per second are added
+// to bucket of Burst size. Zero rate disables limit.
+type RateLimit struct {
+	Rate  float64
+	Burst int
+}
+
+// Limits struct keeps rate limits of requests per API key, per client IP
+// and per account ID.
+type Limits struct {
+	APIKey  RateLimit
+	IP      RateLimit
+	Account RateLimit
+}
+
+// bucket struct keeps state of token bucket.
+type bucket struct {
+	tokens float64
+	last   time.Time
+	limit  RateLimit
+}
+
+// limiter struct keeps buckets of all clients between requests.
+type limiter struct {
+	sync.Mutex
+	read    Limits
+	write   Limits
+	buckets map[string]*bucket
+	sweep   time.Time
+}
+
+// MaxBodySize is the maximum size of request body in bytes.
+const MaxBodySize = 4 << 20
+
+var rateLimiter = &limiter{buckets: make(map[string]*bucket)}
+
+// requireAPIKey defines if write requests are accepted only with valid API key.
+var requireAPIKey bool
+
+// apiKeyHeader is header, which passes API key of request.
+const apiKeyHeader = "X-API-Key"
+
+// SetRateLimits method defines limits of read (GET) and write requests.
+func SetRateLimits(read, write Limits) {
+	rateLimiter.Lock()
+	rateLimiter.read, rateLimiter.write = read, write
+	rateLimiter.Unlock()
+}
+
+// SetRequireAPIKey method defines if write requests require valid API key.
+func SetRequireAPIKey(require bool) {
+	requireAPIKey = require
+}
+
+// ParseLimits function parses limits in format "apikey=50:100,ip=10:20,account=5:10",
+// where every limit is rate per second and burst size.
+func ParseLimits(s string) (Limits, error) {
+	var limits Limits
+	if s == "" {
+		return limits, nil
+	}
+	for _, item := range strings.Split(s, ",") {
+		kv := strings.SplitN(item, "=", 2)
+		if len(kv) != 2 {
+			return limits, errors.New("malformed limit " + item)
+		}
+		params := strings.SplitN(kv[1], ":", 2)
+		rate, err := strconv.ParseFloat(params[0], 64)
+		if err != nil || rate < 0 {
+			return limits, errors.New("malformed rate of limit " + item)
+		}
+		limit := RateLimit{Rate: rate, Burst: int(math.Ceil(rate))}
+		if len(params) == 2 {
+			if limit.Burst, err = strconv.Atoi(params[1]); err != nil || limit.Burst < 1 {
+				return limits, errors.New("malformed burst of limit " + item)
+			}
+		}
+		switch kv[0] {
+		case "apikey":
+			limits.APIKey = limit
+		case "ip":
+			limits.IP = limit
+		case "account":
+			limits.Account = limit
+		default:
+			return limits, errors.New("unknown limit " + kv[0])
+		}
+	}
+	return limits, nil
+}
+
+// RateLimiter function wraps handler by validation of API keys and rate limits.
+// Requests over limits are rejected with 429 status and Retry-After header.
+// Bodies of requests are limited by MaxBodySize.
+func RateLimiter(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Body != nil {
+			r.Body = http.MaxBytesReader(w, r.Body, MaxBodySize)
+		}
+		// Login is limited as read, so it doesn't require API key
+		read := r.Method == http.MethodGet || r.Method == http.MethodHead ||
+			strings.HasPrefix(r.URL.Path, "/v1/auth/")
+		apiKey := r.Header.Get(apiKeyHeader)
+		if apiKey != "" && !apiKeys.valid(apiKey) {
+			w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+			writeResult(http.StatusUnauthorized, "invalid API key", nil, w)
+			return
+		}
+		// Issuance of API keys is authorized by admin key in its handler
+		issuance := r.Method == http.MethodPost && r.URL.Path == "/v1/apikeys"
+		if apiKey == "" && !read && !issuance && requireAPIKey {
+			w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+			writeResult(http.StatusUnauthorized, "API key is required", nil, w)
+			return
+		}
+		if wait, ok := rateLimiter.allow(read, apiKey, clientIP(r), requestAccountID(r), time.Now()); !ok {
+			w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+			writeResult(http.StatusTooManyRequests, "exceeded AnychainDB API limits", nil, w)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// allow method takes token from buckets of API key, IP and account of request.
+// Tokens are taken only if all buckets have them, otherwise the longest wait
+// time is returned.
+func (l *limiter) allow(read bool, apiKey, ip, accountID string, now time.Time) (time.Duration, bool) {
+	l.Lock()
+	defer l.Unlock()
+	limits, prefix := l.write, "w/"
+	if read {
+		limits, prefix = l.read, "r/"
+	}
+	type check struct {
+		key   string
+		limit RateLimit
+	}
+	checks := []check{{"ip/" + ip, limits.IP}}
+	if apiKey != "" {
+		checks = append(checks, check{"key/" + apiKey, limits.APIKey})
+	}
+	if accountID != "" {
+		checks = append(checks, check{"acc/" + accountID, limits.Account})
+	}
+	var wait time.Duration
+	var taken []*bucket
+	for _, c := range checks {
+		if c.limit.Rate <= 0 {
+			continue
+		}
+		b := l.refill(prefix+c.key, c.limit, now)
+		if b.tokens < 1 {
+			if w := time.Duration((1 - b.tokens) / c.limit.Rate * float64(time.Second)); w > wait {
+				wait = w
+			}
+			continue
+		}
+		taken = append(taken, b)
+	}
+	if wait > 0 {
+		return wait, false
+	}
+	for _, b := range taken {
+		b.tokens--
+	}
+	l.cleanup(now)
+	return 0, true
+}
+
+// refill method returns bucket of key with tokens added since its last use.
+func (l *limiter) refill(key string, limit RateLimit, now time.Time) *bucket {
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(limit.Burst), last: now}
+		l.buckets[key] = b
+	}
+	b.tokens = math.Min(float64(limit.Burst), b.tokens+now.Sub(b.last).Seconds()*limit.Rate)
+	b.last = now
+	b.limit = limit
+	return b
+}
+
+// cleanup method drops buckets once a minute, whose taken tokens were added
+// back by their rate since the last use. They are full, so dropping doesn't
+// change limits, while buckets of slow rates are kept until they are refilled.
+func (l *limiter) cleanup(now time.Time) {
+	if now.Sub(l.sweep) < time.Minute {
+		return
+	}
+	l.sweep = now
+	for k, b := range l.buckets {
+		if b.tokens+now.Sub(b.last).Seconds()*b.limit.Rate >= float64(b.limit.Burst) {
+			delete(l.buckets, k)
+		}
+	}
+}
+
+// clientIP function returns IP address of request's client.
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// requestAccountID function returns account ID of request from session token.
+// Account ID isn't taken from unverified fields of request, otherwise anyone
+// would drain limits of other accounts.
+func requestAccountID(r *http.Request) string {
+	auth := r.Header.Get("Authorization")
+	if !strings.HasPrefix(auth, "Bearer ") {
+		return ""
+	}
+	id, _ := parseToken(strings.TrimPrefix(auth, "Bearer "))
+	return id
+}
@@ -0,0 +1,82 @@
+/*
+ * Copyright (C) 2018 eeonevision
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy of
+ * this software and associated documentation files (the "Software"), to deal in
+ * the Software without restriction, including without limitation the rights to
+ * use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+ * the Software, and to permit persons to whom the Software is furnished to do so,
+ * subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+ * FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+ * COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+ * IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+ * CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ */
+
+package handler
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"mime"
+	"net/http"
+
+	"github.com/eeonevision/anychaindb/client"
+	"github.com/eeonevision/anychaindb/transaction"
+	"github.com/julienschmidt/httprouter"
+)
+
+// Transaction struct keeps hash of broadcasted transaction.
+type Transaction struct {
+	Hash string `json:"hash"`
+}
+
+// PostTransactionsHandler uses FastAPI for broadcast transaction, which is built
+// and signed by client, e.g. by client.Builder, so private keys never reach the server.
+// Transaction is decoded from msgpack if request has application/msgpack content type
+// and from JSON otherwise.
+func PostTransactionsHandler(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	defer r.Body.Close()
+
+	var mode string
+	if m := r.URL.Query().Get("mode"); m != "" {
+		mode = m
+	}
+
+	var tx transaction.Transaction
+	contentType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	switch contentType {
+	case "application/msgpack", "application/x-msgpack":
+		bs, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			writeResult(http.StatusBadRequest, "request read error: "+err.Error(), nil, w)
+			return
+		}
+		if err := tx.FromBytes(bs); err != nil {
+			writeResult(http.StatusBadRequest, "transaction decode error: "+err.Error(), nil, w)
+			return
+		}
+	default:
+		if err := json.NewDecoder(r.Body).Decode(&tx); err != nil {
+			writeResult(http.StatusBadRequest, "transaction decode error: "+err.Error(), nil, w)
+			return
+		}
+	}
+
+	api := client.NewAPI(endpoint, mode, nil, "", clientOptions...)
+	hash, err := api.BroadcastTransaction(&tx)
+	if err != nil {
+		writeResult(http.StatusBadRequest, err.Error(), nil, w)
+		return
+	}
+
+	writeResult(http.StatusAccepted, "transaction accepted", Transaction{Hash: hash}, w)
+	return
+}
@@ -0,0 +1,279 @@
+/*
+ * Copyright (C) 2018 eeonevision
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy of
+ * this software and associated documentation files (the "Software"), to deal in
+ * the Software without restriction, including without limitation the rights to
+ * use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+ * the Software, and to permit persons to whom the Software is furnished to do so,
+ * subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+ * FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+ * COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+ * IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+ * CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ */
+package tests
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	app "github.com/eeonevision/anychaindb/abci-app"
+	"github.com/eeonevision/anychaindb/api/handler"
+	"github.com/eeonevision/anychaindb/client"
+	"github.com/eeonevision/anychaindb/crypto"
+	"github.com/eeonevision/anychaindb/state"
+	"github.com/eeonevision/anychaindb/transaction"
+	"github.com/julienschmidt/httprouter"
+	"github.com/tendermint/tendermint/abci/types"
+)
+
+const testChainID = "test-chain"
+
+// newTestNode function starts RPC server, which answers ABCI queries of
+// handlers by application.
+func newTestNode(t *testing.T, a *app.Application) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Method string `json:"method"`
+			Params struct {
+				Path string `json:"path"`
+				Data string `json:"data"`
+			} `json:"params"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Method != "abci_query" {
+			t.Errorf("unexpected RPC request %s: %v", req.Method, err)
+			return
+		}
+		data, _ := hex.DecodeString(req.Params.Data)
+		res, _ := json.Marshal(map[string]interface{}{
+			"response": a.Query(types.RequestQuery{Path: req.Params.Path, Data: data}),
+		})
+		fmt.Fprintf(w, `{"jsonrpc":"2.0","id":"anything","result":%s}`, res)
+	}))
+}
+
+func deliverTx(t *testing.T, a *app.Application, tx *transaction.Transaction, err error) {
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	bs, err := tx.ToBytes()
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	if res := a.DeliverTx(bs); res.Code != app.CodeTypeOK {
+		t.Fatalf("%s tx was not delivered: %s", tx.Type, res.Log)
+	}
+}
+
+func doAuthRequest(srv http.Handler, method, url string, body interface{}, header http.Header) (int, handler.Result) {
+	bs, _ := json.Marshal(body)
+	req := httptest.NewRequest(method, url, bytes.NewReader(bs))
+	for k := range header {
+		req.Header.Set(k, header.Get(k))
+	}
+	rec := httptest.NewRecorder()
+	srv.ServeHTTP(rec, req)
+	var res handler.Result
+	json.Unmarshal(rec.Body.Bytes(), &res)
+	return rec.Code, res
+}
+
+func TestAuthFlow(t *testing.T) {
+	a := app.NewApplication(state.MemoryBackend, "", "")
+	a.InitChain(types.RequestInitChain{ChainId: testChainID})
+	a.BeginBlock(types.RequestBeginBlock{Header: types.Header{ChainID: testChainID, Time: time.Now().Unix()}})
+	keys := make(map[string]*crypto.Key)
+	accounts := make(map[string]*state.Account)
+	for _, id := range []string{"1", "2", "3"} {
+		keys[id], _ = crypto.CreateKeyPair()
+		accounts[id] = &state.Account{ID: id, PubKey: keys[id].GetPubString(), KeyType: string(keys[id].Type())}
+		tx, err := client.NewBuilder(keys[id], id, testChainID, 0).AddAccount(accounts[id])
+		deliverTx(t, a, tx, err)
+	}
+	privData := []*state.PrivateData{
+		{ReceiverAccountID: "2", Data: "secret of 2"},
+		{ReceiverAccountID: "3", Data: "secret of 3"},
+	}
+	tx, err := client.NewBuilder(keys["1"], "1", testChainID, 0).AddPayload("p1", "public", privData,
+		[]*state.Account{accounts["2"], accounts["3"]})
+	deliverTx(t, a, tx, err)
+	a.Commit()
+
+	node := newTestNode(t, a)
+	defer node.Close()
+	handler.SetEndpoint(node.URL)
+	handler.SetTokenSecret([]byte("test secret"))
+	router := httprouter.New()
+	router.POST("/v1/auth/challenge", handler.PostAuthChallengeHandler)
+	router.POST("/v1/auth/token", handler.PostAuthTokenHandler)
+	router.GET("/v1/payloads/:id", handler.GetPayloadDetailsHandler)
+
+	// Challenge is signed by account key and exchanged to token
+	code, res := doAuthRequest(router, "POST", "/v1/auth/challenge", handler.AuthChallenge{AccountID: "2"}, nil)
+	if code != http.StatusOK {
+		t.Fatalf("challenge was not issued: %d %s", code, res.Msg)
+	}
+	challenge := res.Data.(map[string]interface{})["challenge"].(string)
+	sig, err := client.SignChallenge(keys["2"], "2", challenge)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	signed := handler.AuthChallenge{AccountID: "2", Challenge: challenge, Signature: sig}
+	code, res = doAuthRequest(router, "POST", "/v1/auth/token", signed, nil)
+	if code != http.StatusOK {
+		t.Fatalf("token was not issued: %d %s", code, res.Msg)
+	}
+	token := res.Data.(map[string]interface{})["token"].(string)
+
+	// Used challenge is not accepted again
+	if code, _ := doAuthRequest(router, "POST", "/v1/auth/token", signed, nil); code != http.StatusUnauthorized {
+		t.Fatalf("used challenge was accepted: %d", code)
+	}
+	// Challenge signed by key of other account is rejected
+	code, res = doAuthRequest(router, "POST", "/v1/auth/challenge", handler.AuthChallenge{AccountID: "2"}, nil)
+	challenge = res.Data.(map[string]interface{})["challenge"].(string)
+	sig, _ = client.SignChallenge(keys["3"], "2", challenge)
+	forged := handler.AuthChallenge{AccountID: "2", Challenge: challenge, Signature: sig}
+	if code, _ := doAuthRequest(router, "POST", "/v1/auth/token", forged, nil); code != http.StatusUnauthorized {
+		t.Fatalf("challenge signed by other account was accepted: %d", code)
+	}
+
+	// Token authorizes reading of own private data, which is returned encrypted
+	bearer := http.Header{"Authorization": {"Bearer " + token}}
+	code, res = doAuthRequest(router, "GET", "/v1/payloads/p1", nil, bearer)
+	if code != http.StatusOK {
+		t.Fatalf("authorized read failed: %d %s", code, res.Msg)
+	}
+	entries := res.Data.(map[string]interface{})["private_data"].([]interface{})
+	if len(entries) != 1 || entries[0].(map[string]interface{})["receiver_account_id"] != "2" {
+		t.Fatalf("private data is not scoped to token account: %v", entries)
+	}
+	if data := entries[0].(map[string]interface{})["data"]; data == "secret of 2" {
+		t.Fatalf("private data is decrypted without delegated key")
+	}
+	// Delegated key decrypts private data
+	bearer.Set("X-Encryption-Key", keys["2"].GetPrivString())
+	code, res = doAuthRequest(router, "GET", "/v1/payloads/p1", nil, bearer)
+	if code != http.StatusOK {
+		t.Fatalf("authorized read failed: %d %s", code, res.Msg)
+	}
+	entries = res.Data.(map[string]interface{})["private_data"].([]interface{})
+	if data := entries[0].(map[string]interface{})["data"]; data != "secret of 2" {
+		t.Fatalf("private data was not decrypted: %v", data)
+	}
+
+	// Expired and tampered tokens are rejected
+	claims, _ := json.Marshal(map[string]interface{}{"account_id": "2", "expires_at": time.Now().Add(-time.Second).Unix()})
+	payload := base64.RawURLEncoding.EncodeToString(claims)
+	mac := hmac.New(sha256.New, []byte("test secret"))
+	mac.Write([]byte(payload))
+	expired := payload + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+	tampered := base64.RawURLEncoding.EncodeToString([]byte(`{"account_id":"3","expires_at":9999999999}`)) + token[len(payload):]
+	for _, tok := range []string{expired, tampered} {
+		header := http.Header{"Authorization": {"Bearer " + tok}}
+		if code, _ := doAuthRequest(router, "GET", "/v1/payloads/p1", nil, header); code != http.StatusUnauthorized {
+			t.Fatalf("invalid token %s was accepted: %d", tok, code)
+		}
+	}
+
+	// Basic authorization is rejected when it is disabled
+	handler.SetAllowBasicAuth(false)
+	defer handler.SetAllowBasicAuth(true)
+	req := httptest.NewRequest("GET", "/v1/payloads/p1", nil)
+	req.SetBasicAuth("2", keys["2"].GetPrivString())
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	if rec.Code != http.StatusUnauthorized {
+		t.Fatalf("basic authorization was accepted: %d", rec.Code)
+	}
+}
+
+func TestRotatedKeysDecryption(t *testing.T) {
+	a := app.NewApplication(state.MemoryBackend, "", "")
+	a.InitChain(types.RequestInitChain{ChainId: testChainID})
+	a.BeginBlock(types.RequestBeginBlock{Header: types.Header{ChainID: testChainID, Time: time.Now().Unix()}})
+	sender, _ := crypto.CreateKeyPair()
+	oldKey, _ := crypto.CreateKeyPair()
+	newKey, _ := crypto.CreateKeyPair()
+	senderAcc := &state.Account{ID: "1", PubKey: sender.GetPubString(), KeyType: string(sender.Type())}
+	receiver := &state.Account{ID: "2", PubKey: oldKey.GetPubString(), KeyType: string(oldKey.Type())}
+	tx, err := client.NewBuilder(sender, "1", testChainID, 0).AddAccount(senderAcc)
+	deliverTx(t, a, tx, err)
+	tx, err = client.NewBuilder(oldKey, "2", testChainID, 0).AddAccount(receiver)
+	deliverTx(t, a, tx, err)
+	b := client.NewBuilder(sender, "1", testChainID, 0)
+	tx, err = b.AddPayload("old", "public", []*state.PrivateData{{ReceiverAccountID: "2", Data: "old secret"}},
+		[]*state.Account{receiver})
+	deliverTx(t, a, tx, err)
+	// Data of the next payload is encrypted by rotated key
+	tx, err = client.NewBuilder(oldKey, "2", testChainID, 0).RotateKey(newKey, nil)
+	deliverTx(t, a, tx, err)
+	rotated := &state.Account{ID: "2", PubKey: newKey.GetPubString(), KeyType: string(newKey.Type())}
+	tx, err = b.AddPayload("new", "public", []*state.PrivateData{{ReceiverAccountID: "2", Data: "new secret"}},
+		[]*state.Account{rotated})
+	deliverTx(t, a, tx, err)
+	a.Commit()
+
+	node := newTestNode(t, a)
+	defer node.Close()
+	handler.SetEndpoint(node.URL)
+	handler.SetTokenSecret([]byte("test secret"))
+	router := httprouter.New()
+	router.POST("/v1/auth/challenge", handler.PostAuthChallengeHandler)
+	router.POST("/v1/auth/token", handler.PostAuthTokenHandler)
+	router.GET("/v1/payloads", handler.GetPayloadsHandler)
+
+	_, res := doAuthRequest(router, "POST", "/v1/auth/challenge", handler.AuthChallenge{AccountID: "2"}, nil)
+	challenge := res.Data.(map[string]interface{})["challenge"].(string)
+	sig, _ := client.SignChallenge(newKey, "2", challenge)
+	code, res := doAuthRequest(router, "POST", "/v1/auth/token", handler.AuthChallenge{AccountID: "2", Challenge: challenge, Signature: sig}, nil)
+	if code != http.StatusOK {
+		t.Fatalf("token was not issued: %d %s", code, res.Msg)
+	}
+	bearer := http.Header{"Authorization": {"Bearer " + res.Data.(map[string]interface{})["token"].(string)}}
+
+	search := func(keys string) map[string]interface{} {
+		bearer.Set("X-Encryption-Key", keys)
+		code, res := doAuthRequest(router, "GET", "/v1/payloads", nil, bearer)
+		if code != http.StatusOK {
+			t.Fatalf("search with keys failed: %d %s", code, res.Msg)
+		}
+		data := make(map[string]interface{})
+		for _, p := range res.Data.([]interface{}) {
+			p := p.(map[string]interface{})
+			data[p["_id"].(string)] = p["private_data"].([]interface{})[0].(map[string]interface{})["data"]
+		}
+		return data
+	}
+	// Data encrypted by every key of account is decrypted by its private keys
+	data := search(newKey.GetPrivString() + "," + oldKey.GetPrivString())
+	if data["old"] != "old secret" || data["new"] != "new secret" {
+		t.Errorf("data of rotated keys was not decrypted: %v", data)
+	}
+	// Data of missing key is left encrypted and does not fail the search
+	data = search(newKey.GetPrivString())
+	if data["old"] == "old secret" || data["new"] != "new secret" {
+		t.Errorf("wrong data without previous key: %v", data)
+	}
+	// Keys of other account are rejected
+	bearer.Set("X-Encryption-Key", sender.GetPrivString())
+	if code, _ := doAuthRequest(router, "GET", "/v1/payloads", nil, bearer); code == http.StatusOK {
+		t.Errorf("private key of other account was accepted")
+	}
+}
@@ -353,7 +353,11 @@ func TestGetDecryptedPayload(t *testing.T) {
 	}
 	endpoint = endpoint + "/" + cnv1.ID
 	// Find payload in Anychaindb server
-	contents, err := doGETRequest(endpoint, url, acc1.ID, acc1.Priv)
+	privKey := acc1.Priv
+	if acc1.EncPriv != "" {
+		privKey = acc1.EncPriv
+	}
+	contents, err := doGETRequest(endpoint, url, acc1.ID, privKey)
 	if err != nil {
 		t.Errorf("error in sending GET request: %s", contents)
 		return
@@ -0,0 +1,138 @@
+/*
+ * Copyright (C) 2018 eeonevision
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy of
+ * this software and associated documentation files (the "Software"), to deal in
+ * the Software without restriction, including without limitation the rights to
+ * use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+ * the Software, and to permit persons to whom the Software is furnished to do so,
+ * subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+ * FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+ * COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+ * IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+ * CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ */
+package tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/eeonevision/anychaindb/api/handler"
+)
+
+func TestRateLimiter(t *testing.T) {
+	handler.SetRateLimits(
+		handler.Limits{IP: handler.RateLimit{Rate: 1, Burst: 2}},
+		handler.Limits{Account: handler.RateLimit{Rate: 0.5, Burst: 1}},
+	)
+	defer handler.SetRateLimits(handler.Limits{}, handler.Limits{})
+	srv := handler.RateLimiter(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	do := func(method, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, "/v1/payloads", bytes.NewBufferString(body))
+		rec := httptest.NewRecorder()
+		srv.ServeHTTP(rec, req)
+		return rec
+	}
+	// Burst of reads per IP
+	for i := 0; i < 2; i++ {
+		if rec := do("GET", ""); rec.Code != http.StatusOK {
+			t.Fatalf("read %d was rejected: %d", i, rec.Code)
+		}
+	}
+	rec := do("GET", "")
+	if rec.Code != http.StatusTooManyRequests || rec.Header().Get("Retry-After") != "1" {
+		t.Fatalf("read over limit was not rejected: %d, retry after %q", rec.Code, rec.Header().Get("Retry-After"))
+	}
+	// Claimed account of request doesn't take tokens of account
+	for i := 0; i < 2; i++ {
+		if rec := do("POST", `{"account_id":"1"}`); rec.Code != http.StatusOK {
+			t.Fatalf("write %d of unauthenticated account was rejected: %d", i, rec.Code)
+		}
+	}
+	// Writes without API key are rejected, admin key doesn't replace it
+	handler.SetRequireAPIKey(true)
+	defer handler.SetRequireAPIKey(false)
+	req := httptest.NewRequest("POST", "/v1/accounts", nil)
+	req.Header.Set("X-Admin-Key", "x")
+	rec = httptest.NewRecorder()
+	srv.ServeHTTP(rec, req)
+	if rec.Code != http.StatusUnauthorized {
+		t.Fatalf("write with bogus admin key was accepted: %d", rec.Code)
+	}
+	// Unknown API key is rejected
+	req = httptest.NewRequest("GET", "/v1/payloads", nil)
+	req.Header.Set("X-API-Key", "unknown")
+	rec = httptest.NewRecorder()
+	srv.ServeHTTP(rec, req)
+	if rec.Code != http.StatusUnauthorized {
+		t.Fatalf("unknown API key was accepted: %d", rec.Code)
+	}
+}
+
+func TestRateLimiterBodySize(t *testing.T) {
+	srv := handler.RateLimiter(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, err := ioutil.ReadAll(r.Body); err != nil {
+			w.WriteHeader(http.StatusRequestEntityTooLarge)
+		}
+	}))
+	for size, code := range map[int]int{
+		handler.MaxBodySize:     http.StatusOK,
+		handler.MaxBodySize + 1: http.StatusRequestEntityTooLarge,
+	} {
+		req := httptest.NewRequest("POST", "/v1/payloads", bytes.NewReader(make([]byte, size)))
+		rec := httptest.NewRecorder()
+		srv.ServeHTTP(rec, req)
+		if rec.Code != code {
+			t.Fatalf("body of %d bytes: expected status %d, got %d", size, code, rec.Code)
+		}
+	}
+}
+
+func TestAPIKeyIssuance(t *testing.T) {
+	dir, err := ioutil.TempDir("", "apikeys")
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	defer os.RemoveAll(dir)
+	handler.SetAdminKey("admin")
+	defer handler.SetAdminKey("")
+	issue := func() int {
+		req := httptest.NewRequest("POST", "/v1/apikeys", bytes.NewReader([]byte(`{"name": "test"}`)))
+		req.Header.Set("X-Admin-Key", "admin")
+		rec := httptest.NewRecorder()
+		handler.PostAPIKeysHandler(rec, req, nil)
+		return rec.Code
+	}
+	// Key, which was not saved, is not issued
+	if err := handler.LoadAPIKeys(filepath.Join(dir, "missing", "keys.json")); err != nil {
+		t.Fatalf("%s", err)
+	}
+	if code := issue(); code != http.StatusInternalServerError {
+		t.Fatalf("key was issued without saving: %d", code)
+	}
+	path := filepath.Join(dir, "keys.json")
+	if err := handler.LoadAPIKeys(path); err != nil {
+		t.Fatalf("%s", err)
+	}
+	if code := issue(); code != http.StatusOK {
+		t.Fatalf("key was not issued: %d", code)
+	}
+	bs, _ := ioutil.ReadFile(path)
+	keys := make(map[string]interface{})
+	if err := json.Unmarshal(bs, &keys); err != nil || len(keys) != 1 {
+		t.Errorf("wrong saved keys: %s", bs)
+	}
+}
@@ -0,0 +1,71 @@
+/*
+ * Copyright (C) 2018 eeonevision
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy of
+ * this software and associated documentation files (the "Software"), to deal in
+ * the Software without restriction, including without limitation the rights to
+ * use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+ * the Software, and to permit persons to whom the Software is furnished to do so,
+ * subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+ * FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+ * COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+ * IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+ * CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ */
+package tests
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	app "github.com/eeonevision/anychaindb/abci-app"
+	"github.com/eeonevision/anychaindb/api/handler"
+	"github.com/eeonevision/anychaindb/client"
+	"github.com/eeonevision/anychaindb/crypto"
+	"github.com/eeonevision/anychaindb/state"
+	"github.com/julienschmidt/httprouter"
+	"github.com/tendermint/tendermint/abci/types"
+)
+
+func TestRevokedPayloadGone(t *testing.T) {
+	a := app.NewApplication(state.MemoryBackend, "", "")
+	a.InitChain(types.RequestInitChain{ChainId: testChainID})
+	a.BeginBlock(types.RequestBeginBlock{Header: types.Header{ChainID: testChainID, Time: time.Now().Unix()}})
+	key, _ := crypto.CreateKeyPair()
+	b := client.NewBuilder(key, "1", testChainID, 0)
+	tx, err := b.AddAccount(&state.Account{ID: "1", PubKey: key.GetPubString(), KeyType: string(key.Type())})
+	deliverTx(t, a, tx, err)
+	tx, err = b.AddPayload("p1", "public", nil, nil)
+	deliverTx(t, a, tx, err)
+	tx, err = b.RevokePayload("p1", "posted by mistake")
+	deliverTx(t, a, tx, err)
+	a.Commit()
+
+	node := newTestNode(t, a)
+	defer node.Close()
+	handler.SetEndpoint(node.URL)
+	router := httprouter.New()
+	router.GET("/v1/payloads/:id", handler.GetPayloadDetailsHandler)
+
+	code, res := doAuthRequest(router, "GET", "/v1/payloads/p1", nil, nil)
+	if code != http.StatusGone {
+		t.Fatalf("revoked payload is not gone: %d %s", code, res.Msg)
+	}
+	if reason := res.Data.(map[string]interface{})["reason"]; reason != "posted by mistake" {
+		t.Errorf("revocation is not returned: %v", res.Data)
+	}
+	// Revoked payload and its previous revision are returned on request
+	if code, res := doAuthRequest(router, "GET", "/v1/payloads/p1?include_revoked=true", nil, nil); code != http.StatusOK {
+		t.Errorf("revoked payload was not included: %d %s", code, res.Msg)
+	}
+	if code, res := doAuthRequest(router, "GET", "/v1/payloads/p1?revision=0", nil, nil); code != http.StatusOK {
+		t.Errorf("revision before revocation is not returned: %d %s", code, res.Msg)
+	}
+}
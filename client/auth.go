@@ -0,0 +1,58 @@
+/*
+ * Copyright (C) 2018 eeonevision
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy of
+ * this software and associated documentation files (the "Software"), to deal in
+ * the Software without restriction, including without limitation the rights to
+ * use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+ * the Software, and to permit persons to whom the Software is furnished to do so,
+ * subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+ * FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+ * COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+ * IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+ * CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ */
+
+package client
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+
+	"github.com/eeonevision/anychaindb/crypto"
+)
+
+// challengeDomain separates signatures of authentication challenges from
+// signatures of transactions.
+const challengeDomain = "anychaindb/auth/v1"
+
+// ChallengeHash function returns hash of authentication challenge, issued
+// by REST API for account. Hash is signed by account key on login.
+func ChallengeHash(accountID, challenge string) ([]byte, error) {
+	nonce, err := base64.StdEncoding.DecodeString(challenge)
+	if err != nil {
+		return nil, errors.New("malformed challenge: " + err.Error())
+	}
+	hash := sha256.New()
+	hash.Write([]byte(challengeDomain))
+	hash.Write([]byte(accountID))
+	hash.Write([]byte{0})
+	hash.Write(nonce)
+	return hash.Sum(nil), nil
+}
+
+// SignChallenge function signs authentication challenge of account by its key.
+func SignChallenge(key *crypto.Key, accountID, challenge string) (string, error) {
+	hash, err := ChallengeHash(accountID, challenge)
+	if err != nil {
+		return "", err
+	}
+	return key.Sign(hash)
+}
@@ -64,6 +64,25 @@ func newHTTPClient(endpoint, mode string, key *crypto.Key, accountID string) *ba
 	return &baseClient{key, endpoint, mode, accountID, tm}
 }
 
+// signTx method sets the next nonce of account to transaction and signs it.
+func (c *baseClient) signTx(tx *transaction.Transaction) error {
+	status, err := c.tm.Status()
+	if err != nil {
+		return err
+	}
+	resp, err := c.tm.ABCIQuery("accounts/nonce", []byte(tx.Signer))
+	if err != nil {
+		return err
+	}
+	if resp.Response.IsErr() {
+		return errors.New(resp.Response.GetLog())
+	}
+	if err := json.Unmarshal(resp.Response.GetValue(), &tx.Nonce); err != nil {
+		return err
+	}
+	return tx.Sign(c.key, status.NodeInfo.Network)
+}
+
 func (c *baseClient) addAccount(acc *state.Account) error {
 	var err error
 
@@ -71,7 +90,15 @@ func (c *baseClient) addAccount(acc *state.Account) error {
 	if err != nil {
 		return err
 	}
-	tx := transaction.New(transaction.AccountAdd, c.accountID, txBytes)
+	// Account is signed by its own key to prove possession of it
+	tx := transaction.New(transaction.AccountAdd, acc.ID, txBytes)
+	status, err := c.tm.Status()
+	if err != nil {
+		return err
+	}
+	if err := tx.Sign(c.key, status.NodeInfo.Network); err != nil {
+		return err
+	}
 	bs, _ := tx.ToBytes()
 
 	return c.broadcastTx(bs)
@@ -119,7 +146,7 @@ func (c *baseClient) addPayload(cv *state.Payload) error {
 		return err
 	}
 	tx := transaction.New(transaction.PayloadAdd, c.accountID, txBytes)
-	if err := tx.Sign(c.key); err != nil {
+	if err := c.signTx(tx); err != nil {
 		return err
 	}
 	bs, _ := tx.ToBytes()
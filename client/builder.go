@@ -0,0 +1,303 @@
+/*
+ * Copyright (C) 2018 eeonevision
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy of
+ * this software and associated documentation files (the "Software"), to deal in
+ * the Software without restriction, including without limitation the rights to
+ * use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+ * the Software, and to permit persons to whom the Software is furnished to do so,
+ * subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+ * FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+ * COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+ * IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+ * CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ */
+
+package client
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/eeonevision/anychaindb/crypto"
+	"github.com/eeonevision/anychaindb/state"
+	"github.com/eeonevision/anychaindb/transaction"
+)
+
+// Builder builds signed transactions of account offline, so private keys
+// never leave the process. Built transactions can be posted to the
+// POST /v1/transactions endpoint of REST API or broadcasted to the node.
+// Every signed transaction takes the next nonce of account.
+type Builder struct {
+	key       *crypto.Key
+	accountID string
+	chainID   string
+	nonce     uint32
+}
+
+// NewBuilder constructs builder of transactions, signed by key of account
+// for given chain. Nonce is the next nonce of account, see GetNextNonce.
+func NewBuilder(key *crypto.Key, accountID, chainID string, nonce uint32) *Builder {
+	return &Builder{key, accountID, chainID, nonce}
+}
+
+// Nonce method returns nonce of the next transaction.
+func (b *Builder) Nonce() uint32 {
+	return b.nonce
+}
+
+// AddAccount method builds transaction of new account, which is signed
+// by key of builder as proof of its possession.
+func (b *Builder) AddAccount(acc *state.Account) (*transaction.Transaction, error) {
+	data, err := acc.MarshalMsg(nil)
+	if err != nil {
+		return nil, err
+	}
+	tx := transaction.New(transaction.AccountAdd, acc.ID, data)
+	if err := tx.Sign(b.key, b.chainID); err != nil {
+		return nil, err
+	}
+	return tx, nil
+}
+
+// Register method co-signs new account by key of builder, so account is
+// admitted by chain, which accepts accounts of whitelisted registrars.
+func (b *Builder) Register(acc *state.Account) error {
+	acc.Registrar = b.accountID
+	sig, err := b.key.Sign(acc.AdmissionHash(b.chainID))
+	if err != nil {
+		return err
+	}
+	acc.RegistrarSignature = sig
+	return nil
+}
+
+// SolveProofOfWork function finds work nonce of account, so its proof-of-work
+// hash has given number of leading zero bits. It takes 2^difficulty hashes
+// on average.
+func SolveProofOfWork(acc *state.Account, chainID string, difficulty uint32) {
+	acc.WorkNonce = 0
+	for acc.WorkBits(chainID) < int(difficulty) {
+		acc.WorkNonce++
+	}
+}
+
+// AddPayload method encrypts private data for receivers and builds transaction
+// of new payload. Receivers should contain accounts of all receivers of private
+// data, their encryption keys are used.
+func (b *Builder) AddPayload(id string, publicData interface{}, privateData []*state.PrivateData, receivers []*state.Account) (*transaction.Transaction, error) {
+	accounts := make(map[string]*state.Account)
+	for _, acc := range receivers {
+		accounts[acc.ID] = acc
+	}
+	envelopes, _, err := sealPrivateData(privateData, func(receiverID string, contentKey []byte) (string, error) {
+		acc, ok := accounts[receiverID]
+		if !ok {
+			return "", errors.New("account of receiver " + receiverID + " is not given")
+		}
+		return wrapForAccount(acc, contentKey)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return b.sign(transaction.PayloadAdd, &state.Payload{
+		ID:              id,
+		SenderAccountID: b.accountID,
+		PublicData:      publicData,
+		PrivateData:     privateData,
+		Envelopes:       envelopes,
+		CreatedAt:       float64(time.Now().UnixNano() / 1000000),
+	})
+}
+
+// UpdatePayload method builds transaction, which updates public data of payload.
+func (b *Builder) UpdatePayload(update *state.PayloadUpdate) (*transaction.Transaction, error) {
+	return b.sign(transaction.PayloadUpdate, update)
+}
+
+// RevokePayload method builds transaction, which revokes payload.
+func (b *Builder) RevokePayload(id, reason string) (*transaction.Transaction, error) {
+	return b.sign(transaction.PayloadRevoke, &state.PayloadRevocation{ID: id, Reason: reason})
+}
+
+// GrantPrivateData method builds transaction, which shares private data of
+// source receiver with new receiver. Source private data is decrypted by
+// given keys of source receiver and encrypted by key of new receiver.
+func (b *Builder) GrantPrivateData(payload *state.Payload, sourceID string, sourceKeys []*crypto.Key, receiver *state.Account) (*transaction.Transaction, error) {
+	var source *state.PrivateData
+	for _, p := range payload.PrivateData {
+		if p.ReceiverAccountID == sourceID {
+			source = p
+		}
+	}
+	if source == nil {
+		return nil, errors.New("payload has no private data for receiver's account id " + sourceID)
+	}
+	encoded, _ := source.Data.(string)
+	decodedBin, _ := base64.StdEncoding.DecodeString(encoded)
+	decryptedBin, err := decryptWithKeys(sourceKeys, decodedBin)
+	if err != nil {
+		return nil, errors.New("cannot decrypt private data for receiver's account id " + sourceID + ": " + err.Error())
+	}
+	encrypted, err := wrapForAccount(receiver, decryptedBin)
+	if err != nil {
+		return nil, err
+	}
+	return b.sign(transaction.PrivateDataGrant, &state.PrivateDataGrant{
+		ID: payload.ID,
+		PrivateData: &state.PrivateData{
+			ReceiverAccountID: receiver.ID,
+			Data:              encrypted,
+			Envelope:          source.Envelope,
+		},
+	})
+}
+
+// RotateKey method builds transaction, which installs new key of account and
+// new encryption key, if it is not nil. Key of builder is replaced by the new key.
+func (b *Builder) RotateKey(newKey, newEncKey *crypto.Key) (*transaction.Transaction, error) {
+	rotation := &state.KeyRotation{
+		AccountID: b.accountID,
+		PubKey:    newKey.GetPubString(),
+		KeyType:   string(newKey.Type()),
+	}
+	if newEncKey != nil {
+		rotation.EncPubKey = newEncKey.GetPubString()
+		rotation.EncKeyType = string(newEncKey.Type())
+	}
+	tx, err := b.sign(transaction.KeyRotate, rotation)
+	if err != nil {
+		return nil, err
+	}
+	b.key = newKey
+	return tx, nil
+}
+
+// GrantRole method builds transaction, which grants role to account.
+// Builder should be of admin account.
+func (b *Builder) GrantRole(accountID, role string) (*transaction.Transaction, error) {
+	return b.sign(transaction.RoleGrant, &state.RoleChange{AccountID: accountID, Role: role})
+}
+
+// RevokeRole method builds transaction, which revokes role of account.
+// Builder should be of admin account.
+func (b *Builder) RevokeRole(accountID, role string) (*transaction.Transaction, error) {
+	return b.sign(transaction.RoleRevoke, &state.RoleChange{AccountID: accountID, Role: role})
+}
+
+// UpdateValidator method builds transaction, which adds validator, changes its
+// power or removes it with zero power. Builder should be of admin account or of
+// operator of validator, which votes for update.
+func (b *Builder) UpdateValidator(pubKey string, power int64, accountID string) (*transaction.Transaction, error) {
+	return b.sign(transaction.ValidatorUpdate, &state.ValidatorUpdate{PubKey: pubKey, Power: power, AccountID: accountID})
+}
+
+type msgpMarshaler interface {
+	MarshalMsg([]byte) ([]byte, error)
+}
+
+// sign method builds transaction of given type with the next nonce of account.
+func (b *Builder) sign(t transaction.TransactionType, data msgpMarshaler) (*transaction.Transaction, error) {
+	bs, err := data.MarshalMsg(nil)
+	if err != nil {
+		return nil, err
+	}
+	tx := transaction.New(t, b.accountID, bs)
+	tx.Nonce = b.nonce
+	if err := tx.Sign(b.key, b.chainID); err != nil {
+		return nil, err
+	}
+	b.nonce++
+	return tx, nil
+}
+
+// wrapFunc encrypts content key of envelope for receiver and returns it as
+// base64 encoded string.
+type wrapFunc func(receiverID string, contentKey []byte) (string, error)
+
+// sealPrivateData function encrypts private data of every receiver. Data, which
+// is the same for several receivers, is encrypted once in envelope with random
+// content key, and only content key is encrypted for every receiver.
+func sealPrivateData(privData []*state.PrivateData, wrap wrapFunc) ([]*state.Envelope, map[string][]byte, error) {
+	var envelopes []*state.Envelope
+	envelopeIDs := make(map[string]string)
+	contentKeys := make(map[string][]byte)
+	for _, data := range privData {
+		// Marshal private data of receiver
+		privMrsh, err := json.Marshal(data.Data)
+		if err != nil {
+			return nil, nil, errors.New("error in marshalling private data: " + err.Error())
+		}
+		// The same data is encrypted only once
+		envelopeID, ok := envelopeIDs[string(privMrsh)]
+		if !ok {
+			ciphertext, contentKey, err := crypto.SealEnvelope(privMrsh)
+			if err != nil {
+				return nil, nil, errors.New("error in encrypting private data: " + err.Error())
+			}
+			envelopeID = strconv.Itoa(len(envelopes))
+			envelopes = append(envelopes, &state.Envelope{ID: envelopeID, Data: base64.StdEncoding.EncodeToString(ciphertext)})
+			envelopeIDs[string(privMrsh)] = envelopeID
+			contentKeys[envelopeID] = contentKey
+		}
+		// Content key is encrypted with public key of receiver
+		wrapped, err := wrap(data.ReceiverAccountID, contentKeys[envelopeID])
+		if err != nil {
+			return nil, nil, err
+		}
+		data.Data = wrapped
+		data.Envelope = envelopeID
+	}
+	return envelopes, contentKeys, nil
+}
+
+// addSenderCopy function encrypts content keys of envelopes, which are not
+// shared with sender yet, for sender.
+func addSenderCopy(privData []*state.PrivateData, envelopes []*state.Envelope, contentKeys map[string][]byte, senderID string, wrap wrapFunc) ([]*state.PrivateData, error) {
+	shared := make(map[string]bool)
+	for _, data := range privData {
+		if data.ReceiverAccountID == senderID {
+			shared[data.Envelope] = true
+		}
+	}
+	for _, envelope := range envelopes {
+		if shared[envelope.ID] {
+			continue
+		}
+		wrapped, err := wrap(senderID, contentKeys[envelope.ID])
+		if err != nil {
+			return nil, err
+		}
+		privData = append(privData, &state.PrivateData{
+			ReceiverAccountID: senderID,
+			Data:              wrapped,
+			Envelope:          envelope.ID,
+		})
+	}
+	return privData, nil
+}
+
+// wrapForAccount function encrypts content key of envelope, or private data of
+// legacy layout, with encryption key of account.
+func wrapForAccount(receiver *state.Account, contentKey []byte) (string, error) {
+	encPub, encKeyType := receiver.EncryptionKey()
+	receiverPubKey, err := crypto.NewFromTypedStrings(crypto.KeyType(encKeyType), encPub, "")
+	if err != nil {
+		return "", errors.New("error in processing receiver's public key: " + err.Error())
+	}
+	// ECDH encrypted content key with public key of receiver
+	wrapped, err := receiverPubKey.Encrypt(contentKey)
+	if err != nil {
+		return "", errors.New("error in encrypting private data: " + err.Error())
+	}
+	return base64.StdEncoding.EncodeToString(wrapped), nil
+}
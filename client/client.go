@@ -22,60 +22,177 @@
 package client
 
 import (
+	"crypto/sha256"
 	"encoding/base64"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"time"
 
 	"github.com/eeonevision/anychaindb/crypto"
 	"github.com/eeonevision/anychaindb/state"
+	"github.com/eeonevision/anychaindb/transaction"
 	"github.com/globalsign/mgo/bson"
+	tmtypes "github.com/tendermint/tendermint/types"
 )
 
 // API is the high level interface for Anychaindb client applications.
 type API interface {
 	AccountAPI
 	PayloadAPI
+	TransactionAPI
 }
 
 // AccountAPI describes all account related functions.
 type AccountAPI interface {
-	CreateAccount() (id, pub, priv string, err error)
+	CreateAccount(path string) (id, pub, priv, encPub, encPriv string, err error)
 	GetAccount(id string) (*state.Account, error)
 	SearchAccounts(query []byte) ([]state.Account, error)
+	GetNextNonce(accountID string) (uint32, error)
+	RotateKey() (pub, priv, encPub, encPriv string, err error)
 }
 
 // PayloadAPI interface provides all transaction data related methods.
 type PayloadAPI interface {
 	AddPayload(senderAccountID string, publicData interface{}, privateData []byte) (ID string, err error)
-	GetPayload(ID, receiverID, privKey string) (*state.Payload, error)
-	SearchPayloads(query []byte, receiverID, privKey string) ([]state.Payload, error)
+	GetPayload(ID, receiverID string, privKeys []string) (*state.Payload, error)
+	SearchPayloads(query []byte, receiverID string, privKeys []string) ([]state.Payload, error)
+	UpdatePayload(id string, publicData interface{}, mergePatch bool, expectedRevision *uint32) error
+	GetPayloadRevision(id string, revision uint32, receiverID string, privKeys []string) (*state.Payload, error)
+	GetPayloadRevisions(id, receiverID string, privKeys []string) ([]state.Payload, error)
+	RevokePayload(id, reason string) error
+	GrantPrivateData(id, receiverID, privKey, newReceiverID string) error
+}
+
+// TransactionAPI interface provides broadcasting of transactions, which are
+// built and signed outside of client, e.g. by Builder.
+type TransactionAPI interface {
+	BroadcastTransaction(tx *transaction.Transaction) (hash string, err error)
+}
+
+// Option configures API client.
+type Option func(*apiClient)
+
+// WithProofVerification option enables verification of Merkle proofs for
+// accounts and payloads, which are requested by id. Proofs are checked against
+// app hashes of headers, signed by given trusted validators of chain.
+func WithProofVerification(chainID string, validators []*tmtypes.Validator) Option {
+	return func(api *apiClient) {
+		api.fast.verifier = newVerifier(api.endpoint, chainID, validators)
+	}
+}
+
+// WithSenderCopy option makes private data of added payloads readable
+// by the sender, content keys of envelopes are encrypted for the sender too.
+func WithSenderCopy() Option {
+	return func(api *apiClient) {
+		api.senderCopy = true
+	}
+}
+
+// WithKeyType option defines type of key pairs, which are generated
+// for new accounts and key rotations. P-256 keys are generated by default.
+func WithKeyType(keyType crypto.KeyType) Option {
+	return func(api *apiClient) {
+		api.keyType = keyType
+	}
+}
+
+// WithMnemonic option defines BIP-39 mnemonic and optional passphrase of seed,
+// which is used for derivation of account keys by path.
+func WithMnemonic(mnemonic, passphrase string) Option {
+	return func(api *apiClient) {
+		api.mnemonic, api.passphrase = mnemonic, passphrase
+	}
 }
 
 // NewAPI constructs a new API instances based on an http transport.
-func NewAPI(endpoint, mode string, key *crypto.Key, accountID string) API {
+func NewAPI(endpoint, mode string, key *crypto.Key, accountID string, opts ...Option) API {
 	fast := newFastClient(endpoint, mode, key, accountID)
-	return &apiClient{endpoint, mode, fast}
+	api := &apiClient{endpoint: endpoint, mode: mode, fast: fast, keyType: crypto.KeyTypeP256}
+	for _, opt := range opts {
+		opt(api)
+	}
+	return api
+}
+
+// NewAPIFromKeystore constructs a new API instance with account and key pair,
+// which are decrypted from keystore file by password.
+func NewAPIFromKeystore(endpoint, mode, path, password string, opts ...Option) (API, error) {
+	ks, err := crypto.ReadKeystoreFile(path)
+	if err != nil {
+		return nil, err
+	}
+	key, err := ks.Decrypt(password)
+	if err != nil {
+		return nil, err
+	}
+	return NewAPI(endpoint, mode, key, ks.AccountID, opts...), nil
 }
 
 type apiClient struct {
-	endpoint string
-	mode     string
-	fast     *fastClient
+	endpoint   string
+	mode       string
+	fast       *fastClient
+	senderCopy bool
+	keyType    crypto.KeyType
+	mnemonic   string
+	passphrase string
 }
 
-func (api *apiClient) CreateAccount() (id, pub, priv string, err error) {
-	key, err := crypto.CreateKeyPair()
+// CreateAccount method generates signing and encryption key pairs of new account
+// and registers account with both public keys. If path is given, keys are derived
+// from mnemonic seed: signing key by path/0' and encryption key by path/1'.
+// Otherwise random keys are generated.
+func (api *apiClient) CreateAccount(path string) (id, pub, priv, encPub, encPriv string, err error) {
+	key, encKey, err := api.accountKeyPairs(path)
 	if err != nil {
-		return "", "", "", err
+		return "", "", "", "", "", err
 	}
 	api.fast.key = key
 	id = bson.NewObjectId().Hex()
-	err = api.fast.addAccount(&state.Account{ID: id, PubKey: key.GetPubString()})
+	err = api.fast.addAccount(&state.Account{
+		ID:         id,
+		PubKey:     key.GetPubString(),
+		KeyType:    string(key.Type()),
+		EncPubKey:  encKey.GetPubString(),
+		EncKeyType: string(encKey.Type()),
+	})
 	if err != nil {
-		return "", "", "", err
+		return "", "", "", "", "", err
+	}
+	return id, key.GetPubString(), key.GetPrivString(), encKey.GetPubString(), encKey.GetPrivString(), nil
+}
+
+// accountKeyPairs method returns signing and encryption key pairs of new account.
+func (api *apiClient) accountKeyPairs(path string) (key, encKey *crypto.Key, err error) {
+	if path == "" {
+		if key, err = crypto.CreateKeyPairOfType(api.keyType); err != nil {
+			return nil, nil, err
+		}
+		encKey, err = crypto.CreateKeyPairOfType(api.keyType)
+		return key, encKey, err
 	}
-	return id, key.GetPubString(), key.GetPrivString(), nil
+	return DeriveAccountKeys(api.keyType, api.mnemonic, api.passphrase, path)
+}
+
+// DeriveAccountKeys function derives signing and encryption key pairs of account
+// from mnemonic seed: signing key by path/0' and encryption key by path/1'.
+// Keys are derived in process of client, only their public keys are posted to
+// blockchain by signed transaction of account.
+func DeriveAccountKeys(keyType crypto.KeyType, mnemonic, passphrase, path string) (key, encKey *crypto.Key, err error) {
+	if mnemonic == "" {
+		return nil, nil, errors.New("mnemonic is required for derivation of keys")
+	}
+	seed, err := crypto.SeedFromMnemonic(mnemonic, passphrase)
+	if err != nil {
+		return nil, nil, err
+	}
+	if key, err = crypto.DeriveKey(keyType, seed, path+"/0'"); err != nil {
+		return nil, nil, err
+	}
+	encKey, err = crypto.DeriveKey(keyType, seed, path+"/1'")
+	return key, encKey, err
 }
 
 func (api *apiClient) GetAccount(id string) (*state.Account, error) {
@@ -86,6 +203,42 @@ func (api *apiClient) SearchAccounts(query []byte) ([]state.Account, error) {
 	return api.fast.searchAccounts(query)
 }
 
+// GetNextNonce method returns nonce expected in the next transaction of account.
+func (api *apiClient) GetNextNonce(accountID string) (uint32, error) {
+	return api.fast.getNextNonce(accountID)
+}
+
+// RotateKey method generates new key pair of account and installs it
+// instead of current key, which signs the rotation. Encryption key pair of
+// account with separate encryption key is rotated as well. Previous private
+// keys should be kept by caller to read data encrypted by them.
+func (api *apiClient) RotateKey() (pub, priv, encPub, encPriv string, err error) {
+	acc, err := api.fast.getAccount(api.fast.accountID)
+	if err != nil {
+		return "", "", "", "", err
+	}
+	key, err := crypto.CreateKeyPairOfType(api.keyType)
+	if err != nil {
+		return "", "", "", "", err
+	}
+	var encKey *crypto.Key
+	if acc.EncPubKey != "" {
+		if encKey, err = crypto.CreateKeyPairOfType(api.keyType); err != nil {
+			return "", "", "", "", err
+		}
+		encPub, encPriv = encKey.GetPubString(), encKey.GetPrivString()
+	}
+	if err := api.fast.rotateKey(key, encKey); err != nil {
+		return "", "", "", "", err
+	}
+	api.fast.key = key
+	return key.GetPubString(), key.GetPrivString(), encPub, encPriv, nil
+}
+
+// AddPayload method encrypts private data of every receiver and posts payload.
+// Data, which is the same for several receivers, is encrypted once in envelope with
+// random content key, and only content key is encrypted for every receiver.
+// If sender copy is enabled, content keys are encrypted for sender as well.
 func (api *apiClient) AddPayload(senderAccountID string, publicData interface{}, privateData []byte) (ID string, err error) {
 	id := bson.NewObjectId().Hex()
 
@@ -96,36 +249,22 @@ func (api *apiClient) AddPayload(senderAccountID string, publicData interface{},
 		return "", errors.New("error in unmarshalling private data: " + err.Error())
 	}
 
-	for _, data := range privData {
-		// Get receiver's public key
-		receiver, err := api.fast.getAccount(data.ReceiverAccountID)
-		if err != nil {
-			return "", errors.New(
-				"error in getting receiver's account " + data.ReceiverAccountID + ": " + err.Error(),
-			)
-		}
-		receiverPubKey, err := crypto.NewFromStrings(receiver.PubKey, "")
-		if err != nil {
-			return "", errors.New("error in processing receiver's public key: " + err.Error())
-		}
-		// Marshal private data of receiver
-		privMrsh, err := json.Marshal(data.Data)
-		if err != nil {
-			return "", errors.New("error in marshalling private data: " + err.Error())
-		}
-		// ECDH encrypted private data with public key of receiver
-		privateDataEnc, err := receiverPubKey.Encrypt(privMrsh)
+	envelopes, contentKeys, err := sealPrivateData(privData, api.wrapContentKey)
+	if err != nil {
+		return "", err
+	}
+	if api.senderCopy {
+		privData, err = addSenderCopy(privData, envelopes, contentKeys, senderAccountID, api.wrapContentKey)
 		if err != nil {
-			return "", errors.New("error in encrypting private data: " + err.Error())
+			return "", err
 		}
-		// Reassign data from raw to encrypted and base64 encoded string
-		data.Data = base64.StdEncoding.EncodeToString(privateDataEnc)
 	}
 	err = api.fast.addPayload(&state.Payload{
 		ID:              id,
 		SenderAccountID: senderAccountID,
 		PublicData:      publicData,
 		PrivateData:     privData,
+		Envelopes:       envelopes,
 		CreatedAt:       float64(time.Now().UnixNano() / 1000000),
 	})
 	if err != nil {
@@ -134,7 +273,20 @@ func (api *apiClient) AddPayload(senderAccountID string, publicData interface{},
 	return id, nil
 }
 
-func (api *apiClient) GetPayload(id, receiverID, privKey string) (*state.Payload, error) {
+// wrapContentKey method encrypts content key of envelope, or private data of
+// legacy layout, with encryption key of receiver and returns it as base64 encoded string.
+func (api *apiClient) wrapContentKey(receiverID string, contentKey []byte) (string, error) {
+	// Get receiver's public key
+	receiver, err := api.fast.getAccount(receiverID)
+	if err != nil {
+		return "", errors.New(
+			"error in getting receiver's account " + receiverID + ": " + err.Error(),
+		)
+	}
+	return wrapForAccount(receiver, contentKey)
+}
+
+func (api *apiClient) GetPayload(id, receiverID string, privKeys []string) (*state.Payload, error) {
 	payload, err := api.fast.getPayload(id)
 	if err != nil {
 		return payload, err
@@ -144,14 +296,17 @@ func (api *apiClient) GetPayload(id, receiverID, privKey string) (*state.Payload
 		return nil, nil
 	}
 	// Check if decoding not needed
-	if receiverID == "" && privKey == "" {
+	if receiverID == "" && len(privKeys) == 0 {
 		return payload, nil
 	}
-	res, err := api.decryptPrivateData(receiverID, privKey, []state.Payload{*payload})
+	if len(privKeys) == 0 {
+		return &receiverPrivateData(receiverID, []state.Payload{*payload})[0], nil
+	}
+	res, err := api.decryptPrivateData(receiverID, privKeys, []state.Payload{*payload})
 	return &res[0], err
 }
 
-func (api *apiClient) SearchPayloads(query []byte, receiverID, privKey string) ([]state.Payload, error) {
+func (api *apiClient) SearchPayloads(query []byte, receiverID string, privKeys []string) ([]state.Payload, error) {
 	payloads, err := api.fast.searchPayloads(query)
 	if err != nil {
 		return payloads, err
@@ -161,42 +316,248 @@ func (api *apiClient) SearchPayloads(query []byte, receiverID, privKey string) (
 		return payloads, nil
 	}
 	// Check if decoding not needed
-	if receiverID == "" && privKey == "" {
+	if receiverID == "" && len(privKeys) == 0 {
 		return payloads, nil
 	}
+	if len(privKeys) == 0 {
+		return receiverPrivateData(receiverID, payloads), nil
+	}
 	// Decrypt private data
-	return api.decryptPrivateData(receiverID, privKey, payloads)
+	return api.decryptPrivateData(receiverID, privKeys, payloads)
 }
 
-func (api *apiClient) decryptPrivateData(receiverID, privKey string, payloads []state.Payload) ([]state.Payload, error) {
+// UpdatePayload method replaces public data of payload, or applies it as
+// JSON merge patch if mergePatch is set. Update is rejected if expectedRevision
+// is given and differs from the current revision of payload.
+func (api *apiClient) UpdatePayload(id string, publicData interface{}, mergePatch bool, expectedRevision *uint32) error {
+	return api.fast.updatePayload(&state.PayloadUpdate{
+		ID:               id,
+		PublicData:       publicData,
+		MergePatch:       mergePatch,
+		ExpectedRevision: expectedRevision,
+	})
+}
+
+// RevokePayload method marks payload as withdrawn with given reason.
+func (api *apiClient) RevokePayload(id, reason string) error {
+	return api.fast.revokePayload(&state.PayloadRevocation{ID: id, Reason: reason})
+}
+
+// GrantPrivateData method shares private data of payload with new receiver.
+// Data of existing receiver is decrypted by its private key and encrypted by
+// the public key of new receiver. Grant is signed by the payload sender.
+func (api *apiClient) GrantPrivateData(id, receiverID, privKey, newReceiverID string) error {
+	payload, err := api.fast.getPayload(id)
+	if err != nil {
+		return err
+	}
+	var source *state.PrivateData
+	for _, p := range payload.PrivateData {
+		if p.ReceiverAccountID == receiverID {
+			source = p
+		}
+	}
+	if source == nil {
+		return errors.New("payload has no private data for receiver's account id " + receiverID)
+	}
+	// Decrypt private data of existing receiver
+	acc, err := api.fast.getAccount(receiverID)
+	if err != nil {
+		return errors.New("error in getting receiver's account " + receiverID + ": " + err.Error())
+	}
+	keys, err := accountKeys(acc, []string{privKey})
+	if err != nil {
+		return errors.New("invalid receiver's private key: " + err.Error())
+	}
+	// Data of envelope is shared by re-encryption of its content key only
+	encoded, _ := source.Data.(string)
+	decodedBin, _ := base64.StdEncoding.DecodeString(encoded)
+	decryptedBin, err := decryptWithKeys(keys, decodedBin)
+	if err != nil {
+		return errors.New("cannot decrypt private data for receiver's account id " + receiverID + ": " + err.Error())
+	}
+	// Encrypt it with public key of new receiver
+	encrypted, err := api.wrapContentKey(newReceiverID, decryptedBin)
+	if err != nil {
+		return err
+	}
+	return api.fast.grantPrivateData(&state.PrivateDataGrant{
+		ID: id,
+		PrivateData: &state.PrivateData{
+			ReceiverAccountID: newReceiverID,
+			Data:              encrypted,
+			Envelope:          source.Envelope,
+		},
+	})
+}
+
+// BroadcastTransaction method posts signed transaction to blockchain as is
+// and returns its hash.
+func (api *apiClient) BroadcastTransaction(tx *transaction.Transaction) (hash string, err error) {
+	bs, err := tx.ToBytes()
+	if err != nil {
+		return "", err
+	}
+	if _, err := api.fast.broadcastTx(bs); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%X", tmtypes.Tx(bs).Hash()), nil
+}
+
+func (api *apiClient) GetPayloadRevision(id string, revision uint32, receiverID string, privKeys []string) (*state.Payload, error) {
+	payload, err := api.fast.getPayloadRevision(id, revision)
+	if err != nil {
+		return payload, err
+	}
+	// Check if decoding not needed
+	if receiverID == "" && len(privKeys) == 0 {
+		return payload, nil
+	}
+	if len(privKeys) == 0 {
+		return &receiverPrivateData(receiverID, []state.Payload{*payload})[0], nil
+	}
+	res, err := api.decryptPrivateData(receiverID, privKeys, []state.Payload{*payload})
+	return &res[0], err
+}
+
+func (api *apiClient) GetPayloadRevisions(id, receiverID string, privKeys []string) ([]state.Payload, error) {
+	payloads, err := api.fast.getPayloadRevisions(id)
+	if err != nil {
+		return payloads, err
+	}
+	// Check if decoding not needed
+	if len(payloads) == 0 || (receiverID == "" && len(privKeys) == 0) {
+		return payloads, nil
+	}
+	if len(privKeys) == 0 {
+		return receiverPrivateData(receiverID, payloads), nil
+	}
+	return api.decryptPrivateData(receiverID, privKeys, payloads)
+}
+
+// receiverPrivateData function keeps only private data of receiver and its
+// envelopes in payloads, which are returned encrypted for decryption on
+// receiver's side.
+func receiverPrivateData(receiverID string, payloads []state.Payload) []state.Payload {
+	for i := range payloads {
+		data := []*state.PrivateData{}
+		var envelopes []*state.Envelope
+		for _, p := range payloads[i].PrivateData {
+			if p.ReceiverAccountID != receiverID {
+				continue
+			}
+			data = append(data, p)
+			if e := payloads[i].GetEnvelope(p.Envelope); p.Envelope != "" && e != nil {
+				envelopes = append(envelopes, e)
+			}
+		}
+		payloads[i].PrivateData = data
+		payloads[i].Envelopes = envelopes
+	}
+	return payloads
+}
+
+// accountKeys function pairs given private keys with current and previous
+// public keys of account, which they belong to, so private data encrypted by
+// any key of account is decrypted, if the private key of that key is given.
+func accountKeys(acc *state.Account, privKeys []string) ([]*crypto.Key, error) {
+	type pubKey struct{ key, typ string }
+	pubs := []pubKey{{acc.EncPubKey, acc.EncKeyType}, {acc.PubKey, acc.KeyType}}
+	for i := len(acc.KeyHistory) - 1; i >= 0; i-- {
+		r := acc.KeyHistory[i]
+		pubs = append(pubs, pubKey{r.EncPubKey, r.EncKeyType}, pubKey{r.PubKey, r.KeyType})
+	}
+	seen := make(map[string]bool)
+	var keys []*crypto.Key
+	for _, pub := range pubs {
+		if pub.key == "" || seen[pub.key] {
+			continue
+		}
+		seen[pub.key] = true
+		for _, priv := range privKeys {
+			key, err := crypto.NewFromTypedStrings(crypto.KeyType(pub.typ), pub.key, priv)
+			if err == nil && isKeyPair(key, pub.key) {
+				keys = append(keys, key)
+				break
+			}
+		}
+	}
+	if len(keys) == 0 {
+		return nil, errors.New("private keys do not match any key of account")
+	}
+	return keys, nil
+}
+
+// isKeyPair function checks that private key of key belongs to given public key.
+func isKeyPair(key *crypto.Key, pub string) bool {
+	pubKey, err := crypto.NewFromTypedStrings(key.Type(), pub, "")
+	if err != nil {
+		return false
+	}
+	hash := sha256.Sum256([]byte(pub))
+	sig, err := key.Sign(hash[:])
+	return err == nil && pubKey.Verify(hash[:], sig) == nil
+}
+
+// decryptWithKeys function decrypts data by the first of keys, which fits it.
+func decryptWithKeys(keys []*crypto.Key, data []byte) (out []byte, err error) {
+	for _, k := range keys {
+		if out, err = k.Decrypt(data); err == nil {
+			return out, nil
+		}
+	}
+	return nil, err
+}
+
+// decryptData method decrypts private data entry of payload with given keys of receiver.
+func decryptData(keys []*crypto.Key, payload *state.Payload, p *state.PrivateData) ([]byte, error) {
+	encoded, _ := p.Data.(string)
+	decodedBin, _ := base64.StdEncoding.DecodeString(encoded)
+	decryptedBin, err := decryptWithKeys(keys, decodedBin)
+	if err != nil || p.Envelope == "" {
+		return decryptedBin, err
+	}
+	// Decrypted data is content key of envelope
+	envelope := payload.GetEnvelope(p.Envelope)
+	if envelope == nil {
+		return nil, errors.New("envelope " + p.Envelope + " is not found")
+	}
+	ciphertext, err := base64.StdEncoding.DecodeString(envelope.Data)
+	if err != nil {
+		return nil, err
+	}
+	return crypto.OpenEnvelope(ciphertext, decryptedBin)
+}
+
+// decryptPrivateData method decrypts private data of receiver with given keys.
+// Entries, which are not decrypted by any key, e.g. encrypted by key of account
+// whose private key is not given, are left encrypted.
+func (api *apiClient) decryptPrivateData(receiverID string, privKeys []string, payloads []state.Payload) ([]state.Payload, error) {
 	// Get account's public key
 	acc, err := api.fast.getAccount(receiverID)
 	if err != nil {
 		return payloads, errors.New("invalid authorization account id: " + err.Error())
 	}
-	// Set private key structure for account
-	pK, err := crypto.NewFromStrings(acc.PubKey, privKey)
+	// Set private key structures for current and previous keys of account
+	keys, err := accountKeys(acc, privKeys)
 	if err != nil {
 		return payloads, errors.New("invalid authorization private key: " + err.Error())
 	}
 	// Decrypt all data signed by public key of receiver
-	for _, payload := range payloads {
-		for _, p := range payload.PrivateData {
-			if p.ReceiverAccountID == receiverID {
-				decodedBin, _ := base64.StdEncoding.DecodeString(p.Data.(string))
-				decryptedBin, err := pK.Decrypt(decodedBin)
-				if err != nil {
-					return payloads, errors.New(
-						"cannot decrypt private data for receiver's account id " + p.ReceiverAccountID + ": " + err.Error(),
-					)
-				}
-				var decrypted interface{}
-				err = json.Unmarshal(decryptedBin, &decrypted)
-				if err != nil {
-					return payloads, err
-				}
-				p.Data = decrypted
+	for i := range payloads {
+		for _, p := range payloads[i].PrivateData {
+			if p.ReceiverAccountID != receiverID {
+				continue
+			}
+			decryptedBin, err := decryptData(keys, &payloads[i], p)
+			if err != nil {
+				continue
+			}
+			var decrypted interface{}
+			if err := json.Unmarshal(decryptedBin, &decrypted); err != nil {
+				continue
 			}
+			p.Data = decrypted
 		}
 	}
 	return payloads, nil
@@ -41,6 +41,8 @@ type fastClient struct {
 	mode      string
 	accountID string
 	client    *http.Client
+	verifier  *verifier
+	chainID   string
 }
 
 // newFastClient initializes new fast client instance.
@@ -59,7 +61,7 @@ func newFastClient(endpoint, mode string, key *crypto.Key, accountID string) *fa
 	default:
 		mode = sync
 	}
-	return &fastClient{key, endpoint, mode, accountID, &http.Client{Timeout: 30 * time.Second}}
+	return &fastClient{key, endpoint, mode, accountID, &http.Client{Timeout: 30 * time.Second}, nil, ""}
 }
 
 func (c *fastClient) doPOSTRequest(method, data string) (*rpctypes.RPCResponse, error) {
@@ -121,6 +123,41 @@ func (c *fastClient) abciQuery(path string, data []byte) (*core_types.ResultABCI
 	return abciRes, nil
 }
 
+// proveQuery method requests object from state together with Merkle proof
+// and verifies response. Absence of object is verified as well.
+func (c *fastClient) proveQuery(path, key string, data []byte) (*core_types.ResultABCIQuery, error) {
+	var abciRes *core_types.ResultABCIQuery
+
+	rpcRes, err := c.doPOSTRequest("abci_query", fmt.Sprintf(`{"path": "%s", "data": "%s", "prove": true}`, path, hex.EncodeToString(data)))
+	if err != nil {
+		return nil, err
+	}
+
+	err = json.Unmarshal(rpcRes.Result, &abciRes)
+	if err != nil {
+		return nil, err
+	}
+	if abciRes.Response.IsErr() && abciRes.Response.Proof == nil {
+		return nil, errors.New(abciRes.Response.GetLog())
+	}
+	if err := c.verifier.verify(key, &abciRes.Response); err != nil {
+		return nil, err
+	}
+	if abciRes.Response.IsErr() {
+		return nil, errors.New(abciRes.Response.GetLog())
+	}
+
+	return abciRes, nil
+}
+
+// getObject method requests object by id, with proof if verifier is set.
+func (c *fastClient) getObject(path, key, id string) (*core_types.ResultABCIQuery, error) {
+	if c.verifier != nil {
+		return c.proveQuery(path, key, []byte(id))
+	}
+	return c.abciQuery(path, []byte(id))
+}
+
 func (c *fastClient) broadcastTx(tx []byte) (interface{}, error) {
 	var rpcRes *rpctypes.RPCResponse
 
@@ -151,6 +188,64 @@ func (c *fastClient) broadcastTx(tx []byte) (interface{}, error) {
 	return data, nil
 }
 
+// getChainID method returns id of the chain, which is requested
+// from the node once. Signatures of transactions are bound to it.
+func (c *fastClient) getChainID() (string, error) {
+	if c.chainID != "" {
+		return c.chainID, nil
+	}
+	rpcRes, err := c.doPOSTRequest("status", "{}")
+	if err != nil {
+		return "", err
+	}
+	var status *core_types.ResultStatus
+	if err := json.Unmarshal(rpcRes.Result, &status); err != nil {
+		return "", err
+	}
+	c.chainID = status.NodeInfo.Network
+	return c.chainID, nil
+}
+
+// getNextNonce method returns nonce expected in the next transaction of account.
+func (c *fastClient) getNextNonce(id string) (uint32, error) {
+	resp, err := c.abciQuery("accounts/nonce", []byte(id))
+	if err != nil {
+		return 0, err
+	}
+	var nonce uint32
+	if err := json.Unmarshal(resp.Response.GetValue(), &nonce); err != nil {
+		return 0, err
+	}
+	return nonce, nil
+}
+
+// getParams method returns parameters of the chain.
+func (c *fastClient) getParams() (*state.Params, error) {
+	resp, err := c.abciQuery("params", nil)
+	if err != nil {
+		return nil, err
+	}
+	var params state.Params
+	if err := json.Unmarshal(resp.Response.GetValue(), &params); err != nil {
+		return nil, err
+	}
+	return &params, nil
+}
+
+// signTx method sets the next nonce of account to transaction and signs it.
+func (c *fastClient) signTx(tx *transaction.Transaction) error {
+	chainID, err := c.getChainID()
+	if err != nil {
+		return errors.New("chain id can't be loaded: " + err.Error())
+	}
+	nonce, err := c.getNextNonce(tx.Signer)
+	if err != nil {
+		return errors.New("nonce can't be loaded: " + err.Error())
+	}
+	tx.Nonce = nonce
+	return tx.Sign(c.key, chainID)
+}
+
 func (c *fastClient) addAccount(acc *state.Account) error {
 	var err error
 
@@ -158,7 +253,26 @@ func (c *fastClient) addAccount(acc *state.Account) error {
 	if err != nil {
 		return err
 	}
-	tx := transaction.New(transaction.AccountAdd, c.accountID, txBytes)
+	chainID, err := c.getChainID()
+	if err != nil {
+		return errors.New("chain id can't be loaded: " + err.Error())
+	}
+	// Proof-of-work is solved if chain requires it for admission
+	params, err := c.getParams()
+	if err != nil {
+		return errors.New("chain params can't be loaded: " + err.Error())
+	}
+	if params.AccountAdmission == state.AdmissionPoW {
+		SolveProofOfWork(acc, chainID, params.PoWDifficulty)
+		if txBytes, err = acc.MarshalMsg(nil); err != nil {
+			return err
+		}
+	}
+	// Account is signed by its own key to prove possession of it
+	tx := transaction.New(transaction.AccountAdd, acc.ID, txBytes)
+	if err := tx.Sign(c.key, chainID); err != nil {
+		return err
+	}
 	bs, _ := tx.ToBytes()
 
 	_, err = c.broadcastTx(bs)
@@ -168,8 +282,35 @@ func (c *fastClient) addAccount(acc *state.Account) error {
 	return nil
 }
 
+// rotateKey method installs new key of account and new encryption key,
+// if it is given. Previous private keys are not published, so data encrypted
+// by them is read with them only.
+func (c *fastClient) rotateKey(newKey, newEncKey *crypto.Key) error {
+	rotation := &state.KeyRotation{
+		AccountID: c.accountID,
+		PubKey:    newKey.GetPubString(),
+		KeyType:   string(newKey.Type()),
+	}
+	if newEncKey != nil {
+		rotation.EncPubKey = newEncKey.GetPubString()
+		rotation.EncKeyType = string(newEncKey.Type())
+	}
+	txBytes, err := rotation.MarshalMsg(nil)
+	if err != nil {
+		return err
+	}
+	tx := transaction.New(transaction.KeyRotate, c.accountID, txBytes)
+	if err := c.signTx(tx); err != nil {
+		return err
+	}
+	bs, _ := tx.ToBytes()
+
+	_, err = c.broadcastTx(bs)
+	return err
+}
+
 func (c *fastClient) getAccount(id string) (*state.Account, error) {
-	resp, err := c.abciQuery("accounts", []byte(id))
+	resp, err := c.getObject("accounts", state.AccountKey(id), id)
 	if err != nil {
 		return nil, err
 	}
@@ -198,7 +339,7 @@ func (c *fastClient) addPayload(cv *state.Payload) error {
 		return err
 	}
 	tx := transaction.New(transaction.PayloadAdd, c.accountID, txBytes)
-	if err := tx.Sign(c.key); err != nil {
+	if err := c.signTx(tx); err != nil {
 		return err
 	}
 	bs, _ := tx.ToBytes()
@@ -211,7 +352,7 @@ func (c *fastClient) addPayload(cv *state.Payload) error {
 }
 
 func (c *fastClient) getPayload(id string) (*state.Payload, error) {
-	resp, err := c.abciQuery("payloads", []byte(id))
+	resp, err := c.getObject("payloads", state.PayloadKey(id), id)
 	if err != nil {
 		return nil, err
 	}
@@ -233,3 +374,73 @@ func (c *fastClient) searchPayloads(searchQuery []byte) ([]state.Payload, error)
 	}
 	return res, nil
 }
+
+func (c *fastClient) updatePayload(update *state.PayloadUpdate) error {
+	txBytes, err := update.MarshalMsg(nil)
+	if err != nil {
+		return err
+	}
+	tx := transaction.New(transaction.PayloadUpdate, c.accountID, txBytes)
+	if err := c.signTx(tx); err != nil {
+		return err
+	}
+	bs, _ := tx.ToBytes()
+
+	_, err = c.broadcastTx(bs)
+	return err
+}
+
+func (c *fastClient) getPayloadRevision(id string, revision uint32) (*state.Payload, error) {
+	query, _ := json.Marshal(map[string]interface{}{"_id": id, "revision": revision})
+	resp, err := c.abciQuery("payloads/revision", query)
+	if err != nil {
+		return nil, err
+	}
+	res := &state.Payload{}
+	if err := json.Unmarshal(resp.Response.GetValue(), &res); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+func (c *fastClient) getPayloadRevisions(id string) ([]state.Payload, error) {
+	resp, err := c.abciQuery("payloads/revisions", []byte(id))
+	if err != nil {
+		return nil, err
+	}
+	res := []state.Payload{}
+	if err := json.Unmarshal(resp.Response.GetValue(), &res); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+func (c *fastClient) revokePayload(revocation *state.PayloadRevocation) error {
+	txBytes, err := revocation.MarshalMsg(nil)
+	if err != nil {
+		return err
+	}
+	tx := transaction.New(transaction.PayloadRevoke, c.accountID, txBytes)
+	if err := c.signTx(tx); err != nil {
+		return err
+	}
+	bs, _ := tx.ToBytes()
+
+	_, err = c.broadcastTx(bs)
+	return err
+}
+
+func (c *fastClient) grantPrivateData(grant *state.PrivateDataGrant) error {
+	txBytes, err := grant.MarshalMsg(nil)
+	if err != nil {
+		return err
+	}
+	tx := transaction.New(transaction.PrivateDataGrant, c.accountID, txBytes)
+	if err := c.signTx(tx); err != nil {
+		return err
+	}
+	bs, _ := tx.ToBytes()
+
+	_, err = c.broadcastTx(bs)
+	return err
+}
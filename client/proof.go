@@ -0,0 +1,169 @@
+/*
+ * Copyright (C) 2018 eeonevision
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy of
+ * this software and associated documentation files (the "Software"), to deal in
+ * the Software without restriction, including without limitation the rights to
+ * use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+ * the Software, and to permit persons to whom the Software is furnished to do so,
+ * subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+ * FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+ * COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+ * IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+ * CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ */
+
+package client
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	stdsync "sync"
+
+	"github.com/tendermint/tendermint/abci/types"
+	"github.com/tendermint/tendermint/rpc/client"
+	tmtypes "github.com/tendermint/tendermint/types"
+
+	"github.com/eeonevision/anychaindb/state"
+)
+
+// verifier struct checks Merkle proofs of query results against app hashes
+// of block headers signed by more than 2/3 of trusted validators.
+// Trusted validators are moved forward to validators of verified headers,
+// so proofs are still verified after the validator set was changed.
+type verifier struct {
+	chainID string
+	tm      client.Client
+
+	mtx        stdsync.Mutex
+	validators *tmtypes.ValidatorSet
+	height     int64
+}
+
+// newVerifier initializes verifier, which requests headers from given endpoint.
+// Given validators are trusted to sign the first block of the chain.
+func newVerifier(endpoint, chainID string, validators []*tmtypes.Validator) *verifier {
+	return &verifier{
+		chainID:    chainID,
+		tm:         client.NewHTTP(endpoint, "/websocket"),
+		validators: tmtypes.NewValidatorSet(validators),
+	}
+}
+
+// TrustedValidatorsFromGenesis returns chain id and validators from genesis file,
+// which can be used for proof verification by WithProofVerification option.
+func TrustedValidatorsFromGenesis(path string) (chainID string, validators []*tmtypes.Validator, err error) {
+	genDoc, err := tmtypes.GenesisDocFromFile(path)
+	if err != nil {
+		return "", nil, err
+	}
+	for _, v := range genDoc.Validators {
+		validators = append(validators, tmtypes.NewValidator(v.PubKey, v.Power))
+	}
+	return genDoc.ChainID, validators, nil
+}
+
+// verify method checks that query response proves value or absence of object
+// with given key in the state. App hash of block with height of response is
+// placed in header of the next block, which is signed by validators.
+func (v *verifier) verify(key string, res *types.ResponseQuery) error {
+	header, err := v.trustedHeader(res.Height + 1)
+	if err != nil {
+		return err
+	}
+	return VerifyQueryProof(key, res, header.AppHash)
+}
+
+// trustedHeader method returns header of block with given height,
+// which is signed by trusted validators.
+func (v *verifier) trustedHeader(height int64) (*tmtypes.Header, error) {
+	v.mtx.Lock()
+	defer v.mtx.Unlock()
+	return v.verifyHeader(height)
+}
+
+// verifyHeader method checks header of block with given height and makes its
+// validators trusted. When trusted validators do not sign more than 2/3 of the
+// header, headers between them are verified first by bisection.
+func (v *verifier) verifyHeader(height int64) (*tmtypes.Header, error) {
+	header, commit, signers, err := v.signedHeader(height)
+	if err != nil {
+		return nil, err
+	}
+	err = v.validators.VerifyCommitAny(signers, v.chainID, commit.BlockID, height, commit)
+	for err != nil && height > v.height+1 {
+		if _, err := v.verifyHeader(v.height + (height-v.height)/2); err != nil {
+			return nil, err
+		}
+		err = v.validators.VerifyCommitAny(signers, v.chainID, commit.BlockID, height, commit)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("header of block %d is not signed by trusted validators: %s", height, err.Error())
+	}
+	if height > v.height {
+		v.validators = signers
+		v.height = height
+	}
+	return header, nil
+}
+
+// signedHeader method requests header of block with given height together
+// with its commit and validators and checks that they match each other.
+func (v *verifier) signedHeader(height int64) (*tmtypes.Header, *tmtypes.Commit, *tmtypes.ValidatorSet, error) {
+	commit, err := v.tm.Commit(&height)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("cannot get header of block %d: %s", height, err.Error())
+	}
+	header := commit.Header
+	if header == nil || commit.Commit == nil {
+		return nil, nil, nil, fmt.Errorf("block %d is not signed yet", height)
+	}
+	if header.ChainID != v.chainID {
+		return nil, nil, nil, errors.New("header belongs to other chain: " + header.ChainID)
+	}
+	vals, err := v.tm.Validators(&height)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("cannot get validators of block %d: %s", height, err.Error())
+	}
+	signers := tmtypes.NewValidatorSet(vals.Validators)
+	if !bytes.Equal(signers.Hash(), header.ValidatorsHash) {
+		return nil, nil, nil, errors.New("validators do not match header")
+	}
+	if !bytes.Equal(commit.Commit.BlockID.Hash, header.Hash()) {
+		return nil, nil, nil, errors.New("commit does not match header")
+	}
+	return header, commit.Commit, signers, nil
+}
+
+// VerifyQueryProof function checks that query response proves value or absence
+// of object with given key in the state with given app hash. App hash must be
+// taken from trusted header of the block next to height of response.
+func VerifyQueryProof(key string, res *types.ResponseQuery, appHash []byte) error {
+	if !bytes.Equal(res.Key, []byte(key)) {
+		return errors.New("response key does not match requested key")
+	}
+	proof := &state.Proof{}
+	if err := json.Unmarshal(res.Proof, proof); err != nil {
+		return errors.New("cannot decode proof: " + err.Error())
+	}
+	var value []byte
+	if !res.IsErr() {
+		bs, err := state.CanonicalJSON(json.RawMessage(res.Value))
+		if err != nil {
+			return errors.New("cannot decode value: " + err.Error())
+		}
+		value = state.EncodedValueHash(bs)
+	}
+	if err := proof.Verify(appHash, key, value); err != nil {
+		return errors.New("invalid proof: " + err.Error())
+	}
+	return nil
+}
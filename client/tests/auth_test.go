@@ -0,0 +1,47 @@
+/*
+ * Copyright (C) 2018 eeonevision
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy of
+ * this software and associated documentation files (the "Software"), to deal in
+ * the Software without restriction, including without limitation the rights to
+ * use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+ * the Software, and to permit persons to whom the Software is furnished to do so,
+ * subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+ * FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+ * COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+ * IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+ * CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ */
+package tests
+
+import (
+	"encoding/base64"
+	"testing"
+
+	"github.com/eeonevision/anychaindb/client"
+	"github.com/eeonevision/anychaindb/crypto"
+)
+
+func TestSignChallenge(t *testing.T) {
+	key, _ := crypto.CreateKeyPairOfType(crypto.KeyTypeSecp256k1)
+	challenge := base64.StdEncoding.EncodeToString(make([]byte, 32))
+	sig, err := client.SignChallenge(key, "1", challenge)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	hash, _ := client.ChallengeHash("1", challenge)
+	if err := key.Verify(hash, sig); err != nil {
+		t.Fatalf("signature of challenge was not verified: %s", err)
+	}
+	// Signature is bound to account
+	other, _ := client.ChallengeHash("2", challenge)
+	if err := key.Verify(other, sig); err == nil {
+		t.Fatalf("signature of challenge was verified for other account")
+	}
+}
@@ -0,0 +1,140 @@
+/*
+ * Copyright (C) 2018 eeonevision
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy of
+ * this software and associated documentation files (the "Software"), to deal in
+ * the Software without restriction, including without limitation the rights to
+ * use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+ * the Software, and to permit persons to whom the Software is furnished to do so,
+ * subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+ * FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+ * COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+ * IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+ * CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ */
+package tests
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"testing"
+	"time"
+
+	app "github.com/eeonevision/anychaindb/abci-app"
+	"github.com/eeonevision/anychaindb/client"
+	"github.com/eeonevision/anychaindb/crypto"
+	"github.com/eeonevision/anychaindb/state"
+	"github.com/eeonevision/anychaindb/transaction"
+	"github.com/tendermint/tendermint/abci/types"
+)
+
+const testChainID = "test-chain"
+
+func deliver(t *testing.T, a *app.Application, tx *transaction.Transaction) {
+	bs, err := tx.ToBytes()
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	if res := a.DeliverTx(bs); res.Code != app.CodeTypeOK {
+		t.Fatalf("%s tx was not delivered: %s", tx.Type, res.Log)
+	}
+}
+
+func TestBuilder(t *testing.T) {
+	a := app.NewApplication(state.MemoryBackend, "", "")
+	a.InitChain(types.RequestInitChain{ChainId: testChainID})
+	a.BeginBlock(types.RequestBeginBlock{Header: types.Header{ChainID: testChainID, Time: time.Now().Unix()}})
+
+	senderKey, _ := crypto.CreateKeyPair()
+	receiverKey, _ := crypto.CreateKeyPairOfType(crypto.KeyTypeEd25519)
+	sender := &state.Account{ID: "1", PubKey: senderKey.GetPubString(), KeyType: string(senderKey.Type())}
+	receiver := &state.Account{ID: "2", PubKey: receiverKey.GetPubString(), KeyType: string(receiverKey.Type())}
+
+	b := client.NewBuilder(senderKey, sender.ID, testChainID, 0)
+	tx, err := b.AddAccount(sender)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	deliver(t, a, tx)
+	tx, err = client.NewBuilder(receiverKey, receiver.ID, testChainID, 0).AddAccount(receiver)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	deliver(t, a, tx)
+
+	privData := []*state.PrivateData{{ReceiverAccountID: receiver.ID, Data: "secret"}}
+	tx, err = b.AddPayload("p1", map[string]interface{}{"name": "test"}, privData, []*state.Account{receiver})
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	// Transaction is posted as JSON to REST API
+	js, _ := json.Marshal(tx)
+	var posted transaction.Transaction
+	if err := json.Unmarshal(js, &posted); err != nil {
+		t.Fatalf("%s", err)
+	}
+	deliver(t, a, &posted)
+
+	// Only receiver opens private data
+	var payload state.Payload
+	if _, err := payload.UnmarshalMsg(tx.Data); err != nil {
+		t.Fatalf("%s", err)
+	}
+	wrapped, _ := base64.StdEncoding.DecodeString(payload.PrivateData[0].Data.(string))
+	contentKey, err := receiverKey.Decrypt(wrapped)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	ciphertext, _ := base64.StdEncoding.DecodeString(payload.Envelopes[0].Data)
+	plaintext, err := crypto.OpenEnvelope(ciphertext, contentKey)
+	if err != nil || string(plaintext) != `"secret"` {
+		t.Fatalf("private data was not opened: %s, %v", plaintext, err)
+	}
+
+	tx, err = b.RevokePayload("p1", "posted by mistake")
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	if tx.Nonce != 1 || b.Nonce() != 2 {
+		t.Fatalf("wrong nonce of transaction: %d", tx.Nonce)
+	}
+	deliver(t, a, tx)
+}
+
+func TestDeriveAccountKeys(t *testing.T) {
+	a := app.NewApplication(state.MemoryBackend, "", "")
+	a.InitChain(types.RequestInitChain{ChainId: testChainID})
+	a.BeginBlock(types.RequestBeginBlock{Header: types.Header{ChainID: testChainID, Time: time.Now().Unix()}})
+
+	mnemonic := "abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon about"
+	key, encKey, err := client.DeriveAccountKeys(crypto.KeyTypeEd25519, mnemonic, "secret", "m/44'/0'/1'")
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	again, _, _ := client.DeriveAccountKeys(crypto.KeyTypeEd25519, mnemonic, "secret", "m/44'/0'/1'")
+	if again.GetPrivString() != key.GetPrivString() || encKey.GetPubString() == key.GetPubString() {
+		t.Fatalf("keys are not derived deterministically and separately")
+	}
+	// Only public keys are posted in signed transaction
+	acc := &state.Account{
+		ID:         "1",
+		PubKey:     key.GetPubString(),
+		KeyType:    string(key.Type()),
+		EncPubKey:  encKey.GetPubString(),
+		EncKeyType: string(encKey.Type()),
+	}
+	tx, err := client.NewBuilder(key, acc.ID, testChainID, 0).AddAccount(acc)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	deliver(t, a, tx)
+	if _, _, err := client.DeriveAccountKeys(crypto.KeyTypeEd25519, "", "", "m/44'/0'/1'"); err == nil {
+		t.Fatalf("keys were derived without mnemonic")
+	}
+}
@@ -0,0 +1,100 @@
+/*
+ * Copyright (C) 2018 eeonevision
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy of
+ * this software and associated documentation files (the "Software"), to deal in
+ * the Software without restriction, including without limitation the rights to
+ * use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+ * the Software, and to permit persons to whom the Software is furnished to do so,
+ * subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+ * FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+ * COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+ * IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+ * CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ */
+package tests
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/eeonevision/anychaindb/client"
+	"github.com/eeonevision/anychaindb/state"
+	"github.com/globalsign/mgo/bson"
+	"github.com/tendermint/tendermint/abci/types"
+)
+
+// bsonStore passes loaded payloads through BSON encoding
+// like MongoDB storage does.
+type bsonStore struct {
+	state.Store
+}
+
+func (s *bsonStore) GetPayload(id string) (*state.Payload, error) {
+	data, err := s.Store.GetPayload(id)
+	if err != nil {
+		return nil, err
+	}
+	bs, err := bson.Marshal(data)
+	if err != nil {
+		return nil, err
+	}
+	loaded := &state.Payload{}
+	return loaded, bson.Unmarshal(bs, loaded)
+}
+
+func TestVerifyQueryProofAfterBSON(t *testing.T) {
+	s, err := state.NewState(&bsonStore{state.NewMemoryStore()})
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	s.SetChainID(testChainID)
+	data := &state.Payload{
+		ID:              "payload",
+		SenderAccountID: "sender",
+		PublicData:      map[string]interface{}{"name": "test", "tags": []interface{}{}},
+		CreatedAt:       1,
+	}
+	if err := s.AddPayload(data); err != nil {
+		t.Fatalf("%s", err)
+	}
+	appHash, err := s.Commit(1)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	obj, proof, err := s.ProvePayload(data.ID)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	if obj.PrivateData == nil {
+		t.Fatalf("private data was not loaded as empty array")
+	}
+	value, err := state.CanonicalJSON(obj)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	proofBytes, err := json.Marshal(proof)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	key := state.PayloadKey(data.ID)
+	res := &types.ResponseQuery{Key: []byte(key), Value: value, Proof: proofBytes, Height: 1}
+	if err := client.VerifyQueryProof(key, res, appHash); err != nil {
+		t.Fatalf("proof of payload loaded from BSON was not verified: %s", err)
+	}
+	res.Value, _ = json.Marshal(obj)
+	if err := client.VerifyQueryProof(key, res, appHash); err != nil {
+		t.Errorf("proof of not canonical value was not verified: %s", err)
+	}
+	obj.PublicData = map[string]interface{}{"name": "forged"}
+	res.Value, _ = json.Marshal(obj)
+	if err := client.VerifyQueryProof(key, res, appHash); err == nil {
+		t.Errorf("proof of forged value was verified")
+	}
+}
@@ -37,9 +37,12 @@ func main() {
 	// Parse CLI arguments
 	addrPtr := flag.String("addr", "tcp://localhost:26658", "Listen address")
 	abciPtr := flag.String("abci", "socket", "socket | grpc")
-	dbHost := flag.String("dbhost", "localhost", "database host path")
+	dbBackend := flag.String("db", "mongodb", "state storage backend: mongodb | leveldb | memory")
+	dbHost := flag.String("dbhost", "localhost", "database host path (directory for leveldb)")
 	dbName := flag.String("dbname", "anychaindb", "database name")
 	logLevel := flag.String("loglevel", "*:info", "log level for abci modules: abci-app:info,abci-server:info,*:error")
+	txWindow := flag.Duration("txwindow", labci.DefaultTxTimeWindow, "allowed difference between tx timestamp and block time, 0 disables check")
+	unsignedAccounts := flag.Int64("unsignedaccounts", 0, "height below which unsigned legacy AccountAdd txs are accepted")
 	flag.Parse()
 
 	logger := log.NewTMLogger(log.NewSyncWriter(os.Stdout))
@@ -48,8 +51,10 @@ func main() {
 		panic(err)
 	}
 
-	app := labci.NewPersistentApplication(*dbHost, *dbName)
+	app := labci.NewPersistentApplication(*dbBackend, *dbHost, *dbName)
 	app.SetLogger(logger.With("module", "abci-app"))
+	app.SetTxTimeWindow(*txWindow)
+	app.SetUnsignedAccountsHeight(*unsignedAccounts)
 
 	// Start the listener
 	srv, err := server.NewServer(*addrPtr, *abciPtr, app)
@@ -26,6 +26,8 @@ import (
 	"os"
 
 	lapi "github.com/eeonevision/anychaindb/api"
+	"github.com/eeonevision/anychaindb/api/handler"
+	"github.com/eeonevision/anychaindb/client"
 	tmflags "github.com/tendermint/tendermint/libs/cli/flags"
 	"github.com/tendermint/tendermint/libs/log"
 )
@@ -36,19 +38,65 @@ func main() {
 	ipPtr := flag.String("ip", "localhost", "Listen host ip")
 	portPtr := flag.String("port", "26659", "Listen host port")
 	logLevel := flag.String("loglevel", "*:info", "log level for anychaindb api module: rest-api:info")
+	genesisPtr := flag.String("genesis", "", "Path to genesis file with trusted validators, enables verification of query proofs")
+	tokenSecretPtr := flag.String("token-secret", "", "Secret, which signs session tokens, random by default")
+	readLimitsPtr := flag.String("read-limits", "", "Rate limits of read requests per second with burst: apikey=50:100,ip=10:20,account=5:10")
+	writeLimitsPtr := flag.String("write-limits", "", "Rate limits of write requests per second with burst: apikey=10:20,ip=1:5,account=1:5")
+	requireAPIKeyPtr := flag.Bool("require-api-key", false, "Accept write requests only with valid API key")
+	adminKeyPtr := flag.String("admin-key", "", "Admin key, which authorizes issuance of API keys, issuance is disabled by default")
+	apiKeysPtr := flag.String("api-keys", "", "Path to file with issued API keys")
+	basicAuthPtr := flag.Bool("basic-auth", true, "Accept private keys in basic authorization of read requests, deprecated in favor of session tokens")
 	flag.Parse()
 
 	// Create server
 	api := lapi.NewHTTPServer(*endpointPtr, *ipPtr, *portPtr)
 
+	// Enable proof verification
+	if *genesisPtr != "" {
+		chainID, validators, err := client.TrustedValidatorsFromGenesis(*genesisPtr)
+		if err != nil {
+			panic(err)
+		}
+		handler.SetClientOptions(client.WithProofVerification(chainID, validators))
+	}
+
+	// Share session tokens between servers
+	if *tokenSecretPtr != "" {
+		handler.SetTokenSecret([]byte(*tokenSecretPtr))
+	}
+
+	// Configure API keys and rate limits
+	readLimits, err := handler.ParseLimits(*readLimitsPtr)
+	if err != nil {
+		panic(err)
+	}
+	writeLimits, err := handler.ParseLimits(*writeLimitsPtr)
+	if err != nil {
+		panic(err)
+	}
+	handler.SetRateLimits(readLimits, writeLimits)
+	handler.SetRequireAPIKey(*requireAPIKeyPtr)
+	handler.SetAdminKey(*adminKeyPtr)
+	if *apiKeysPtr != "" {
+		if err := handler.LoadAPIKeys(*apiKeysPtr); err != nil {
+			panic(err)
+		}
+	}
+
 	// Define logger
 	logger := log.NewTMLogger(log.NewSyncWriter(os.Stdout))
-	logger, err := tmflags.ParseLogLevel(*logLevel, logger, "info")
+	logger, err = tmflags.ParseLogLevel(*logLevel, logger, "info")
 	if err != nil {
 		panic(err)
 	}
 	api.SetLogger(logger.With("module", "rest-api"))
 
+	// Private keys in basic authorization are deprecated
+	handler.SetAllowBasicAuth(*basicAuthPtr)
+	if *basicAuthPtr {
+		logger.Info("Basic authorization by private key is deprecated, disable it by -basic-auth=false")
+	}
+
 	// Start listener
 	api.Serve()
 }
@@ -0,0 +1,364 @@
+/*
+ * Copyright (C) 2018 eeonevision
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy of
+ * this software and associated documentation files (the "Software"), to deal in
+ * the Software without restriction, including without limitation the rights to
+ * use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+ * the Software, and to permit persons to whom the Software is furnished to do so,
+ * subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+ * FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+ * COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+ * IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+ * CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ */
+
+package crypto
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"math/big"
+
+	"github.com/btcsuite/btcd/btcec"
+	"github.com/tendermint/ed25519"
+)
+
+var (
+	oidPublicKeyEC      = asn1.ObjectIdentifier{1, 2, 840, 10045, 2, 1}
+	oidPublicKeyEd25519 = asn1.ObjectIdentifier{1, 3, 101, 112}
+	oidCurveP256        = asn1.ObjectIdentifier{1, 2, 840, 10045, 3, 1, 7}
+	oidCurveSecp256k1   = asn1.ObjectIdentifier{1, 3, 132, 0, 10}
+)
+
+type algorithmIdentifier struct {
+	Algorithm  asn1.ObjectIdentifier
+	Parameters asn1.RawValue `asn1:"optional"`
+}
+
+// subjectPublicKeyInfo is SPKI structure of RFC 5280.
+type subjectPublicKeyInfo struct {
+	Algorithm algorithmIdentifier
+	PublicKey asn1.BitString
+}
+
+// privateKeyInfo is PKCS#8 structure of RFC 5208.
+type privateKeyInfo struct {
+	Version    int
+	Algorithm  algorithmIdentifier
+	PrivateKey []byte
+}
+
+// ecPrivateKey is SEC1 structure of RFC 5915, which is kept in PKCS#8 of EC keys.
+type ecPrivateKey struct {
+	Version       int
+	PrivateKey    []byte
+	NamedCurveOID asn1.ObjectIdentifier `asn1:"optional,explicit,tag:0"`
+	PublicKey     asn1.BitString        `asn1:"optional,explicit,tag:1"`
+}
+
+// jsonWebKey is JWK structure of RFC 7517 for EC and OKP keys.
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y,omitempty"`
+	D   string `json:"d,omitempty"`
+}
+
+// MarshalPublicPEM method encodes public key as SPKI "PUBLIC KEY" PEM block.
+func (k *Key) MarshalPublicPEM() ([]byte, error) {
+	alg, err := k.algorithmIdentifier()
+	if err != nil {
+		return nil, err
+	}
+	pub, err := k.rawPublic()
+	if err != nil {
+		return nil, err
+	}
+	der, err := asn1.Marshal(subjectPublicKeyInfo{
+		Algorithm: alg,
+		PublicKey: asn1.BitString{Bytes: pub, BitLength: 8 * len(pub)},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}), nil
+}
+
+// MarshalPrivatePEM method encodes private key as PKCS#8 "PRIVATE KEY" PEM block.
+func (k *Key) MarshalPrivatePEM() ([]byte, error) {
+	alg, err := k.algorithmIdentifier()
+	if err != nil {
+		return nil, err
+	}
+	var inner []byte
+	if k.Type() == KeyTypeEd25519 {
+		if k.edPriv == nil {
+			return nil, errors.New("failed to initialize private key")
+		}
+		inner, err = asn1.Marshal(k.edPriv[:32])
+	} else {
+		if k.priv == nil {
+			return nil, errors.New("failed to initialize private key")
+		}
+		pub, _ := k.rawPublic()
+		inner, err = asn1.Marshal(ecPrivateKey{
+			Version:    1,
+			PrivateKey: k.priv.D.FillBytes(make([]byte, k.coordSize())),
+			PublicKey:  asn1.BitString{Bytes: pub, BitLength: 8 * len(pub)},
+		})
+	}
+	if err != nil {
+		return nil, err
+	}
+	der, err := asn1.Marshal(privateKeyInfo{Algorithm: alg, PrivateKey: inner})
+	if err != nil {
+		return nil, err
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), nil
+}
+
+// ParsePEM function decodes key from SPKI "PUBLIC KEY" or PKCS#8 "PRIVATE KEY"
+// PEM block. Public key of private key is derived from it.
+func ParsePEM(data []byte) (*Key, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM block found")
+	}
+	switch block.Type {
+	case "PUBLIC KEY":
+		var spki subjectPublicKeyInfo
+		if rest, err := asn1.Unmarshal(block.Bytes, &spki); err != nil || len(rest) > 0 {
+			return nil, errors.New("invalid public key")
+		}
+		keyType, err := keyTypeOf(spki.Algorithm)
+		if err != nil {
+			return nil, err
+		}
+		return newFromRaw(keyType, spki.PublicKey.RightAlign(), nil)
+	case "PRIVATE KEY":
+		var info privateKeyInfo
+		if rest, err := asn1.Unmarshal(block.Bytes, &info); err != nil || len(rest) > 0 {
+			return nil, errors.New("invalid private key")
+		}
+		keyType, err := keyTypeOf(info.Algorithm)
+		if err != nil {
+			return nil, err
+		}
+		var priv []byte
+		if keyType == KeyTypeEd25519 {
+			_, err = asn1.Unmarshal(info.PrivateKey, &priv)
+		} else {
+			var ecPriv ecPrivateKey
+			_, err = asn1.Unmarshal(info.PrivateKey, &ecPriv)
+			priv = ecPriv.PrivateKey
+		}
+		if err != nil {
+			return nil, errors.New("invalid private key")
+		}
+		return newFromRaw(keyType, nil, priv)
+	}
+	return nil, errors.New("unsupported PEM block type " + block.Type)
+}
+
+// MarshalJWK method encodes key as JSON Web Key. Private part is
+// included only if includePrivate is set.
+func (k *Key) MarshalJWK(includePrivate bool) ([]byte, error) {
+	pub, err := k.rawPublic()
+	if err != nil {
+		return nil, err
+	}
+	enc := base64.RawURLEncoding
+	jwk := jsonWebKey{}
+	switch k.Type() {
+	case KeyTypeEd25519:
+		jwk.Kty, jwk.Crv, jwk.X = "OKP", "Ed25519", enc.EncodeToString(pub)
+	default:
+		jwk.Kty, jwk.Crv = "EC", "P-256"
+		if k.Type() == KeyTypeSecp256k1 {
+			jwk.Crv = "secp256k1"
+		}
+		size := k.coordSize()
+		jwk.X = enc.EncodeToString(pub[1 : 1+size])
+		jwk.Y = enc.EncodeToString(pub[1+size:])
+	}
+	if includePrivate {
+		priv, err := k.rawPrivate()
+		if err != nil {
+			return nil, err
+		}
+		jwk.D = enc.EncodeToString(priv)
+	}
+	return json.Marshal(jwk)
+}
+
+// ParseJWK function decodes key from JSON Web Key. Key with "d" parameter
+// is decoded as key pair, otherwise as public key.
+func ParseJWK(data []byte) (*Key, error) {
+	var jwk jsonWebKey
+	if err := json.Unmarshal(data, &jwk); err != nil {
+		return nil, err
+	}
+	var keyType KeyType
+	switch {
+	case jwk.Kty == "EC" && jwk.Crv == "P-256":
+		keyType = KeyTypeP256
+	case jwk.Kty == "EC" && jwk.Crv == "secp256k1":
+		keyType = KeyTypeSecp256k1
+	case jwk.Kty == "OKP" && jwk.Crv == "Ed25519":
+		keyType = KeyTypeEd25519
+	default:
+		return nil, errors.New("unsupported JWK key " + jwk.Kty + "/" + jwk.Crv)
+	}
+	enc := base64.RawURLEncoding
+	x, err := enc.DecodeString(jwk.X)
+	if err != nil {
+		return nil, errors.New("invalid JWK x parameter")
+	}
+	pub := x
+	if keyType != KeyTypeEd25519 {
+		y, err := enc.DecodeString(jwk.Y)
+		if err != nil || len(x) != 32 || len(y) != 32 {
+			return nil, errors.New("invalid JWK coordinates")
+		}
+		pub = append(append([]byte{4}, x...), y...)
+	}
+	var priv []byte
+	if jwk.D != "" {
+		if priv, err = enc.DecodeString(jwk.D); err != nil {
+			return nil, errors.New("invalid JWK d parameter")
+		}
+	}
+	return newFromRaw(keyType, pub, priv)
+}
+
+// newFromRaw function builds key of given type from raw public key and/or
+// private key. If both are given, they should match each other.
+func newFromRaw(keyType KeyType, pub, priv []byte) (*Key, error) {
+	var k *Key
+	if priv != nil {
+		switch keyType {
+		case KeyTypeEd25519:
+			if len(priv) != 32 {
+				return nil, errors.New("invalid private key")
+			}
+			k = &Key{typ: keyType, edPriv: new([ed25519.PrivateKeySize]byte)}
+			copy(k.edPriv[:], priv)
+			k.edPub = ed25519.MakePublicKey(k.edPriv)
+			copy(k.edPriv[32:], k.edPub[:])
+		default:
+			curve := curveOf(keyType)
+			d := new(big.Int).SetBytes(priv)
+			if d.Sign() == 0 || d.Cmp(curve.Params().N) >= 0 {
+				return nil, errors.New("invalid private key")
+			}
+			ecPriv := &ecdsa.PrivateKey{D: d}
+			ecPriv.Curve = curve
+			ecPriv.X, ecPriv.Y = curve.ScalarBaseMult(priv)
+			k = &Key{typ: keyType, priv: ecPriv, pub: &ecPriv.PublicKey}
+		}
+		if pub != nil {
+			derived, _ := k.rawPublic()
+			if string(derived) != string(pub) {
+				return nil, errors.New("public key does not match private key")
+			}
+		}
+		return k, nil
+	}
+	encoded := base64.StdEncoding.EncodeToString(pub)
+	if keyType != KeyTypeP256 {
+		encoded = encodeKey(keyType, pub)
+	}
+	k = &Key{typ: keyType}
+	if err := k.SetPubString(encoded); err != nil {
+		return nil, err
+	}
+	return k, nil
+}
+
+func (k *Key) algorithmIdentifier() (algorithmIdentifier, error) {
+	if k.Type() == KeyTypeEd25519 {
+		return algorithmIdentifier{Algorithm: oidPublicKeyEd25519}, nil
+	}
+	curveOID := oidCurveP256
+	if k.Type() == KeyTypeSecp256k1 {
+		curveOID = oidCurveSecp256k1
+	}
+	params, err := asn1.Marshal(curveOID)
+	if err != nil {
+		return algorithmIdentifier{}, err
+	}
+	return algorithmIdentifier{Algorithm: oidPublicKeyEC, Parameters: asn1.RawValue{FullBytes: params}}, nil
+}
+
+func keyTypeOf(alg algorithmIdentifier) (KeyType, error) {
+	if alg.Algorithm.Equal(oidPublicKeyEd25519) {
+		return KeyTypeEd25519, nil
+	}
+	if !alg.Algorithm.Equal(oidPublicKeyEC) {
+		return "", errors.New("unsupported key algorithm " + alg.Algorithm.String())
+	}
+	var curveOID asn1.ObjectIdentifier
+	if _, err := asn1.Unmarshal(alg.Parameters.FullBytes, &curveOID); err != nil {
+		return "", errors.New("invalid EC parameters")
+	}
+	switch {
+	case curveOID.Equal(oidCurveP256):
+		return KeyTypeP256, nil
+	case curveOID.Equal(oidCurveSecp256k1):
+		return KeyTypeSecp256k1, nil
+	}
+	return "", errors.New("unsupported curve " + curveOID.String())
+}
+
+func curveOf(keyType KeyType) elliptic.Curve {
+	if keyType == KeyTypeSecp256k1 {
+		return btcec.S256()
+	}
+	return elliptic.P256()
+}
+
+// coordSize method returns size of coordinates and scalars of EC key.
+func (k *Key) coordSize() int {
+	return (curveOf(k.Type()).Params().BitSize + 7) / 8
+}
+
+// rawPublic method returns Ed25519 public key or uncompressed EC point.
+func (k *Key) rawPublic() ([]byte, error) {
+	if k.Type() == KeyTypeEd25519 {
+		if k.edPub == nil {
+			return nil, errors.New("failed to initialize public key")
+		}
+		return k.edPub[:], nil
+	}
+	if k.pub == nil {
+		return nil, errors.New("failed to initialize public key")
+	}
+	return elliptic.Marshal(k.pub.Curve, k.pub.X, k.pub.Y), nil
+}
+
+// rawPrivate method returns Ed25519 seed or fixed-width EC scalar.
+func (k *Key) rawPrivate() ([]byte, error) {
+	if k.Type() == KeyTypeEd25519 {
+		if k.edPriv == nil {
+			return nil, errors.New("failed to initialize private key")
+		}
+		return k.edPriv[:32], nil
+	}
+	if k.priv == nil {
+		return nil, errors.New("failed to initialize private key")
+	}
+	return k.priv.D.FillBytes(make([]byte, k.coordSize())), nil
+}
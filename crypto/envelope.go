@@ -0,0 +1,76 @@
+/*
+ * Copyright (C) 2018 eeonevision
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy of
+ * this software and associated documentation files (the "Software"), to deal in
+ * the Software without restriction, including without limitation the rights to
+ * use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+ * the Software, and to permit persons to whom the Software is furnished to do so,
+ * subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+ * FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+ * COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+ * IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+ * CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ */
+
+package crypto
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"errors"
+	"io"
+)
+
+// ContentKeySize is size of random key, which encrypts body of envelope.
+const ContentKeySize = 32
+
+// SealEnvelope encrypts body once with new random content key using AES-256-GCM
+// and returns ciphertext together with content key. Content key should be
+// wrapped for every receiver with Key.Encrypt method.
+func SealEnvelope(body []byte) (ciphertext, contentKey []byte, err error) {
+	contentKey = make([]byte, ContentKeySize)
+	if _, err = io.ReadFull(rand.Reader, contentKey); err != nil {
+		return nil, nil, err
+	}
+	aead, err := newContentCipher(contentKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err = io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, nil, err
+	}
+	return aead.Seal(nonce, nonce, body, nil), contentKey, nil
+}
+
+// OpenEnvelope decrypts and authenticates body of envelope with unwrapped content key.
+func OpenEnvelope(ciphertext, contentKey []byte) ([]byte, error) {
+	aead, err := newContentCipher(contentKey)
+	if err != nil {
+		return nil, err
+	}
+	if len(ciphertext) < aead.NonceSize()+aead.Overhead() {
+		return nil, errors.New("invalid ciphertext")
+	}
+	nonce := ciphertext[:aead.NonceSize()]
+	return aead.Open(nil, nonce, ciphertext[aead.NonceSize():], nil)
+}
+
+func newContentCipher(contentKey []byte) (cipher.AEAD, error) {
+	if len(contentKey) != ContentKeySize {
+		return nil, errors.New("invalid content key size")
+	}
+	block, err := aes.NewCipher(contentKey)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
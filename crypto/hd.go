@@ -0,0 +1,163 @@
+/*
+ * Copyright (C) 2018 eeonevision
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy of
+ * this software and associated documentation files (the "Software"), to deal in
+ * the Software without restriction, including without limitation the rights to
+ * use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+ * the Software, and to permit persons to whom the Software is furnished to do so,
+ * subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+ * FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+ * COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+ * IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+ * CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ */
+
+package crypto
+
+import (
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/sha512"
+	"encoding/binary"
+	"errors"
+	"math/big"
+	"strconv"
+	"strings"
+
+	"github.com/cosmos/go-bip39"
+)
+
+// HardenedOffset is added to index of hardened derivation step.
+const HardenedOffset uint32 = 0x80000000
+
+// NewMnemonic function generates new BIP-39 mnemonic of 24 words.
+func NewMnemonic() (string, error) {
+	entropy, err := bip39.NewEntropy(256)
+	if err != nil {
+		return "", err
+	}
+	return bip39.NewMnemonic(entropy)
+}
+
+// SeedFromMnemonic function checks BIP-39 mnemonic and returns seed for
+// key derivation, protected by optional passphrase.
+func SeedFromMnemonic(mnemonic, passphrase string) ([]byte, error) {
+	if !bip39.IsMnemonicValid(mnemonic) {
+		return nil, errors.New("invalid mnemonic")
+	}
+	return bip39.NewSeedWithErrorChecking(mnemonic, passphrase)
+}
+
+// DeriveKey function derives key pair of given type from seed by path
+// like "m/0'/1'/2" as described in SLIP-0010. Ed25519 keys support
+// hardened steps only.
+func DeriveKey(keyType KeyType, seed []byte, path string) (*Key, error) {
+	indexes, err := ParseDerivationPath(path)
+	if err != nil {
+		return nil, err
+	}
+	var curveKey string
+	switch keyType {
+	case KeyTypeP256:
+		curveKey = "Nist256p1 seed"
+	case KeyTypeSecp256k1:
+		curveKey = "Bitcoin seed"
+	case KeyTypeEd25519:
+		curveKey = "ed25519 seed"
+	default:
+		return nil, errors.New("unsupported key type " + string(keyType))
+	}
+	key, chain := slip10Master(keyType, []byte(curveKey), seed)
+	for _, index := range indexes {
+		if key, chain, err = slip10Child(keyType, key, chain, index); err != nil {
+			return nil, err
+		}
+	}
+	return newFromRaw(keyType, nil, key)
+}
+
+// ParseDerivationPath function parses path like "m/0'/1'/2" into indexes
+// of derivation steps. Hardened steps are marked by apostrophe or "h".
+func ParseDerivationPath(path string) ([]uint32, error) {
+	parts := strings.Split(path, "/")
+	if len(parts) == 0 || parts[0] != "m" {
+		return nil, errors.New("derivation path should start with m")
+	}
+	indexes := make([]uint32, 0, len(parts)-1)
+	for _, part := range parts[1:] {
+		var offset uint32
+		if strings.HasSuffix(part, "'") || strings.HasSuffix(part, "h") {
+			offset = HardenedOffset
+			part = part[:len(part)-1]
+		}
+		index, err := strconv.ParseUint(part, 10, 32)
+		if err != nil || uint32(index) >= HardenedOffset {
+			return nil, errors.New("invalid derivation path step " + part)
+		}
+		indexes = append(indexes, uint32(index)+offset)
+	}
+	return indexes, nil
+}
+
+func slip10Master(keyType KeyType, curveKey, seed []byte) (key, chain []byte) {
+	data := seed
+	for {
+		sum := hmacSHA512(curveKey, data)
+		key, chain = sum[:32], sum[32:]
+		if keyType == KeyTypeEd25519 || isValidScalar(keyType, key) {
+			return key, chain
+		}
+		data = sum
+	}
+}
+
+func slip10Child(keyType KeyType, key, chain []byte, index uint32) ([]byte, []byte, error) {
+	data := make([]byte, 0, 37)
+	if index >= HardenedOffset {
+		data = append(append(data, 0), key...)
+	} else if keyType == KeyTypeEd25519 {
+		return nil, nil, errors.New("ed25519 keys support hardened derivation only")
+	} else {
+		curve := curveOf(keyType)
+		x, y := curve.ScalarBaseMult(key)
+		data = append(data, elliptic.MarshalCompressed(curve, x, y)...)
+	}
+	var ser [4]byte
+	binary.BigEndian.PutUint32(ser[:], index)
+	data = append(data, ser[:]...)
+	for {
+		sum := hmacSHA512(chain, data)
+		if keyType == KeyTypeEd25519 {
+			return sum[:32], sum[32:], nil
+		}
+		n := curveOf(keyType).Params().N
+		child := new(big.Int).SetBytes(sum[:32])
+		if child.Cmp(n) < 0 {
+			child.Add(child, new(big.Int).SetBytes(key))
+			child.Mod(child, n)
+			if child.Sign() != 0 {
+				return child.FillBytes(make([]byte, 32)), sum[32:], nil
+			}
+		}
+		// Invalid key is skipped by derivation from the right half of hash
+		data = append(append([]byte{1}, sum[32:]...), data[len(data)-4:]...)
+	}
+}
+
+func isValidScalar(keyType KeyType, key []byte) bool {
+	k := new(big.Int).SetBytes(key)
+	return k.Sign() > 0 && k.Cmp(curveOf(keyType).Params().N) < 0
+}
+
+func hmacSHA512(key, data []byte) []byte {
+	mac := hmac.New(sha512.New, key)
+	mac.Write(data)
+	return mac.Sum(nil)
+}
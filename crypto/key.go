@@ -1,7 +1,9 @@
 package crypto
 
 import (
+	"bytes"
 	"crypto/aes"
+	"crypto/cipher"
 	"crypto/ecdsa"
 	"crypto/elliptic"
 	"crypto/hmac"
@@ -10,30 +12,102 @@ import (
 	"crypto/sha256"
 	"encoding/base64"
 	"errors"
+	"io"
 	"math/big"
 	"strings"
 
+	"github.com/btcsuite/btcd/btcec"
 	"github.com/cloudflare/redoctober/padding"
 	"github.com/cloudflare/redoctober/symcrypt"
+	"github.com/tendermint/ed25519"
+	"github.com/tendermint/ed25519/extra25519"
+	"golang.org/x/crypto/curve25519"
 )
 
+// Curve is the curve of P-256 keys. Legacy ciphertexts are always encrypted with it.
 var Curve = elliptic.P256
 
+// KeyType identifies algorithm of key pair. It is used as prefix of string
+// encodings of keys, e.g. "ed25519:<base64>". P-256 keys are encoded without
+// prefix for compatibility with existing accounts.
+type KeyType string
+
+const (
+	// KeyTypeP256 is ECDSA and ECDH key over NIST P-256 curve.
+	KeyTypeP256 KeyType = "p256"
+	// KeyTypeSecp256k1 is ECDSA and ECDH key over secp256k1 curve.
+	KeyTypeSecp256k1 KeyType = "secp256k1"
+	// KeyTypeEd25519 is Ed25519 signing key, which is converted to X25519 for ECDH.
+	KeyTypeEd25519 KeyType = "ed25519"
+)
+
+const (
+	// CiphertextV1 is version byte of ciphertexts produced by Key.Encrypt.
+	// Legacy ciphertexts start with length of ephemeral key, which is
+	// never equal to it.
+	CiphertextV1 byte = 0x01
+	// AlgECDHP256AES256GCM identifies ECDH over P-256 with HKDF-SHA256
+	// key derivation and AES-256-GCM encryption.
+	AlgECDHP256AES256GCM byte = 0x01
+	// AlgECDHSecp256k1AES256GCM identifies ECDH over secp256k1 with HKDF-SHA256
+	// key derivation and AES-256-GCM encryption.
+	AlgECDHSecp256k1AES256GCM byte = 0x02
+	// AlgX25519AES256GCM identifies X25519 with HKDF-SHA256 key derivation
+	// and AES-256-GCM encryption.
+	AlgX25519AES256GCM byte = 0x03
+
+	hkdfInfoV1 = "anychaindb/ecies/v1"
+)
+
 type Key struct {
-	pub  *ecdsa.PublicKey
-	priv *ecdsa.PrivateKey
+	typ    KeyType
+	pub    *ecdsa.PublicKey
+	priv   *ecdsa.PrivateKey
+	edPub  *[ed25519.PublicKeySize]byte
+	edPriv *[ed25519.PrivateKeySize]byte
 }
 
+// CreateKeyPair function generates new P-256 key pair.
 func CreateKeyPair() (*Key, error) {
-	priv, err := ecdsa.GenerateKey(Curve(), rand.Reader)
-	if err != nil {
-		return nil, err
+	return CreateKeyPairOfType(KeyTypeP256)
+}
+
+// CreateKeyPairOfType function generates new key pair of given type.
+func CreateKeyPairOfType(keyType KeyType) (*Key, error) {
+	switch keyType {
+	case KeyTypeP256:
+		priv, err := ecdsa.GenerateKey(Curve(), rand.Reader)
+		if err != nil {
+			return nil, err
+		}
+		return &Key{typ: keyType, priv: priv, pub: &priv.PublicKey}, nil
+	case KeyTypeSecp256k1:
+		priv, err := btcec.NewPrivateKey(btcec.S256())
+		if err != nil {
+			return nil, err
+		}
+		ecPriv := priv.ToECDSA()
+		return &Key{typ: keyType, priv: ecPriv, pub: &ecPriv.PublicKey}, nil
+	case KeyTypeEd25519:
+		pub, priv, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			return nil, err
+		}
+		return &Key{typ: keyType, edPub: pub, edPriv: priv}, nil
 	}
-	return &Key{priv: priv, pub: &priv.PublicKey}, nil
+	return nil, errors.New("unsupported key type " + string(keyType))
 }
 
+// NewFromStrings function builds key from string encodings of public and
+// private keys. Type of key is taken from prefix of encodings.
 func NewFromStrings(pub, priv string) (*Key, error) {
-	k := &Key{}
+	return NewFromTypedStrings("", pub, priv)
+}
+
+// NewFromTypedStrings function builds key of given type from string encodings
+// of public and private keys. Empty type means type from prefix of encodings.
+func NewFromTypedStrings(keyType KeyType, pub, priv string) (*Key, error) {
+	k := &Key{typ: keyType}
 	if pub == "" && priv == "" {
 		return nil, errors.New("no key material supplied")
 	}
@@ -53,130 +127,290 @@ func NewFromStrings(pub, priv string) (*Key, error) {
 	return k, nil
 }
 
+// Type method returns type of key.
+func (k *Key) Type() KeyType {
+	if k.typ == "" {
+		return KeyTypeP256
+	}
+	return k.typ
+}
+
 func (k *Key) GetPubString() string {
+	switch k.Type() {
+	case KeyTypeSecp256k1:
+		return encodeKey(k.typ, (*btcec.PublicKey)(k.pub).SerializeCompressed())
+	case KeyTypeEd25519:
+		return encodeKey(k.typ, k.edPub[:])
+	}
 	pub := elliptic.Marshal(elliptic.P256(), k.pub.X, k.pub.Y)
 	return base64.StdEncoding.EncodeToString(pub)
 }
 
 func (k *Key) GetPrivString() string {
+	switch k.Type() {
+	case KeyTypeSecp256k1:
+		return encodeKey(k.typ, (*btcec.PrivateKey)(k.priv).Serialize())
+	case KeyTypeEd25519:
+		return encodeKey(k.typ, k.edPriv[:])
+	}
 	priv := k.priv.D.Bytes()
 	return base64.StdEncoding.EncodeToString(priv)
 }
 
 func (k *Key) SetPubString(pub string) error {
-	bs, err := base64.StdEncoding.DecodeString(pub)
+	raw, err := k.decodeKey(pub)
 	if err != nil {
 		return err
 	}
-	x, y := elliptic.Unmarshal(elliptic.P256(), bs)
+	switch k.typ {
+	case KeyTypeSecp256k1:
+		pk, err := btcec.ParsePubKey(raw, btcec.S256())
+		if err != nil {
+			return err
+		}
+		k.pub = pk.ToECDSA()
+		return nil
+	case KeyTypeEd25519:
+		if len(raw) != ed25519.PublicKeySize {
+			return errors.New("invalid public key")
+		}
+		k.edPub = new([ed25519.PublicKeySize]byte)
+		copy(k.edPub[:], raw)
+		return nil
+	}
+	x, y := elliptic.Unmarshal(elliptic.P256(), raw)
+	if x == nil {
+		return errors.New("invalid public key")
+	}
 	k.pub = &ecdsa.PublicKey{Curve: elliptic.P256(), X: x, Y: y}
 	return nil
 }
 
 func (k *Key) SetPrivString(priv string) error {
-	bs, err := base64.StdEncoding.DecodeString(priv)
+	raw, err := k.decodeKey(priv)
 	if err != nil {
 		return err
 	}
+	if k.typ == KeyTypeEd25519 {
+		// Both 64-byte private key and its 32-byte seed are accepted
+		if len(raw) != ed25519.PrivateKeySize && len(raw) != 32 {
+			return errors.New("invalid private key")
+		}
+		k.edPriv = new([ed25519.PrivateKeySize]byte)
+		copy(k.edPriv[:], raw[:32])
+		k.edPub = ed25519.MakePublicKey(k.edPriv)
+		copy(k.edPriv[32:], k.edPub[:])
+		return nil
+	}
+	if k.pub == nil {
+		return errors.New("no pubkey to privkey supplied")
+	}
 	d := &big.Int{}
-	d.SetBytes(bs)
+	d.SetBytes(raw)
 	k.priv = &ecdsa.PrivateKey{D: d, PublicKey: *k.pub}
 	k.pub = &k.priv.PublicKey
 	return nil
 }
 
+// decodeKey method strips type prefix of encoded key, checks that it matches
+// type of key and returns decoded bytes.
+func (k *Key) decodeKey(s string) ([]byte, error) {
+	keyType, encoded := KeyTypeP256, s
+	if i := strings.Index(s, ":"); i >= 0 {
+		keyType, encoded = KeyType(s[:i]), s[i+1:]
+	}
+	switch keyType {
+	case KeyTypeP256, KeyTypeSecp256k1, KeyTypeEd25519:
+	default:
+		return nil, errors.New("unsupported key type " + string(keyType))
+	}
+	if k.typ == "" {
+		k.typ = keyType
+	} else if k.typ != keyType {
+		return nil, errors.New("key type " + string(keyType) + " does not match " + string(k.typ))
+	}
+	return base64.StdEncoding.DecodeString(encoded)
+}
+
+func encodeKey(keyType KeyType, raw []byte) string {
+	return string(keyType) + ":" + base64.StdEncoding.EncodeToString(raw)
+}
+
+// Sign method signs hash by private key. ECDSA signatures are deterministic
+// (RFC 6979) with S in the lower half of curve order, they are encoded as
+// fixed-width concatenation of R and S in base64. Ed25519 signatures are
+// encoded in base64.
 func (k *Key) Sign(hash []byte) (string, error) {
+	if k.Type() == KeyTypeEd25519 {
+		if k.edPriv == nil {
+			return "", errors.New("failed to initialize private key")
+		}
+		sig := ed25519.Sign(k.edPriv, hash)
+		return base64.StdEncoding.EncodeToString(sig[:]), nil
+	}
 	if k.priv == nil {
 		return "", errors.New("failed to initialize private key")
 	}
-	r, s, err := ecdsa.Sign(rand.Reader, k.priv, hash)
+	r, s, err := signDeterministic(k.priv, hash)
 	if err != nil {
 		return "", err
 	}
-	rStr := base64.StdEncoding.EncodeToString(r.Bytes())
-	sStr := base64.StdEncoding.EncodeToString(s.Bytes())
-	return rStr + ":" + sStr, nil
+	size := (k.priv.Curve.Params().N.BitLen() + 7) / 8
+	sig := make([]byte, 2*size)
+	r.FillBytes(sig[:size])
+	s.FillBytes(sig[size:])
+	return base64.StdEncoding.EncodeToString(sig), nil
 }
 
+// Verify method checks signature of hash by public key. Only canonical
+// encodings of signatures, which are produced by Sign method, are accepted,
+// so signature can't be changed without invalidating it.
 func (k *Key) Verify(hash []byte, signature string) error {
-	parts := strings.Split(signature, ":")
-	if len(parts) != 2 {
-		return errors.New("malformed signature")
-	}
-	rBytes, err := base64.StdEncoding.DecodeString(parts[0])
+	sig, err := base64.StdEncoding.DecodeString(signature)
 	if err != nil {
 		return err
 	}
-	sBytes, err := base64.StdEncoding.DecodeString(parts[1])
-	if err != nil {
-		return err
+	if base64.StdEncoding.EncodeToString(sig) != signature {
+		return errors.New("non-canonical signature encoding")
+	}
+	if k.Type() == KeyTypeEd25519 {
+		if len(sig) != ed25519.SignatureSize {
+			return errors.New("malformed signature")
+		}
+		if !isCanonicalEd25519S(sig[32:]) {
+			return errors.New("non-canonical signature")
+		}
+		edSig := new([ed25519.SignatureSize]byte)
+		copy(edSig[:], sig)
+		if !ed25519.Verify(k.edPub, hash, edSig) {
+			return errors.New("bad signature")
+		}
+		return nil
+	}
+	n := k.pub.Curve.Params().N
+	size := (n.BitLen() + 7) / 8
+	if len(sig) != 2*size {
+		return errors.New("malformed signature")
+	}
+	r := (&big.Int{}).SetBytes(sig[:size])
+	s := (&big.Int{}).SetBytes(sig[size:])
+	if isHighS(s, n) {
+		return errors.New("non-canonical signature")
 	}
-	r := (&big.Int{}).SetBytes(rBytes)
-	s := (&big.Int{}).SetBytes(sBytes)
 	if !ecdsa.Verify(k.pub, hash, r, s) {
 		return errors.New("bad signature")
 	}
 	return nil
 }
 
+// ed25519Order is order of Ed25519 base point.
+var ed25519Order, _ = new(big.Int).SetString("7237005577332262213973186563042994240857116359379907606001950938285454250989", 10)
+
+// isCanonicalEd25519S function checks that little-endian S of Ed25519 signature
+// is less than group order, otherwise S + order would be valid too.
+func isCanonicalEd25519S(s []byte) bool {
+	be := make([]byte, len(s))
+	for i := range s {
+		be[len(s)-1-i] = s[i]
+	}
+	return new(big.Int).SetBytes(be).Cmp(ed25519Order) < 0
+}
+
 // Encrypt secures and authenticates its input using the public key
-// using ECDHE with AES-128-CBC-HMAC-SHA1.
+// using ECDHE (X25519 for Ed25519 keys) with HKDF-SHA256 and AES-256-GCM.
+// Output starts with version and algorithm identifier, see CiphertextV1.
 func (k *Key) Encrypt(in []byte) (out []byte, err error) {
-	ephemeral, err := ecdsa.GenerateKey(Curve(), rand.Reader)
-	if err != nil {
-		return
+	var ephPub, secret []byte
+	if k.Type() == KeyTypeEd25519 {
+		ephPub, secret, err = k.ephemeralX25519()
+	} else {
+		ephPub, secret, err = k.ephemeralECDH()
 	}
-	x, _ := k.pub.Curve.ScalarMult(k.pub.X, k.pub.Y, ephemeral.D.Bytes())
-	if x == nil {
-		return nil, errors.New("failed to generate encryption key")
-	}
-	shared := sha256.Sum256(x.Bytes())
-	iv, err := symcrypt.MakeRandom(16)
 	if err != nil {
 		return
 	}
+	header := make([]byte, 3, 3+len(ephPub))
+	header[0] = CiphertextV1
+	header[1] = k.alg()
+	header[2] = byte(len(ephPub))
+	header = append(header, ephPub...)
 
-	paddedIn := padding.AddPadding(in)
-	ct, err := symcrypt.EncryptCBC(paddedIn, iv, shared[:16])
+	aead, err := k.newSharedCipher(secret, header)
 	if err != nil {
 		return
 	}
-
-	ephPub := elliptic.Marshal(k.pub.Curve, ephemeral.PublicKey.X, ephemeral.PublicKey.Y)
-	out = make([]byte, 1+len(ephPub)+16)
-	out[0] = byte(len(ephPub))
-	copy(out[1:], ephPub)
-	copy(out[1+len(ephPub):], iv)
-	out = append(out, ct...)
-
-	h := hmac.New(sha1.New, shared[16:])
-	h.Write(iv)
-	h.Write(ct)
-	out = h.Sum(out)
+	nonce := make([]byte, aead.NonceSize())
+	if _, err = io.ReadFull(rand.Reader, nonce); err != nil {
+		return
+	}
+	out = append(header, nonce...)
+	out = aead.Seal(out, nonce, in, header)
 	return
 }
 
 // Decrypt authentications and recovers the original message from
 // its input using the private key and the ephemeral key included in
-// the message.
+// the message. Both versioned and legacy AES-128-CBC-HMAC-SHA1 formats
+// are supported.
 func (k *Key) Decrypt(in []byte) (out []byte, err error) {
+	if k.priv == nil && k.edPriv == nil {
+		return nil, errors.New("failed to initialize private key")
+	}
+	if len(in) == 0 {
+		return nil, errors.New("invalid ciphertext")
+	}
+	if in[0] == CiphertextV1 {
+		return k.decryptV1(in)
+	}
+	if k.Type() != KeyTypeP256 {
+		return nil, errors.New("unsupported encryption algorithm")
+	}
+	return k.decryptLegacy(in)
+}
+
+func (k *Key) decryptV1(in []byte) ([]byte, error) {
+	if len(in) < 3 || len(in) < 3+int(in[2]) {
+		return nil, errors.New("invalid ciphertext")
+	}
+	if in[1] != k.alg() {
+		return nil, errors.New("unsupported encryption algorithm")
+	}
+	header := in[:3+int(in[2])]
+	secret, err := k.sharedSecret(header[3:])
+	if err != nil {
+		return nil, err
+	}
+	aead, err := k.newSharedCipher(secret, header)
+	if err != nil {
+		return nil, err
+	}
+	body := in[len(header):]
+	if len(body) < aead.NonceSize()+aead.Overhead() {
+		return nil, errors.New("invalid ciphertext")
+	}
+	out, err := aead.Open(nil, body[:aead.NonceSize()], body[aead.NonceSize():], header)
+	if err != nil {
+		return nil, errors.New("invalid ciphertext")
+	}
+	return out, nil
+}
+
+func (k *Key) decryptLegacy(in []byte) (out []byte, err error) {
+	if len(in) < 1+int(in[0]) {
+		return nil, errors.New("invalid ciphertext")
+	}
 	ephLen := int(in[0])
 	ephPub := in[1 : 1+ephLen]
 	ct := in[1+ephLen:]
-	if len(ct) < (sha1.Size + aes.BlockSize) {
+	if len(ct) < (sha1.Size+2*aes.BlockSize) || (len(ct)-sha1.Size)%aes.BlockSize != 0 {
 		return nil, errors.New("invalid ciphertext")
 	}
 
-	x, y := elliptic.Unmarshal(Curve(), ephPub)
-	if x == nil {
-		return nil, errors.New("invalid public key")
-	}
-
-	x, _ = k.priv.Curve.ScalarMult(x, y, k.priv.D.Bytes())
-	if x == nil {
-		return nil, errors.New("failed to generate encryption key")
+	x, err := k.sharedSecret(ephPub)
+	if err != nil {
+		return
 	}
-	shared := sha256.Sum256(x.Bytes())
+	shared := sha256.Sum256(bytes.TrimLeft(x, "\x00"))
 
 	tagStart := len(ct) - sha1.Size
 	h := hmac.New(sha1.New, shared[16:])
@@ -193,3 +427,112 @@ func (k *Key) Decrypt(in []byte) (out []byte, err error) {
 	out, err = padding.RemovePadding(paddedOut)
 	return
 }
+
+// alg method returns identifier of encryption algorithm for type of key.
+func (k *Key) alg() byte {
+	switch k.Type() {
+	case KeyTypeSecp256k1:
+		return AlgECDHSecp256k1AES256GCM
+	case KeyTypeEd25519:
+		return AlgX25519AES256GCM
+	}
+	return AlgECDHP256AES256GCM
+}
+
+// ephemeralECDH method generates ephemeral key on curve of public key and
+// returns its encoding together with ECDH shared secret.
+func (k *Key) ephemeralECDH() (ephPub, secret []byte, err error) {
+	if k.pub == nil {
+		return nil, nil, errors.New("failed to initialize public key")
+	}
+	ephemeral, err := ecdsa.GenerateKey(k.pub.Curve, rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+	x, _ := k.pub.Curve.ScalarMult(k.pub.X, k.pub.Y, ephemeral.D.Bytes())
+	if x == nil {
+		return nil, nil, errors.New("failed to generate encryption key")
+	}
+	secret = make([]byte, (k.pub.Curve.Params().BitSize+7)/8)
+	x.FillBytes(secret)
+	ephPub = elliptic.Marshal(k.pub.Curve, ephemeral.PublicKey.X, ephemeral.PublicKey.Y)
+	return ephPub, secret, nil
+}
+
+// ephemeralX25519 method generates ephemeral X25519 key and returns it together
+// with shared secret, computed with X25519 form of Ed25519 public key.
+func (k *Key) ephemeralX25519() (ephPub, secret []byte, err error) {
+	if k.edPub == nil {
+		return nil, nil, errors.New("failed to initialize public key")
+	}
+	var pub, priv, shared, ephemeral [32]byte
+	if !extra25519.PublicKeyToCurve25519(&pub, k.edPub) {
+		return nil, nil, errors.New("invalid public key")
+	}
+	if _, err := io.ReadFull(rand.Reader, priv[:]); err != nil {
+		return nil, nil, err
+	}
+	curve25519.ScalarBaseMult(&ephemeral, &priv)
+	curve25519.ScalarMult(&shared, &priv, &pub)
+	if isZero(shared[:]) {
+		return nil, nil, errors.New("failed to generate encryption key")
+	}
+	return ephemeral[:], shared[:], nil
+}
+
+// sharedSecret method returns ECDH shared secret for ephemeral public key.
+func (k *Key) sharedSecret(ephPub []byte) ([]byte, error) {
+	if k.Type() == KeyTypeEd25519 {
+		if len(ephPub) != 32 {
+			return nil, errors.New("invalid public key")
+		}
+		var priv, pub, shared [32]byte
+		copy(pub[:], ephPub)
+		extra25519.PrivateKeyToCurve25519(&priv, k.edPriv)
+		curve25519.ScalarMult(&shared, &priv, &pub)
+		if isZero(shared[:]) {
+			return nil, errors.New("failed to generate encryption key")
+		}
+		return shared[:], nil
+	}
+	curve := k.priv.Curve
+	x, y := elliptic.Unmarshal(curve, ephPub)
+	if x == nil {
+		return nil, errors.New("invalid public key")
+	}
+	x, _ = curve.ScalarMult(x, y, k.priv.D.Bytes())
+	if x == nil {
+		return nil, errors.New("failed to generate encryption key")
+	}
+	secret := make([]byte, (curve.Params().BitSize+7)/8)
+	x.FillBytes(secret)
+	return secret, nil
+}
+
+// newSharedCipher method derives AES-256-GCM key from ECDH shared secret.
+// Derived key is bound to ciphertext header and public key of receiver.
+func (k *Key) newSharedCipher(secret, header []byte) (cipher.AEAD, error) {
+	info := append([]byte(hkdfInfoV1), header...)
+	if k.Type() == KeyTypeEd25519 {
+		info = append(info, k.edPub[:]...)
+	} else {
+		info = append(info, elliptic.Marshal(k.pub.Curve, k.pub.X, k.pub.Y)...)
+	}
+	key, err := hkdfSHA256(secret, nil, info, 32)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func isZero(b []byte) bool {
+	var acc byte
+	for _, v := range b {
+		acc |= v
+	}
+	return acc == 0
+}
@@ -0,0 +1,201 @@
+/*
+ * Copyright (C) 2018 eeonevision
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy of
+ * this software and associated documentation files (the "Software"), to deal in
+ * the Software without restriction, including without limitation the rights to
+ * use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+ * the Software, and to permit persons to whom the Software is furnished to do so,
+ * subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+ * FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+ * COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+ * IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+ * CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ */
+
+package crypto
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+
+	"golang.org/x/crypto/scrypt"
+)
+
+const (
+	// KeystoreVersion is version of keystore format produced by NewKeystore.
+	KeystoreVersion = 1
+	// KeystoreScryptN is default CPU/memory cost of scrypt in new keystores.
+	KeystoreScryptN = 1 << 15
+
+	keystoreScryptR    = 8
+	keystoreScryptP    = 1
+	keystoreMaxScryptN = 1 << 20
+	keystoreCipher     = "aes-256-gcm"
+	keystoreKDF        = "scrypt"
+)
+
+// Keystore struct is JSON file format, which keeps private key encrypted by
+// password. Key is derived from password with scrypt and encrypts private
+// key with AES-256-GCM. Account id and public key are kept in clear text and
+// authenticated together with private key.
+type Keystore struct {
+	Version   int            `json:"version"`
+	AccountID string         `json:"account_id,omitempty"`
+	PubKey    string         `json:"public_key"`
+	Crypto    KeystoreCrypto `json:"crypto"`
+}
+
+// KeystoreCrypto struct keeps encrypted private key and parameters of its encryption.
+type KeystoreCrypto struct {
+	Cipher     string         `json:"cipher"`
+	CipherText string         `json:"ciphertext"`
+	Nonce      string         `json:"nonce"`
+	KDF        string         `json:"kdf"`
+	KDFParams  KeystoreScrypt `json:"kdfparams"`
+}
+
+// KeystoreScrypt struct keeps parameters of scrypt key derivation.
+type KeystoreScrypt struct {
+	N     int    `json:"n"`
+	R     int    `json:"r"`
+	P     int    `json:"p"`
+	DKLen int    `json:"dklen"`
+	Salt  string `json:"salt"`
+}
+
+// NewKeystore function encrypts private key of account by password.
+func NewKeystore(accountID string, key *Key, password string) (*Keystore, error) {
+	return newKeystore(accountID, key, password, KeystoreScryptN)
+}
+
+func newKeystore(accountID string, key *Key, password string, n int) (*Keystore, error) {
+	if key.priv == nil && key.edPriv == nil {
+		return nil, errors.New("failed to initialize private key")
+	}
+	salt := make([]byte, 32)
+	if _, err := io.ReadFull(rand.Reader, salt); err != nil {
+		return nil, err
+	}
+	ks := &Keystore{
+		Version:   KeystoreVersion,
+		AccountID: accountID,
+		PubKey:    key.GetPubString(),
+		Crypto: KeystoreCrypto{
+			Cipher: keystoreCipher,
+			KDF:    keystoreKDF,
+			KDFParams: KeystoreScrypt{
+				N:     n,
+				R:     keystoreScryptR,
+				P:     keystoreScryptP,
+				DKLen: 32,
+				Salt:  base64.StdEncoding.EncodeToString(salt),
+			},
+		},
+	}
+	aead, err := ks.cipher(password)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+	ct := aead.Seal(nil, nonce, []byte(key.GetPrivString()), ks.additionalData())
+	ks.Crypto.Nonce = base64.StdEncoding.EncodeToString(nonce)
+	ks.Crypto.CipherText = base64.StdEncoding.EncodeToString(ct)
+	return ks, nil
+}
+
+// ParseKeystore function decodes keystore from JSON.
+func ParseKeystore(data []byte) (*Keystore, error) {
+	ks := &Keystore{}
+	if err := json.Unmarshal(data, ks); err != nil {
+		return nil, err
+	}
+	if ks.Version != KeystoreVersion {
+		return nil, errors.New("unsupported keystore version")
+	}
+	return ks, nil
+}
+
+// ReadKeystoreFile function reads keystore from JSON file.
+func ReadKeystoreFile(path string) (*Keystore, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParseKeystore(data)
+}
+
+// WriteFile method writes keystore to JSON file, which is readable by owner only.
+func (ks *Keystore) WriteFile(path string) error {
+	data, err := json.MarshalIndent(ks, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, data, 0600)
+}
+
+// Decrypt method decrypts key pair from keystore by password.
+func (ks *Keystore) Decrypt(password string) (*Key, error) {
+	aead, err := ks.cipher(password)
+	if err != nil {
+		return nil, err
+	}
+	nonce, err := base64.StdEncoding.DecodeString(ks.Crypto.Nonce)
+	if err != nil || len(nonce) != aead.NonceSize() {
+		return nil, errors.New("invalid keystore nonce")
+	}
+	ct, err := base64.StdEncoding.DecodeString(ks.Crypto.CipherText)
+	if err != nil {
+		return nil, errors.New("invalid keystore ciphertext")
+	}
+	priv, err := aead.Open(nil, nonce, ct, ks.additionalData())
+	if err != nil {
+		return nil, errors.New("wrong password or corrupted keystore")
+	}
+	return NewFromStrings(ks.PubKey, string(priv))
+}
+
+// cipher method derives key of keystore from password and returns AES-256-GCM cipher.
+func (ks *Keystore) cipher(password string) (cipher.AEAD, error) {
+	if ks.Crypto.Cipher != keystoreCipher || ks.Crypto.KDF != keystoreKDF {
+		return nil, errors.New("unsupported keystore cipher " + ks.Crypto.Cipher + " or kdf " + ks.Crypto.KDF)
+	}
+	params := ks.Crypto.KDFParams
+	if params.N <= 1 || params.N > keystoreMaxScryptN || params.R <= 0 || params.P <= 0 ||
+		params.R*params.P > 16 || params.DKLen != 32 {
+		return nil, errors.New("invalid keystore kdf parameters")
+	}
+	salt, err := base64.StdEncoding.DecodeString(params.Salt)
+	if err != nil || len(salt) == 0 {
+		return nil, errors.New("invalid keystore salt")
+	}
+	key, err := scrypt.Key([]byte(password), salt, params.N, params.R, params.P, params.DKLen)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// additionalData method returns authenticated clear text fields of keystore.
+func (ks *Keystore) additionalData() []byte {
+	return []byte(ks.AccountID + "\x00" + ks.PubKey)
+}
@@ -0,0 +1,131 @@
+/*
+ * Copyright (C) 2018 eeonevision
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy of
+ * this software and associated documentation files (the "Software"), to deal in
+ * the Software without restriction, including without limitation the rights to
+ * use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+ * the Software, and to permit persons to whom the Software is furnished to do so,
+ * subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+ * FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+ * COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+ * IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+ * CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ */
+
+package crypto
+
+import (
+	"crypto/ecdsa"
+	"crypto/hmac"
+	"crypto/sha256"
+	"errors"
+	"math/big"
+)
+
+// signDeterministic function signs hash with nonce, generated from private key
+// and hash as described in RFC 6979 with HMAC-SHA256. Returned S is always
+// in the lower half of curve order.
+func signDeterministic(priv *ecdsa.PrivateKey, hash []byte) (r, s *big.Int, err error) {
+	curve := priv.Curve
+	n := curve.Params().N
+	e := hashToInt(hash, n)
+	nonces := newRFC6979(priv.D, hash, n)
+	for i := 0; i < 16; i++ {
+		k := nonces()
+		x, _ := curve.ScalarBaseMult(k.Bytes())
+		r = new(big.Int).Mod(x, n)
+		if r.Sign() == 0 {
+			continue
+		}
+		s = new(big.Int).Mul(r, priv.D)
+		s.Add(s, e)
+		s.Mul(s, new(big.Int).ModInverse(k, n))
+		s.Mod(s, n)
+		if s.Sign() == 0 {
+			continue
+		}
+		if isHighS(s, n) {
+			s.Sub(n, s)
+		}
+		return r, s, nil
+	}
+	return nil, nil, errors.New("failed to generate signature")
+}
+
+// newRFC6979 function returns generator of candidate nonces for private key x
+// and hash h, every next call continues generation after rejected nonce.
+func newRFC6979(x *big.Int, h []byte, n *big.Int) func() *big.Int {
+	size := (n.BitLen() + 7) / 8
+	xBytes := make([]byte, size)
+	x.FillBytes(xBytes)
+	hBytes := make([]byte, size)
+	z := hashToInt(h, n)
+	if z.Cmp(n) >= 0 {
+		z.Sub(z, n)
+	}
+	z.FillBytes(hBytes)
+
+	mac := func(key []byte, parts ...[]byte) []byte {
+		m := hmac.New(sha256.New, key)
+		for _, p := range parts {
+			m.Write(p)
+		}
+		return m.Sum(nil)
+	}
+	v := make([]byte, sha256.Size)
+	for i := range v {
+		v[i] = 0x01
+	}
+	k := make([]byte, sha256.Size)
+	k = mac(k, v, []byte{0x00}, xBytes, hBytes)
+	v = mac(k, v)
+	k = mac(k, v, []byte{0x01}, xBytes, hBytes)
+	v = mac(k, v)
+
+	first := true
+	return func() *big.Int {
+		for {
+			if !first {
+				k = mac(k, v, []byte{0x00})
+				v = mac(k, v)
+			}
+			first = false
+			var t []byte
+			for len(t) < size {
+				v = mac(k, v)
+				t = append(t, v...)
+			}
+			nonce := hashToInt(t, n)
+			if nonce.Sign() > 0 && nonce.Cmp(n) < 0 {
+				return nonce
+			}
+		}
+	}
+}
+
+// hashToInt function converts hash to integer, keeping as many leftmost bits
+// as curve order has, in the same way as ECDSA does.
+func hashToInt(hash []byte, n *big.Int) *big.Int {
+	orderBits := n.BitLen()
+	orderBytes := (orderBits + 7) / 8
+	if len(hash) > orderBytes {
+		hash = hash[:orderBytes]
+	}
+	ret := new(big.Int).SetBytes(hash)
+	if excess := len(hash)*8 - orderBits; excess > 0 {
+		ret.Rsh(ret, uint(excess))
+	}
+	return ret
+}
+
+// isHighS function checks if S of signature is in the upper half of curve order.
+func isHighS(s, n *big.Int) bool {
+	return s.Cmp(new(big.Int).Rsh(n, 1)) > 0
+}
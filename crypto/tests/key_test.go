@@ -1,9 +1,16 @@
 package tests
 
 import (
+	"crypto/elliptic"
+	"crypto/sha256"
+	"crypto/x509"
 	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
 	"flag"
 	"io/ioutil"
+	"math/big"
 	"os"
 	"testing"
 
@@ -72,3 +79,379 @@ func TestDecrypt(t *testing.T) {
 		return
 	}
 }
+
+func TestEnvelope(t *testing.T) {
+	key, err := crypto.CreateKeyPair()
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	ciphertext, contentKey, err := crypto.SealEnvelope([]byte(*msg))
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	wrapped, err := key.Encrypt(contentKey)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	unwrapped, err := key.Decrypt(wrapped)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	body, err := crypto.OpenEnvelope(ciphertext, unwrapped)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	if string(body) != *msg {
+		t.Errorf("messages are not equals. Expected: %s, Output: %s", *msg, string(body))
+	}
+	ciphertext[len(ciphertext)-1] ^= 1
+	if _, err := crypto.OpenEnvelope(ciphertext, unwrapped); err == nil {
+		t.Errorf("modified envelope was opened")
+	}
+}
+
+// legacyCiphertext is test message encrypted with AES-128-CBC-HMAC-SHA1 format.
+const legacyCiphertext = "QQT9XrOpDXLZrLTCN3ooQwOCEbL2utBcKOoYYRF2voLUmZOJHooNeUc+d2H+dK7RxWR6UdzcTbeP8enuzXG5a4YjutLDFwrWslLcCB/cvu/tsQY+//quXY+EmejtCfYA05SmfbLOUwbW1fQCwGt0nh2Xz/Vq9w=="
+
+func TestDecryptLegacy(t *testing.T) {
+	key, err := crypto.NewFromStrings(*publicKey, *privateKey)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	decoded, _ := base64.StdEncoding.DecodeString(legacyCiphertext)
+	decrypted, err := key.Decrypt(decoded)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	if string(decrypted) != "test message!" {
+		t.Errorf("messages are not equals. Expected: test message!, Output: %s", string(decrypted))
+	}
+}
+
+func TestEncryptVersion(t *testing.T) {
+	key, err := crypto.NewFromStrings(*publicKey, *privateKey)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	encrypted, err := key.Encrypt([]byte(*msg))
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	if encrypted[0] != crypto.CiphertextV1 || encrypted[1] != crypto.AlgECDHP256AES256GCM {
+		t.Fatalf("unexpected ciphertext header %x", encrypted[:2])
+	}
+	// Header is authenticated, so changing algorithm must fail decryption
+	encrypted[1] ^= 0xff
+	if _, err := key.Decrypt(encrypted); err == nil {
+		t.Errorf("ciphertext with modified header was decrypted")
+	}
+	encrypted[1] ^= 0xff
+	encrypted[len(encrypted)-1] ^= 1
+	if _, err := key.Decrypt(encrypted); err == nil {
+		t.Errorf("modified ciphertext was decrypted")
+	}
+}
+
+func FuzzDecrypt(f *testing.F) {
+	key, err := crypto.NewFromStrings(*publicKey, *privateKey)
+	if err != nil {
+		f.Fatalf("%s", err)
+	}
+	legacy, _ := base64.StdEncoding.DecodeString(legacyCiphertext)
+	encrypted, err := key.Encrypt([]byte(*msg))
+	if err != nil {
+		f.Fatalf("%s", err)
+	}
+	f.Add([]byte{})
+	f.Add([]byte{crypto.CiphertextV1})
+	f.Add([]byte{crypto.CiphertextV1, crypto.AlgECDHP256AES256GCM, 65})
+	f.Add(legacy)
+	f.Add(legacy[:80])
+	f.Add(encrypted)
+	f.Add(encrypted[:70])
+	f.Fuzz(func(t *testing.T, in []byte) {
+		// Malformed input must be rejected with error, not panic
+		out, err := key.Decrypt(in)
+		if err != nil && out != nil {
+			t.Errorf("output returned together with error")
+		}
+	})
+}
+
+func TestKeyTypes(t *testing.T) {
+	hash := []byte("0123456789abcdef0123456789abcdef")
+	for _, keyType := range []crypto.KeyType{crypto.KeyTypeP256, crypto.KeyTypeSecp256k1, crypto.KeyTypeEd25519} {
+		generated, err := crypto.CreateKeyPairOfType(keyType)
+		if err != nil {
+			t.Fatalf("%s: %s", keyType, err)
+		}
+		// Key should be restored from its string encodings
+		key, err := crypto.NewFromStrings(generated.GetPubString(), generated.GetPrivString())
+		if err != nil {
+			t.Fatalf("%s: %s", keyType, err)
+		}
+		if key.Type() != keyType || key.GetPubString() != generated.GetPubString() {
+			t.Fatalf("%s: key was restored as %s %s", keyType, key.Type(), key.GetPubString())
+		}
+		pub, err := crypto.NewFromTypedStrings(keyType, key.GetPubString(), "")
+		if err != nil {
+			t.Fatalf("%s: %s", keyType, err)
+		}
+		signature, err := key.Sign(hash)
+		if err != nil {
+			t.Fatalf("%s: %s", keyType, err)
+		}
+		if err := pub.Verify(hash, signature); err != nil {
+			t.Errorf("%s: %s", keyType, err)
+		}
+		if err := pub.Verify([]byte("other"), signature); err == nil {
+			t.Errorf("%s: signature of other hash was verified", keyType)
+		}
+		encrypted, err := pub.Encrypt([]byte(*msg))
+		if err != nil {
+			t.Fatalf("%s: %s", keyType, err)
+		}
+		decrypted, err := key.Decrypt(encrypted)
+		if err != nil {
+			t.Fatalf("%s: %s", keyType, err)
+		}
+		if string(decrypted) != *msg {
+			t.Errorf("%s: messages are not equals. Expected: %s, Output: %s", keyType, *msg, string(decrypted))
+		}
+	}
+}
+
+func TestKeyTypeMismatch(t *testing.T) {
+	key, err := crypto.CreateKeyPairOfType(crypto.KeyTypeEd25519)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	if _, err := crypto.NewFromTypedStrings(crypto.KeyTypeSecp256k1, key.GetPubString(), ""); err == nil {
+		t.Errorf("ed25519 key was accepted as secp256k1 key")
+	}
+	if _, err := crypto.NewFromStrings("rsa:AAAA", ""); err == nil {
+		t.Errorf("key of unknown type was accepted")
+	}
+	other, err := crypto.NewFromStrings(*publicKey, *privateKey)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	encrypted, err := other.Encrypt([]byte(*msg))
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	if _, err := key.Decrypt(encrypted); err == nil {
+		t.Errorf("ciphertext of P-256 key was decrypted by ed25519 key")
+	}
+}
+
+func TestSignDeterministic(t *testing.T) {
+	// Test vector of RFC 6979 A.2.5 for P-256 with SHA-256 and message "sample"
+	d, _ := new(big.Int).SetString("C9AFA9D845BA75166B5C215767B1D6934E50C3DB36E89B127B8A622B120F6721", 16)
+	x, y := elliptic.P256().ScalarBaseMult(d.Bytes())
+	pub := base64.StdEncoding.EncodeToString(elliptic.Marshal(elliptic.P256(), x, y))
+	key, err := crypto.NewFromStrings(pub, base64.StdEncoding.EncodeToString(d.Bytes()))
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	hash := sha256.Sum256([]byte("sample"))
+	signature, err := key.Sign(hash[:])
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	sig, _ := base64.StdEncoding.DecodeString(signature)
+	r, _ := new(big.Int).SetString("EFD48B2AACB6A8FD1140DD9CD45E81D69D2C877B56AAF991C34D0EA84EAF3716", 16)
+	s, _ := new(big.Int).SetString("F7CB1C942D657C41D436C7A1B6E29F65F3E900DBB9AFF4064DC4AB2F843ACDA8", 16)
+	// High S of test vector is replaced by its low counterpart
+	s.Sub(elliptic.P256().Params().N, s)
+	if len(sig) != 64 || new(big.Int).SetBytes(sig[:32]).Cmp(r) != 0 || new(big.Int).SetBytes(sig[32:]).Cmp(s) != 0 {
+		t.Fatalf("unexpected signature %x", sig)
+	}
+	again, _ := key.Sign(hash[:])
+	if again != signature {
+		t.Errorf("signature is not deterministic")
+	}
+	if err := key.Verify(hash[:], signature); err != nil {
+		t.Errorf("%s", err)
+	}
+
+	// High S and non-canonical encodings of the same signature are rejected
+	high := append([]byte{}, sig...)
+	new(big.Int).Sub(elliptic.P256().Params().N, s).FillBytes(high[32:])
+	if err := key.Verify(hash[:], base64.StdEncoding.EncodeToString(high)); err == nil {
+		t.Errorf("signature with high S was verified")
+	}
+	if err := key.Verify(hash[:], base64.RawStdEncoding.EncodeToString(sig)); err == nil {
+		t.Errorf("signature without padding was verified")
+	}
+	legacy := base64.StdEncoding.EncodeToString(sig[:32]) + ":" + base64.StdEncoding.EncodeToString(sig[32:])
+	if err := key.Verify(hash[:], legacy); err == nil {
+		t.Errorf("signature in legacy encoding was verified")
+	}
+}
+
+func TestEd25519NonCanonicalSignature(t *testing.T) {
+	key, err := crypto.CreateKeyPairOfType(crypto.KeyTypeEd25519)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	hash := sha256.Sum256([]byte(*msg))
+	signature, _ := key.Sign(hash[:])
+	sig, _ := base64.StdEncoding.DecodeString(signature)
+	// S + L is accepted by plain Ed25519 verification, but it is not canonical
+	order, _ := new(big.Int).SetString("7237005577332262213973186563042994240857116359379907606001950938285454250989", 10)
+	le := func(b []byte) []byte {
+		out := make([]byte, len(b))
+		for i := range b {
+			out[len(b)-1-i] = b[i]
+		}
+		return out
+	}
+	s := new(big.Int).SetBytes(le(sig[32:]))
+	s.Add(s, order)
+	forged := append([]byte{}, sig[:32]...)
+	forged = append(forged, le(s.FillBytes(make([]byte, 32)))...)
+	if err := key.Verify(hash[:], base64.StdEncoding.EncodeToString(forged)); err == nil {
+		t.Errorf("signature with non-canonical S was verified")
+	}
+}
+
+func TestPEMAndJWK(t *testing.T) {
+	for _, keyType := range []crypto.KeyType{crypto.KeyTypeP256, crypto.KeyTypeSecp256k1, crypto.KeyTypeEd25519} {
+		key, err := crypto.CreateKeyPairOfType(keyType)
+		if err != nil {
+			t.Fatalf("%s: %s", keyType, err)
+		}
+		privPEM, err := key.MarshalPrivatePEM()
+		if err != nil {
+			t.Fatalf("%s: %s", keyType, err)
+		}
+		pubPEM, err := key.MarshalPublicPEM()
+		if err != nil {
+			t.Fatalf("%s: %s", keyType, err)
+		}
+		privJWK, err := key.MarshalJWK(true)
+		if err != nil {
+			t.Fatalf("%s: %s", keyType, err)
+		}
+		pubJWK, err := key.MarshalJWK(false)
+		if err != nil {
+			t.Fatalf("%s: %s", keyType, err)
+		}
+		for _, decode := range []func() (*crypto.Key, error){
+			func() (*crypto.Key, error) { return crypto.ParsePEM(privPEM) },
+			func() (*crypto.Key, error) { return crypto.ParsePEM(pubPEM) },
+			func() (*crypto.Key, error) { return crypto.ParseJWK(privJWK) },
+			func() (*crypto.Key, error) { return crypto.ParseJWK(pubJWK) },
+		} {
+			decoded, err := decode()
+			if err != nil {
+				t.Fatalf("%s: %s", keyType, err)
+			}
+			if decoded.Type() != keyType || decoded.GetPubString() != key.GetPubString() {
+				t.Fatalf("%s: key was decoded as %s %s", keyType, decoded.Type(), decoded.GetPubString())
+			}
+		}
+		decoded, _ := crypto.ParsePEM(privPEM)
+		if decoded.GetPrivString() != key.GetPrivString() {
+			t.Errorf("%s: private key was not decoded from PEM", keyType)
+		}
+	}
+
+	// P-256 keys are interoperable with standard library
+	key, _ := crypto.CreateKeyPair()
+	privPEM, _ := key.MarshalPrivatePEM()
+	block, _ := pem.Decode(privPEM)
+	if _, err := x509.ParsePKCS8PrivateKey(block.Bytes); err != nil {
+		t.Errorf("PKCS#8 is not readable by x509: %s", err)
+	}
+	pubPEM, _ := key.MarshalPublicPEM()
+	block, _ = pem.Decode(pubPEM)
+	if _, err := x509.ParsePKIXPublicKey(block.Bytes); err != nil {
+		t.Errorf("SPKI is not readable by x509: %s", err)
+	}
+}
+
+func TestKeystore(t *testing.T) {
+	key, err := crypto.CreateKeyPairOfType(crypto.KeyTypeEd25519)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	ks, err := crypto.NewKeystore("1", key, "secret")
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	path := t.TempDir() + "/key.json"
+	if err := ks.WriteFile(path); err != nil {
+		t.Fatalf("%s", err)
+	}
+	loaded, err := crypto.ReadKeystoreFile(path)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	if _, err := loaded.Decrypt("wrong"); err == nil {
+		t.Errorf("keystore was decrypted by wrong password")
+	}
+	decrypted, err := loaded.Decrypt("secret")
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	if loaded.AccountID != "1" || decrypted.GetPrivString() != key.GetPrivString() {
+		t.Errorf("wrong key was decrypted from keystore")
+	}
+	// Clear text fields are authenticated
+	loaded.AccountID = "2"
+	if _, err := loaded.Decrypt("secret"); err == nil {
+		t.Errorf("keystore with modified account id was decrypted")
+	}
+}
+
+func TestDeriveKey(t *testing.T) {
+	// Test vector 1 of SLIP-0010
+	seed, _ := hex.DecodeString("000102030405060708090a0b0c0d0e0f")
+	for _, v := range []struct {
+		keyType crypto.KeyType
+		path    string
+		priv    string
+	}{
+		{crypto.KeyTypeEd25519, "m", "2b4be7f19ee27bbf30c667b642d5f4aa69fd169872f8fc3059c08ebae2eb19e7"},
+		{crypto.KeyTypeEd25519, "m/0'", "68e0fe46dfb67e368c75379acec591dad19df3cde26e63b93a8e704f1dade7a3"},
+		{crypto.KeyTypeSecp256k1, "m/0'", "edb2e14f9ee77d26dd93b4ecede8d16ed408ce149b6cd80b0715a2d911a0afea"},
+		{crypto.KeyTypeSecp256k1, "m/0'/1", "3c6cb8d0f6a264c91ea8b5030fadaa8e538b020f0a387421a12de9319dc93368"},
+		{crypto.KeyTypeP256, "m", "612091aaa12e22dd2abef664f8a01a82cae99ad7441b7ef8110424915c268bc2"},
+		{crypto.KeyTypeP256, "m/0h", "6939694369114c67917a182c59ddb8cafc3004e63ca5d3b84403ba8613debc0c"},
+	} {
+		key, err := crypto.DeriveKey(v.keyType, seed, v.path)
+		if err != nil {
+			t.Fatalf("%s %s: %s", v.keyType, v.path, err)
+		}
+		jwk, _ := key.MarshalJWK(true)
+		var parsed struct {
+			D string `json:"d"`
+		}
+		json.Unmarshal(jwk, &parsed)
+		d, _ := base64.RawURLEncoding.DecodeString(parsed.D)
+		if hex.EncodeToString(d) != v.priv {
+			t.Errorf("%s %s: unexpected key %x", v.keyType, v.path, d)
+		}
+	}
+	if _, err := crypto.DeriveKey(crypto.KeyTypeEd25519, seed, "m/0"); err == nil {
+		t.Errorf("non-hardened ed25519 key was derived")
+	}
+
+	mnemonic, err := crypto.NewMnemonic()
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	if _, err := crypto.SeedFromMnemonic(mnemonic+" abandon", ""); err == nil {
+		t.Errorf("invalid mnemonic was accepted")
+	}
+	seed1, _ := crypto.SeedFromMnemonic(mnemonic, "")
+	seed2, _ := crypto.SeedFromMnemonic(mnemonic, "")
+	key1, _ := crypto.DeriveKey(crypto.KeyTypeP256, seed1, "m/1'/0'")
+	key2, _ := crypto.DeriveKey(crypto.KeyTypeP256, seed2, "m/1'/0'")
+	other, _ := crypto.DeriveKey(crypto.KeyTypeP256, seed2, "m/2'/0'")
+	if key1.GetPrivString() != key2.GetPrivString() || key1.GetPrivString() == other.GetPrivString() {
+		t.Errorf("keys are not derived deterministically")
+	}
+}
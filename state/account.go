@@ -22,7 +22,10 @@
 package state
 
 import (
+	"crypto/sha256"
+	"encoding/binary"
 	"errors"
+	"math/bits"
 
 	"github.com/eeonevision/anychaindb/crypto"
 )
@@ -30,12 +33,108 @@ import (
 //go:generate msgp
 
 // Account struct keeps account related fields.
+//   - PubKey is the current public key of account;
+//   - KeyType is the type of current key, see crypto.KeyType;
+//   - EncPubKey is the public key, which receives private data. Accounts
+//     without it receive private data by PubKey, which signs transactions;
+//   - KeyHistory keeps all public keys of account in order of their activation;
+//   - Registrar and RegistrarSignature are set if account is co-signed by registrar;
+//   - WorkNonce is solution of proof-of-work for admission of account;
+//   - Roles are roles of account in permissioned network, see RoleAdmin.
 type Account struct {
-	ID     string `msg:"_id" json:"_id" mapstructure:"_id" bson:"_id"`
-	PubKey string `msg:"public_key" json:"public_key" mapstructure:"public_key" bson:"public_key"`
+	ID                 string      `msg:"_id" json:"_id" mapstructure:"_id" bson:"_id"`
+	PubKey             string      `msg:"public_key" json:"public_key" mapstructure:"public_key" bson:"public_key"`
+	KeyType            string      `msg:"key_type" json:"key_type,omitempty" mapstructure:"key_type" bson:"key_type,omitempty"`
+	EncPubKey          string      `msg:"encryption_public_key" json:"encryption_public_key,omitempty" mapstructure:"encryption_public_key" bson:"encryption_public_key,omitempty"`
+	EncKeyType         string      `msg:"encryption_key_type" json:"encryption_key_type,omitempty" mapstructure:"encryption_key_type" bson:"encryption_key_type,omitempty"`
+	Nonce              uint32      `msg:"nonce" json:"nonce" mapstructure:"nonce" bson:"nonce"`
+	KeyHistory         []KeyRecord `msg:"key_history" json:"key_history,omitempty" mapstructure:"key_history" bson:"key_history,omitempty"`
+	Registrar          string      `msg:"registrar" json:"registrar,omitempty" mapstructure:"registrar" bson:"registrar,omitempty"`
+	RegistrarSignature string      `msg:"registrar_signature" json:"registrar_signature,omitempty" mapstructure:"registrar_signature" bson:"registrar_signature,omitempty"`
+	WorkNonce          uint64      `msg:"work_nonce" json:"work_nonce,omitempty" mapstructure:"work_nonce" bson:"work_nonce,omitempty"`
+	Roles              []string    `msg:"roles" json:"roles,omitempty" mapstructure:"roles" bson:"roles,omitempty"`
 }
 
-const accountsCollection = "accounts"
+// KeyRecord struct keeps public keys of account and height of block,
+// since which the keys are active. Private keys are never kept in chain,
+// so owner keeps previous private keys to read data encrypted by them.
+type KeyRecord struct {
+	PubKey     string `msg:"public_key" json:"public_key" mapstructure:"public_key" bson:"public_key"`
+	KeyType    string `msg:"key_type" json:"key_type,omitempty" mapstructure:"key_type" bson:"key_type,omitempty"`
+	EncPubKey  string `msg:"encryption_public_key" json:"encryption_public_key,omitempty" mapstructure:"encryption_public_key" bson:"encryption_public_key,omitempty"`
+	EncKeyType string `msg:"encryption_key_type" json:"encryption_key_type,omitempty" mapstructure:"encryption_key_type" bson:"encryption_key_type,omitempty"`
+	Height     int64  `msg:"height" json:"height" mapstructure:"height" bson:"height"`
+}
+
+// KeyRotation struct keeps data of transaction, which installs new public key
+// of account. Accounts with separate encryption key may rotate it as well.
+type KeyRotation struct {
+	AccountID  string `msg:"account_id" json:"account_id" mapstructure:"account_id" bson:"account_id"`
+	PubKey     string `msg:"public_key" json:"public_key" mapstructure:"public_key" bson:"public_key"`
+	KeyType    string `msg:"key_type" json:"key_type,omitempty" mapstructure:"key_type" bson:"key_type,omitempty"`
+	EncPubKey  string `msg:"encryption_public_key" json:"encryption_public_key,omitempty" mapstructure:"encryption_public_key" bson:"encryption_public_key,omitempty"`
+	EncKeyType string `msg:"encryption_key_type" json:"encryption_key_type,omitempty" mapstructure:"encryption_key_type" bson:"encryption_key_type,omitempty"`
+}
+
+// PubKeyAt method returns public key of account, which was active at given height.
+func (a *Account) PubKeyAt(height int64) string {
+	return a.KeyAt(height).PubKey
+}
+
+// KeyAt method returns record of key, which was active at given height.
+// Account, which is not added to the chain yet, has only the current key.
+func (a *Account) KeyAt(height int64) KeyRecord {
+	for i := len(a.KeyHistory) - 1; i >= 0; i-- {
+		if a.KeyHistory[i].Height <= height {
+			return a.KeyHistory[i]
+		}
+	}
+	if len(a.KeyHistory) > 0 {
+		return a.KeyHistory[0]
+	}
+	return KeyRecord{PubKey: a.PubKey, KeyType: a.KeyType}
+}
+
+// EncryptionKey method returns public key and its type, which should be used
+// for encryption of private data of account.
+func (a *Account) EncryptionKey() (pub, keyType string) {
+	if a.EncPubKey != "" {
+		return a.EncPubKey, a.EncKeyType
+	}
+	return a.PubKey, a.KeyType
+}
+
+// AdmissionHash method returns hash of account fields, which is co-signed by
+// registrar and solved by proof-of-work for admission of account to the chain.
+func (a *Account) AdmissionHash(chainID string) []byte {
+	hash := sha256.New()
+	for _, field := range []string{chainID, a.ID, a.PubKey, a.KeyType, a.EncPubKey, a.EncKeyType, a.Registrar} {
+		hash.Write([]byte(field))
+		hash.Write([]byte{0})
+	}
+	return hash.Sum(nil)
+}
+
+// WorkBits method returns number of leading zero bits of proof-of-work hash,
+// which is hash of admission hash and work nonce of account.
+func (a *Account) WorkBits(chainID string) int {
+	var nonce [8]byte
+	binary.BigEndian.PutUint64(nonce[:], a.WorkNonce)
+	hash := sha256.Sum256(append(a.AdmissionHash(chainID), nonce[:]...))
+	n := 0
+	for _, b := range hash {
+		if b != 0 {
+			return n + bits.LeadingZeros8(b)
+		}
+		n += 8
+	}
+	return n
+}
+
+// AccountKey returns key of account in Merkle tree.
+func AccountKey(id string) string {
+	return "accounts/" + id
+}
 
 // AddAccount method adds new account if all checks were passed.
 func (s *State) AddAccount(account *Account) error {
@@ -47,7 +146,11 @@ func (s *State) AddAccount(account *Account) error {
 
 // SetAccount method adds account in state.
 func (s *State) SetAccount(account *Account) error {
-	return s.DB.C(accountsCollection).Insert(account)
+	if err := s.setLeaf(AccountKey(account.ID), account); err != nil {
+		return err
+	}
+	s.batch.Accounts[account.ID] = account
+	return nil
 }
 
 // HasAccount method checks if account exists in state or not exists.
@@ -60,8 +163,10 @@ func (s *State) HasAccount(id string) bool {
 
 // GetAccount method returns account from accounts collection by given accoutn id.
 func (s *State) GetAccount(id string) (*Account, error) {
-	var result *Account
-	return result, s.DB.C(accountsCollection).FindId(id).One(&result)
+	if acc, ok := s.batch.Accounts[id]; ok {
+		return acc, nil
+	}
+	return s.store.GetAccount(id)
 }
 
 // GetAccountPubKey method returns public key by given account id.
@@ -70,15 +175,83 @@ func (s *State) GetAccountPubKey(id string) (*crypto.Key, error) {
 	if err != nil {
 		return nil, err
 	}
-	return crypto.NewFromStrings(acc.PubKey, "")
+	return crypto.NewFromTypedStrings(crypto.KeyType(acc.KeyType), acc.PubKey, "")
+}
+
+// GetAccountPubKeyAt method returns public key of account, which was active at given height.
+func (s *State) GetAccountPubKeyAt(id string, height int64) (*crypto.Key, error) {
+	acc, err := s.GetAccount(id)
+	if err != nil {
+		return nil, err
+	}
+	key := acc.KeyAt(height)
+	return crypto.NewFromTypedStrings(crypto.KeyType(key.KeyType), key.PubKey, "")
+}
+
+// RotateAccountKey method installs new public keys of account, which become
+// active at given height, and increments nonce of account. Encryption key is
+// kept, unless new one is given.
+func (s *State) RotateAccountKey(rotation *KeyRotation, height int64) error {
+	acc, err := s.GetAccount(rotation.AccountID)
+	if err != nil {
+		return err
+	}
+	updated := *acc
+	updated.PubKey = rotation.PubKey
+	updated.KeyType = rotation.KeyType
+	if rotation.EncPubKey != "" {
+		updated.EncPubKey = rotation.EncPubKey
+		updated.EncKeyType = rotation.EncKeyType
+	}
+	updated.KeyHistory = append(append([]KeyRecord{}, acc.KeyHistory...), KeyRecord{
+		PubKey:     updated.PubKey,
+		KeyType:    updated.KeyType,
+		EncPubKey:  updated.EncPubKey,
+		EncKeyType: updated.EncKeyType,
+		Height:     height,
+	})
+	updated.Nonce++
+	return s.SetAccount(&updated)
+}
+
+// GetAccountNonce method returns nonce expected in the next transaction of account.
+func (s *State) GetAccountNonce(id string) (uint32, error) {
+	acc, err := s.GetAccount(id)
+	if err != nil {
+		return 0, err
+	}
+	return acc.Nonce, nil
+}
+
+// IncAccountNonce method increments nonce of account after its transaction was applied.
+func (s *State) IncAccountNonce(id string) error {
+	acc, err := s.GetAccount(id)
+	if err != nil {
+		return err
+	}
+	updated := *acc
+	updated.Nonce++
+	return s.SetAccount(&updated)
+}
+
+// ProveAccount method returns committed account and proof of its inclusion
+// in the state of last committed block. Absent account is returned as nil
+// together with proof of its absence.
+func (s *State) ProveAccount(id string) (*Account, *Proof, error) {
+	acc, err := s.store.GetAccount(id)
+	if err != nil && err != ErrNotFound {
+		return nil, nil, err
+	}
+	_, proof := s.committed.Prove(AccountKey(id))
+	return acc, proof, nil
 }
 
-// ListAccounts method returns all accounts from the state.
+// ListAccounts method returns all committed accounts from the state.
 func (s *State) ListAccounts() (result []*Account, err error) {
-	return result, s.DB.C(accountsCollection).Find(nil).All(&result)
+	return s.store.SearchAccounts(nil, 0, 0)
 }
 
-// SearchAccounts method returns accounts by given search query, limit and offset parameters.
+// SearchAccounts method returns committed accounts by given search query, limit and offset parameters.
 func (s *State) SearchAccounts(query interface{}, limit, offset int) (result []*Account, err error) {
-	return result, s.DB.C(accountsCollection).Find(query).Skip(offset).Limit(limit).All(&result)
+	return s.store.SearchAccounts(query, limit, offset)
 }
@@ -0,0 +1,43 @@
+/*
+ * Copyright (C) 2018 eeonevision
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy of
+ * this software and associated documentation files (the "Software"), to deal in
+ * the Software without restriction, including without limitation the rights to
+ * use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+ * the Software, and to permit persons to whom the Software is furnished to do so,
+ * subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+ * FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+ * COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+ * IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+ * CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ */
+
+package state
+
+// Batch struct keeps changes of the state made by one block.
+// Storage writes batch atomically, so after restart the state
+// either has all changes of the block or has none of them.
+type Batch struct {
+	Accounts  map[string]*Account
+	Payloads  map[string]*Payload
+	Revisions map[string]*Payload
+	Leaves    map[string][]byte
+	LastBlock *LastBlockInfo
+}
+
+// NewBatch method constructs empty batch.
+func NewBatch() *Batch {
+	return &Batch{
+		Accounts:  make(map[string]*Account),
+		Payloads:  make(map[string]*Payload),
+		Revisions: make(map[string]*Payload),
+		Leaves:    make(map[string][]byte),
+	}
+}
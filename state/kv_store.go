@@ -0,0 +1,261 @@
+/*
+ * Copyright (C) 2018 eeonevision
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy of
+ * this software and associated documentation files (the "Software"), to deal in
+ * the Software without restriction, including without limitation the rights to
+ * use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+ * the Software, and to permit persons to whom the Software is furnished to do so,
+ * subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+ * FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+ * COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+ * IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+ * CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ */
+
+package state
+
+import (
+	"encoding/json"
+
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/opt"
+	dbm "github.com/tendermint/tendermint/libs/db"
+)
+
+// Key prefixes of state objects in key-value database.
+var (
+	accountsPrefix  = []byte("accounts/")
+	payloadsPrefix  = []byte("payloads/")
+	revisionsPrefix = []byte("revisions/")
+	merklePrefix    = []byte("merkle/")
+	lastBlockKey    = []byte("meta/last_block")
+)
+
+// kvStore struct keeps state in embedded key-value database.
+// Objects are encoded with MessagePack and search queries
+// are evaluated by matching every object of collection.
+type kvStore struct {
+	db dbm.DB
+}
+
+// NewLevelDBStore method opens LevelDB database with given name in dir folder.
+func NewLevelDBStore(dir, name string) (Store, error) {
+	db, err := dbm.NewGoLevelDB(name, dir)
+	if err != nil {
+		return nil, err
+	}
+	return &kvStore{db}, nil
+}
+
+// NewMemoryStore method constructs store that keeps state in memory only.
+func NewMemoryStore() Store {
+	return &kvStore{dbm.NewMemDB()}
+}
+
+func (s *kvStore) GetAccount(id string) (*Account, error) {
+	bs := s.db.Get(objectKey(accountsPrefix, id))
+	if bs == nil {
+		return nil, ErrNotFound
+	}
+	return decodeAccount(bs)
+}
+
+func (s *kvStore) SearchAccounts(query interface{}, limit, offset int) ([]*Account, error) {
+	objs, err := s.search(accountsPrefix, query, limit, offset, func(bs []byte) (interface{}, error) {
+		return decodeAccount(bs)
+	})
+	if err != nil {
+		return nil, err
+	}
+	result := make([]*Account, len(objs))
+	for i, obj := range objs {
+		result[i] = obj.(*Account)
+	}
+	return result, nil
+}
+
+func (s *kvStore) GetPayload(id string) (*Payload, error) {
+	bs := s.db.Get(objectKey(payloadsPrefix, id))
+	if bs == nil {
+		return nil, ErrNotFound
+	}
+	return decodePayload(bs)
+}
+
+func (s *kvStore) SearchPayloads(query interface{}, limit, offset int) ([]*Payload, error) {
+	objs, err := s.search(payloadsPrefix, query, limit, offset, func(bs []byte) (interface{}, error) {
+		return decodePayload(bs)
+	})
+	if err != nil {
+		return nil, err
+	}
+	result := make([]*Payload, len(objs))
+	for i, obj := range objs {
+		result[i] = obj.(*Payload)
+	}
+	return result, nil
+}
+
+func (s *kvStore) GetRevision(id string, revision uint32) (*Payload, error) {
+	bs := s.db.Get(objectKey(revisionsPrefix, revisionID(id, revision)))
+	if bs == nil {
+		return nil, ErrNotFound
+	}
+	return decodePayload(bs)
+}
+
+func (s *kvStore) ListRevisions(id string) ([]*Payload, error) {
+	var result []*Payload
+	it := dbm.IteratePrefix(s.db, objectKey(revisionsPrefix, id+"/"))
+	defer it.Close()
+	for ; it.Valid(); it.Next() {
+		p, err := decodePayload(it.Value())
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, p)
+	}
+	return result, nil
+}
+
+func (s *kvStore) GetLastBlock() (*LastBlockInfo, error) {
+	lastBlock := &LastBlockInfo{}
+	bs := s.db.Get(lastBlockKey)
+	if bs == nil {
+		return lastBlock, nil
+	}
+	return lastBlock, json.Unmarshal(bs, lastBlock)
+}
+
+func (s *kvStore) IterateLeaves(fn func(key string, hash []byte)) error {
+	it := dbm.IteratePrefix(s.db, merklePrefix)
+	defer it.Close()
+	for ; it.Valid(); it.Next() {
+		fn(string(it.Key()[len(merklePrefix):]), it.Value())
+	}
+	return nil
+}
+
+func (s *kvStore) Commit(batch *Batch) error {
+	b := new(leveldb.Batch)
+	for id, acc := range batch.Accounts {
+		bs, err := acc.MarshalMsg(nil)
+		if err != nil {
+			return err
+		}
+		b.Put(objectKey(accountsPrefix, id), bs)
+	}
+	for id, data := range batch.Payloads {
+		bs, err := data.MarshalMsg(nil)
+		if err != nil {
+			return err
+		}
+		b.Put(objectKey(payloadsPrefix, id), bs)
+	}
+	for id, data := range batch.Revisions {
+		bs, err := data.MarshalMsg(nil)
+		if err != nil {
+			return err
+		}
+		b.Put(objectKey(revisionsPrefix, id), bs)
+	}
+	for key, hash := range batch.Leaves {
+		b.Put(objectKey(merklePrefix, key), hash)
+	}
+	bs, err := json.Marshal(batch.LastBlock)
+	if err != nil {
+		return err
+	}
+	b.Put(lastBlockKey, bs)
+	return s.write(b)
+}
+
+// write method writes batch atomically. Batch of LevelDB is synced to disk by
+// goleveldb directly, so error of write is returned instead of panic of dbm.
+func (s *kvStore) write(b *leveldb.Batch) error {
+	if db, ok := s.db.(*dbm.GoLevelDB); ok {
+		return db.DB().Write(b, &opt.WriteOptions{Sync: true})
+	}
+	mb := s.db.NewBatch()
+	if err := b.Replay(batchReplay{mb}); err != nil {
+		return err
+	}
+	mb.WriteSync()
+	return nil
+}
+
+// batchReplay struct copies entries of goleveldb batch to dbm batch.
+type batchReplay struct {
+	dbm.Batch
+}
+
+func (r batchReplay) Put(key, value []byte) {
+	r.Set(key, value)
+}
+
+func (s *kvStore) Stats() (map[string]interface{}, error) {
+	stats := make(map[string]interface{})
+	for k, v := range s.db.Stats() {
+		stats[k] = v
+	}
+	return stats, nil
+}
+
+func (s *kvStore) Close() {
+	s.db.Close()
+}
+
+// search method walks through objects with given prefix in order of keys
+// and returns objects matched by query.
+func (s *kvStore) search(prefix []byte, query interface{}, limit, offset int, decode func([]byte) (interface{}, error)) ([]interface{}, error) {
+	m, err := newMatcher(query)
+	if err != nil {
+		return nil, err
+	}
+	var result []interface{}
+	it := dbm.IteratePrefix(s.db, prefix)
+	defer it.Close()
+	for skipped := 0; it.Valid() && (limit <= 0 || len(result) < limit); it.Next() {
+		obj, err := decode(it.Value())
+		if err != nil {
+			return nil, err
+		}
+		ok, err := m.match(obj)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			continue
+		}
+		if skipped < offset {
+			skipped++
+			continue
+		}
+		result = append(result, obj)
+	}
+	return result, nil
+}
+
+func objectKey(prefix []byte, id string) []byte {
+	key := make([]byte, 0, len(prefix)+len(id))
+	return append(append(key, prefix...), id...)
+}
+
+func decodeAccount(bs []byte) (*Account, error) {
+	acc := &Account{}
+	_, err := acc.UnmarshalMsg(bs)
+	return acc, err
+}
+
+func decodePayload(bs []byte) (*Payload, error) {
+	p := &Payload{}
+	_, err := p.UnmarshalMsg(bs)
+	return p, err
+}
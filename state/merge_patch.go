@@ -0,0 +1,73 @@
+/*
+ * Copyright (C) 2018 eeonevision
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy of
+ * this software and associated documentation files (the "Software"), to deal in
+ * the Software without restriction, including without limitation the rights to
+ * use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+ * the Software, and to permit persons to whom the Software is furnished to do so,
+ * subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+ * FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+ * COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+ * IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+ * CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ */
+
+package state
+
+import "github.com/globalsign/mgo/bson"
+
+// MergePatch function applies JSON merge patch (RFC 7386) to the target
+// and returns the result. Target is not modified, changed objects are copied.
+// Null value of patch removes the member of target object.
+func MergePatch(target, patch interface{}) interface{} {
+	patchObj, ok := toObject(patch)
+	if !ok {
+		return patch
+	}
+	targetObj, ok := toObject(target)
+	if !ok {
+		targetObj = map[string]interface{}{}
+	}
+	result := make(map[string]interface{}, len(targetObj))
+	for k, v := range targetObj {
+		result[k] = v
+	}
+	for k, v := range patchObj {
+		if v == nil {
+			delete(result, k)
+			continue
+		}
+		result[k] = MergePatch(result[k], v)
+	}
+	return result
+}
+
+// toObject function converts JSON object decoded by JSON, MessagePack
+// or BSON decoders to map.
+func toObject(v interface{}) (map[string]interface{}, bool) {
+	switch obj := v.(type) {
+	case map[string]interface{}:
+		return obj, true
+	case bson.M:
+		return obj, true
+	case map[interface{}]interface{}:
+		result := make(map[string]interface{}, len(obj))
+		for k, v := range obj {
+			key, ok := k.(string)
+			if !ok {
+				return nil, false
+			}
+			result[key] = v
+		}
+		return result, true
+	default:
+		return nil, false
+	}
+}
@@ -0,0 +1,263 @@
+/*
+ * Copyright (C) 2018 eeonevision
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy of
+ * this software and associated documentation files (the "Software"), to deal in
+ * the Software without restriction, including without limitation the rights to
+ * use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+ * the Software, and to permit persons to whom the Software is furnished to do so,
+ * subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+ * FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+ * COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+ * IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+ * CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ */
+
+package state
+
+import (
+	"github.com/globalsign/mgo"
+	"github.com/globalsign/mgo/bson"
+)
+
+// Collection names in MongoDB.
+const (
+	accountsCollection  = "accounts"
+	payloadsCollection  = "data"
+	blocksCollection    = "blocks"
+	revisionsCollection = "revisions"
+	merkleCollection    = "merkle"
+	journalCollection   = "journal"
+)
+
+// journalCommitID is identifier of journal entry which marks the batch as committed.
+const journalCommitID = "commit"
+
+// mongoStore struct keeps state in MongoDB database.
+type mongoStore struct {
+	db *mgo.Database
+}
+
+// leaf struct keeps hash of state object stored in the Merkle tree.
+type leaf struct {
+	Key  string `bson:"_id"`
+	Hash []byte `bson:"hash"`
+}
+
+// revision struct keeps copy of payload at its revision.
+type revision struct {
+	ID        string   `bson:"_id"`
+	PayloadID string   `bson:"payload_id"`
+	Payload   *Payload `bson:"payload"`
+}
+
+// journalEntry struct keeps one change of the batch in journal.
+type journalEntry struct {
+	ID        string         `bson:"_id"`
+	Account   *Account       `bson:"account,omitempty"`
+	Payload   *Payload       `bson:"payload,omitempty"`
+	Revision  *revision      `bson:"revision,omitempty"`
+	Leaf      *leaf          `bson:"leaf,omitempty"`
+	LastBlock *LastBlockInfo `bson:"last_block,omitempty"`
+}
+
+// NewMongoStore method connects to MongoDB server and constructs store.
+// Batch left in journal by interrupted commit is recovered here.
+func NewMongoStore(host, name string) (Store, error) {
+	session, err := mgo.Dial(host)
+	if err != nil {
+		return nil, err
+	}
+	s := &mongoStore{session.DB(name)}
+	if err := s.recover(); err != nil {
+		session.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *mongoStore) GetAccount(id string) (*Account, error) {
+	var result *Account
+	return result, mongoError(s.db.C(accountsCollection).FindId(id).One(&result))
+}
+
+func (s *mongoStore) SearchAccounts(query interface{}, limit, offset int) (result []*Account, err error) {
+	return result, s.db.C(accountsCollection).Find(query).Skip(offset).Limit(limit).All(&result)
+}
+
+func (s *mongoStore) GetPayload(id string) (*Payload, error) {
+	var result *Payload
+	return result, mongoError(s.db.C(payloadsCollection).FindId(id).One(&result))
+}
+
+func (s *mongoStore) SearchPayloads(query interface{}, limit, offset int) (result []*Payload, err error) {
+	return result, s.db.C(payloadsCollection).Find(query).Skip(offset).Limit(limit).All(&result)
+}
+
+func (s *mongoStore) GetRevision(id string, rev uint32) (*Payload, error) {
+	var result *revision
+	if err := s.db.C(revisionsCollection).FindId(revisionID(id, rev)).One(&result); err != nil {
+		return nil, mongoError(err)
+	}
+	return result.Payload, nil
+}
+
+func (s *mongoStore) ListRevisions(id string) ([]*Payload, error) {
+	var revs []*revision
+	if err := s.db.C(revisionsCollection).Find(bson.M{"payload_id": id}).Sort("_id").All(&revs); err != nil {
+		return nil, err
+	}
+	result := make([]*Payload, len(revs))
+	for i, rev := range revs {
+		result[i] = rev.Payload
+	}
+	return result, nil
+}
+
+func (s *mongoStore) GetLastBlock() (*LastBlockInfo, error) {
+	lastBlock := &LastBlockInfo{}
+	if err := s.db.C(blocksCollection).Find(nil).One(lastBlock); err != nil && err != mgo.ErrNotFound {
+		return nil, err
+	}
+	return lastBlock, nil
+}
+
+func (s *mongoStore) IterateLeaves(fn func(key string, hash []byte)) error {
+	var l leaf
+	iter := s.db.C(merkleCollection).Find(nil).Iter()
+	for iter.Next(&l) {
+		fn(l.Key, l.Hash)
+	}
+	return iter.Close()
+}
+
+// Commit method writes batch to journal first and marks it as committed
+// by single insert of commit entry. Only then changes are applied to
+// collections, so interrupted commit can be finished or discarded on restart.
+func (s *mongoStore) Commit(batch *Batch) error {
+	journal := s.db.C(journalCollection)
+	if _, err := journal.RemoveAll(nil); err != nil {
+		return err
+	}
+	var entries []interface{}
+	for id, acc := range batch.Accounts {
+		entries = append(entries, &journalEntry{ID: accountsCollection + "/" + id, Account: acc})
+	}
+	for id, data := range batch.Payloads {
+		entries = append(entries, &journalEntry{ID: payloadsCollection + "/" + id, Payload: data})
+	}
+	for id, data := range batch.Revisions {
+		entries = append(entries, &journalEntry{ID: revisionsCollection + "/" + id, Revision: &revision{id, data.ID, data}})
+	}
+	for key, hash := range batch.Leaves {
+		entries = append(entries, &journalEntry{ID: merkleCollection + "/" + key, Leaf: &leaf{key, hash}})
+	}
+	if len(entries) > 0 {
+		if err := journal.Insert(entries...); err != nil {
+			return err
+		}
+	}
+	if err := journal.Insert(&journalEntry{ID: journalCommitID, LastBlock: batch.LastBlock}); err != nil {
+		return err
+	}
+	if err := s.apply(batch); err != nil {
+		return err
+	}
+	_, err := journal.RemoveAll(nil)
+	return err
+}
+
+// apply method writes changes of the batch to collections.
+// All writes are upserts, so batch can be applied several times.
+func (s *mongoStore) apply(batch *Batch) error {
+	for id, acc := range batch.Accounts {
+		if _, err := s.db.C(accountsCollection).UpsertId(id, acc); err != nil {
+			return err
+		}
+	}
+	for id, data := range batch.Payloads {
+		if _, err := s.db.C(payloadsCollection).UpsertId(id, data); err != nil {
+			return err
+		}
+	}
+	for id, data := range batch.Revisions {
+		if _, err := s.db.C(revisionsCollection).UpsertId(id, &revision{id, data.ID, data}); err != nil {
+			return err
+		}
+	}
+	for key, hash := range batch.Leaves {
+		if _, err := s.db.C(merkleCollection).UpsertId(key, bson.M{"$set": bson.M{"hash": hash}}); err != nil {
+			return err
+		}
+	}
+	_, err := s.db.C(blocksCollection).Upsert(nil, bson.M{
+		"$set": bson.M{
+			"height":     batch.LastBlock.Height,
+			"app_hash":   batch.LastBlock.AppHash,
+			"chain_id":   batch.LastBlock.ChainID,
+			"params":     batch.LastBlock.Params,
+			"validators": batch.LastBlock.Validators,
+		},
+	})
+	return err
+}
+
+// recover method finishes commit interrupted after batch was marked as committed.
+// Journal without commit entry belongs to block which was not committed
+// and is discarded, Tendermint replays such block again.
+func (s *mongoStore) recover() error {
+	journal := s.db.C(journalCollection)
+	var entry journalEntry
+	if err := journal.FindId(journalCommitID).One(&entry); err == mgo.ErrNotFound {
+		_, err = journal.RemoveAll(nil)
+		return err
+	} else if err != nil {
+		return err
+	}
+	batch := NewBatch()
+	batch.LastBlock = entry.LastBlock
+	iter := journal.Find(bson.M{"_id": bson.M{"$ne": journalCommitID}}).Iter()
+	for e := (journalEntry{}); iter.Next(&e); e = (journalEntry{}) {
+		switch {
+		case e.Account != nil:
+			batch.Accounts[e.Account.ID] = e.Account
+		case e.Payload != nil:
+			batch.Payloads[e.Payload.ID] = e.Payload
+		case e.Revision != nil:
+			batch.Revisions[e.Revision.ID] = e.Revision.Payload
+		case e.Leaf != nil:
+			batch.Leaves[e.Leaf.Key] = e.Leaf.Hash
+		}
+	}
+	if err := iter.Close(); err != nil {
+		return err
+	}
+	if err := s.apply(batch); err != nil {
+		return err
+	}
+	_, err := journal.RemoveAll(nil)
+	return err
+}
+
+func (s *mongoStore) Stats() (map[string]interface{}, error) {
+	var stats map[string]interface{}
+	return stats, s.db.Run(bson.M{"dbStats": 1}, &stats)
+}
+
+func (s *mongoStore) Close() {
+	s.db.Session.Close()
+}
+
+// mongoError converts MongoDB errors to the state errors.
+func mongoError(err error) error {
+	if err == mgo.ErrNotFound {
+		return ErrNotFound
+	}
+	return err
+}
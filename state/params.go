@@ -0,0 +1,104 @@
+/*
+ * Copyright (C) 2018 eeonevision
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy of
+ * this software and associated documentation files (the "Software"), to deal in
+ * the Software without restriction, including without limitation the rights to
+ * use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+ * the Software, and to permit persons to whom the Software is furnished to do so,
+ * subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+ * FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+ * COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+ * IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+ * CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ */
+
+package state
+
+import (
+	"errors"
+)
+
+// Policies of account admission.
+const (
+	AdmissionOpen      = "open"
+	AdmissionPoW       = "pow"
+	AdmissionRegistrar = "registrar"
+)
+
+// MaxPoWDifficulty is the maximal difficulty of proof-of-work in bits.
+const MaxPoWDifficulty = 64
+
+// ParamsKey is key of chain parameters in Merkle tree.
+const ParamsKey = "params"
+
+// Params struct keeps parameters of the chain, which are chosen in genesis.
+//   - AccountAdmission is policy of account creation: open (default), pow or registrar;
+//   - PoWDifficulty is number of leading zero bits of proof-of-work hash of new account;
+//   - Registrars are accounts, which co-sign new accounts under registrar policy;
+//   - Permissioned enables roles: new accounts are co-signed by registrars and
+//     payloads are written only by writers, see RoleAdmin.
+type Params struct {
+	AccountAdmission string   `bson:"account_admission,omitempty" json:"account_admission,omitempty"`
+	PoWDifficulty    uint32   `bson:"pow_difficulty,omitempty" json:"pow_difficulty,omitempty"`
+	Registrars       []string `bson:"registrars,omitempty" json:"registrars,omitempty"`
+	Permissioned     bool     `bson:"permissioned,omitempty" json:"permissioned,omitempty"`
+}
+
+// Validate method checks that parameters are consistent.
+func (p *Params) Validate() error {
+	switch p.AccountAdmission {
+	case "", AdmissionOpen:
+	case AdmissionPoW:
+		if p.PoWDifficulty == 0 || p.PoWDifficulty > MaxPoWDifficulty {
+			return errors.New("proof-of-work difficulty should be between 1 and 64 bits")
+		}
+	case AdmissionRegistrar:
+		if len(p.Registrars) == 0 {
+			return errors.New("registrar admission requires at least one registrar")
+		}
+	default:
+		return errors.New("unknown account admission policy: " + p.AccountAdmission)
+	}
+	return nil
+}
+
+// IsRegistrar method checks if account is whitelisted registrar.
+func (p *Params) IsRegistrar(id string) bool {
+	for _, r := range p.Registrars {
+		if r == id {
+			return true
+		}
+	}
+	return false
+}
+
+// copy method returns parameters, which do not share registrars with p.
+func (p Params) copy() Params {
+	p.Registrars = append([]string(nil), p.Registrars...)
+	return p
+}
+
+// Params method returns parameters of the chain.
+func (s *State) Params() Params {
+	return s.params
+}
+
+// SetParams method defines parameters of the chain. They are included into
+// Merkle tree and written to the storage together with the next committed block.
+func (s *State) SetParams(params Params) error {
+	if err := params.Validate(); err != nil {
+		return err
+	}
+	if err := s.setLeaf(ParamsKey, params); err != nil {
+		return err
+	}
+	s.params = params
+	return nil
+}
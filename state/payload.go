@@ -23,42 +23,219 @@ package state
 
 import (
 	"errors"
+	"fmt"
 )
 
 //go:generate msgp
 
 // PrivateData keeps information about receiver and data,
-// encrypted by receiver's public key
+// encrypted by receiver's public key. If Envelope is set, data is
+// the content key of envelope with this id, encrypted by receiver's public key.
 type PrivateData struct {
 	ReceiverAccountID string      `msg:"receiver_account_id" json:"receiver_account_id" mapstructure:"receiver_account_id" bson:"receiver_account_id"`
 	Data              interface{} `msg:"data" json:"data" mapstructure:"data" bson:"data"`
+	Envelope          string      `msg:"envelope" json:"envelope,omitempty" mapstructure:"envelope" bson:"envelope,omitempty"`
+}
+
+// Envelope keeps private data encrypted once by random content key,
+// which is shared by several receivers. Data is base64 encoded ciphertext.
+type Envelope struct {
+	ID   string `msg:"id" json:"id" mapstructure:"id" bson:"id"`
+	Data string `msg:"data" json:"data" mapstructure:"data" bson:"data"`
 }
 
 // Payload struct keeps transaction data related fields.
 //   - PublicData keeps open data of any structure;
 //   - PrivateData keeps encrypted data set by receiver's public key with ECDH algorithm and represented as base64 string;
-//   - CreatedAt is date of object creation in UNIX time (milliseconds).
+//   - Envelopes keep private data encrypted once for several receivers, whose content keys are kept in PrivateData;
+//   - CreatedAt is date of object creation in UNIX time (milliseconds);
+//   - Revision is number of updates of the payload;
+//   - UpdatedAt is date of the last update in UNIX time (milliseconds);
+//   - Revoked is set when payload was withdrawn by its sender.
 type Payload struct {
 	ID              string         `msg:"_id" json:"_id" mapstructure:"_id" bson:"_id"`
 	SenderAccountID string         `msg:"sender_account_id" json:"sender_account_id" mapstructure:"sender_account_id" bson:"sender_account_id"`
 	PublicData      interface{}    `msg:"public_data" json:"public_data" mapstructure:"public_data" bson:"public_data"`
 	PrivateData     []*PrivateData `msg:"private_data" json:"private_data" mapstructure:"private_data" bson:"private_data"`
+	Envelopes       []*Envelope    `msg:"envelopes" json:"envelopes,omitempty" mapstructure:"envelopes" bson:"envelopes,omitempty"`
 	CreatedAt       float64        `msg:"created_at" json:"created_at" mapstructure:"created_at" bson:"created_at"`
+	Revision        uint32         `msg:"revision" json:"revision" mapstructure:"revision" bson:"revision"`
+	UpdatedAt       float64        `msg:"updated_at" json:"updated_at,omitempty" mapstructure:"updated_at" bson:"updated_at,omitempty"`
+	Revoked         *Revocation    `msg:"revoked" json:"revoked,omitempty" mapstructure:"revoked" bson:"revoked,omitempty"`
+}
+
+// Revocation struct marks payload as withdrawn by its sender
+// with the reason and height of block, where it was revoked.
+type Revocation struct {
+	Reason string `msg:"reason" json:"reason" mapstructure:"reason" bson:"reason"`
+	Height int64  `msg:"height" json:"height" mapstructure:"height" bson:"height"`
+}
+
+// PrivateDataGrant struct keeps data of transaction, which shares private data
+// of payload with new receiver. Data of new entry is re-encrypted by receiver's key.
+type PrivateDataGrant struct {
+	ID          string       `msg:"_id" json:"_id" mapstructure:"_id" bson:"_id"`
+	PrivateData *PrivateData `msg:"private_data" json:"private_data" mapstructure:"private_data" bson:"private_data"`
+}
+
+// PayloadRevocation struct keeps data of transaction, which revokes payload.
+type PayloadRevocation struct {
+	ID     string `msg:"_id" json:"_id" mapstructure:"_id" bson:"_id"`
+	Reason string `msg:"reason" json:"reason" mapstructure:"reason" bson:"reason"`
+}
+
+// PayloadUpdate struct keeps data of transaction, which updates public data of payload.
+//   - PublicData replaces public data of payload or is applied to it as JSON merge patch (RFC 7386) if MergePatch is set;
+//   - ExpectedRevision, if set, should be equal to the current revision of payload.
+type PayloadUpdate struct {
+	ID               string      `msg:"_id" json:"_id" mapstructure:"_id" bson:"_id"`
+	PublicData       interface{} `msg:"public_data" json:"public_data" mapstructure:"public_data" bson:"public_data"`
+	MergePatch       bool        `msg:"merge_patch" json:"merge_patch" mapstructure:"merge_patch" bson:"merge_patch"`
+	ExpectedRevision *uint32     `msg:"expected_revision" json:"expected_revision,omitempty" mapstructure:"expected_revision" bson:"expected_revision,omitempty"`
 }
 
-const payloadsCollection = "data"
+// GetEnvelope method returns envelope of payload by its id.
+func (p *Payload) GetEnvelope(id string) *Envelope {
+	for _, e := range p.Envelopes {
+		if e.ID == id {
+			return e
+		}
+	}
+	return nil
+}
+
+// PayloadKey returns key of payload in Merkle tree.
+func PayloadKey(id string) string {
+	return "payloads/" + id
+}
+
+// RevisionKey returns key of payload revision in Merkle tree.
+func RevisionKey(id string, revision uint32) string {
+	return "revisions/" + revisionID(id, revision)
+}
+
+// revisionID returns identifier of payload revision in storage.
+// Revisions of payload are ordered by their identifiers.
+func revisionID(id string, revision uint32) string {
+	return fmt.Sprintf("%s/%010d", id, revision)
+}
 
 // AddPayload method adds new payload to the state if it not exists.
 func (s *State) AddPayload(data *Payload) error {
 	if s.HasPayload(data.ID) {
 		return errors.New("payload exists")
 	}
-	return s.SetPayload(data)
+	if err := s.SetPayload(data); err != nil {
+		return err
+	}
+	return s.setRevision(data)
+}
+
+// UpdatePayload method applies update to public data of payload and keeps
+// the new revision together with all previous ones.
+func (s *State) UpdatePayload(update *PayloadUpdate, updatedAt float64) error {
+	current, err := s.GetPayload(update.ID)
+	if err != nil {
+		return err
+	}
+	if current.Revoked != nil {
+		return errors.New("payload is revoked")
+	}
+	if update.ExpectedRevision != nil && *update.ExpectedRevision != current.Revision {
+		return fmt.Errorf("revision conflict: expected %d, current %d", *update.ExpectedRevision, current.Revision)
+	}
+	updated := *current
+	if update.MergePatch {
+		updated.PublicData = MergePatch(current.PublicData, update.PublicData)
+	} else {
+		updated.PublicData = update.PublicData
+	}
+	updated.UpdatedAt = updatedAt
+	return s.setNextRevision(&updated)
+}
+
+// RevokePayload method marks payload as revoked at given height. Revocation
+// is kept as the new revision, so previous revisions stay in history.
+func (s *State) RevokePayload(revocation *PayloadRevocation, height int64) error {
+	current, err := s.GetPayload(revocation.ID)
+	if err != nil {
+		return err
+	}
+	if current.Revoked != nil {
+		return errors.New("payload is already revoked")
+	}
+	updated := *current
+	updated.Revoked = &Revocation{Reason: revocation.Reason, Height: height}
+	return s.setNextRevision(&updated)
+}
+
+// GrantPrivateData method appends private data entry of new receiver
+// to payload. Grant is kept as the new revision of payload.
+func (s *State) GrantPrivateData(grant *PrivateDataGrant) error {
+	current, err := s.GetPayload(grant.ID)
+	if err != nil {
+		return err
+	}
+	if current.Revoked != nil {
+		return errors.New("payload is revoked")
+	}
+	for _, p := range current.PrivateData {
+		if p.ReceiverAccountID == grant.PrivateData.ReceiverAccountID {
+			return errors.New("private data is already shared with receiver")
+		}
+	}
+	updated := *current
+	updated.PrivateData = append(append([]*PrivateData{}, current.PrivateData...), grant.PrivateData)
+	return s.setNextRevision(&updated)
+}
+
+// setNextRevision method increments revision of changed payload and keeps it.
+func (s *State) setNextRevision(updated *Payload) error {
+	updated.Revision++
+	if err := s.SetPayload(updated); err != nil {
+		return err
+	}
+	return s.setRevision(updated)
+}
+
+// setRevision method keeps copy of payload as its revision.
+func (s *State) setRevision(data *Payload) error {
+	if err := s.setLeaf(RevisionKey(data.ID, data.Revision), data); err != nil {
+		return err
+	}
+	s.batch.Revisions[revisionID(data.ID, data.Revision)] = data
+	return nil
+}
+
+// getRevision method returns kept revision of payload.
+func (s *State) getRevision(id string, revision uint32) (*Payload, error) {
+	if data, ok := s.batch.Revisions[revisionID(id, revision)]; ok {
+		return data, nil
+	}
+	return s.store.GetRevision(id, revision)
+}
+
+// GetPayloadRevision method returns payload as it was at given revision.
+func (s *State) GetPayloadRevision(id string, revision uint32) (*Payload, error) {
+	return s.getRevision(id, revision)
+}
+
+// ListPayloadRevisions method returns all committed revisions of payload in order.
+func (s *State) ListPayloadRevisions(id string) ([]*Payload, error) {
+	result, err := s.store.ListRevisions(id)
+	if err == nil && len(result) == 0 {
+		return nil, ErrNotFound
+	}
+	return result, err
 }
 
 // SetPayload inserts new payload to state without any checks.
 func (s *State) SetPayload(data *Payload) error {
-	return s.DB.C(payloadsCollection).Insert(data)
+	if err := s.setLeaf(PayloadKey(data.ID), data); err != nil {
+		return err
+	}
+	s.batch.Payloads[data.ID] = data
+	return nil
 }
 
 // HasPayload method checks exists payload in state ot not.
@@ -71,11 +248,34 @@ func (s *State) HasPayload(id string) bool {
 
 // GetPayload method gets data from state by it identifier.
 func (s *State) GetPayload(id string) (*Payload, error) {
-	var result *Payload
-	return result, s.DB.C(payloadsCollection).FindId(id).One(&result)
+	if data, ok := s.batch.Payloads[id]; ok {
+		return data, nil
+	}
+	return s.store.GetPayload(id)
+}
+
+// ProvePayload method returns committed payload and proof of its inclusion
+// in the state of last committed block. Absent payload is returned as nil
+// together with proof of its absence.
+func (s *State) ProvePayload(id string) (*Payload, *Proof, error) {
+	data, err := s.store.GetPayload(id)
+	if err != nil && err != ErrNotFound {
+		return nil, nil, err
+	}
+	_, proof := s.committed.Prove(PayloadKey(id))
+	return data, proof, nil
 }
 
-// SearchPayloads method finds payloads using mongodb query language.
-func (s *State) SearchPayloads(query interface{}, limit, offset int) (result []*Payload, err error) {
-	return result, s.DB.C(payloadsCollection).Find(query).Skip(offset).Limit(limit).All(&result)
+// SearchPayloads method finds committed payloads using mongodb query language.
+// Revoked payloads are excluded from result unless includeRevoked is set.
+func (s *State) SearchPayloads(query interface{}, limit, offset int, includeRevoked bool) (result []*Payload, err error) {
+	if !includeRevoked {
+		notRevoked := map[string]interface{}{"revoked": map[string]interface{}{"$exists": false}}
+		if query == nil {
+			query = notRevoked
+		} else {
+			query = map[string]interface{}{"$and": []interface{}{query, notRevoked}}
+		}
+	}
+	return s.store.SearchPayloads(query, limit, offset)
 }
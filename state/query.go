@@ -0,0 +1,344 @@
+/*
+ * Copyright (C) 2018 eeonevision
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy of
+ * this software and associated documentation files (the "Software"), to deal in
+ * the Software without restriction, including without limitation the rights to
+ * use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+ * the Software, and to permit persons to whom the Software is furnished to do so,
+ * subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+ * FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+ * COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+ * IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+ * CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ */
+
+package state
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// matcher struct evaluates search queries in MongoDB query language
+// for storage backends which have no own query engine.
+// Supported operators: $and, $or, $nor, $eq, $ne, $gt, $gte, $lt, $lte,
+// $in, $nin, $exists, $regex, $options, $not, $size, $all, $elemMatch.
+type matcher struct {
+	query map[string]interface{}
+}
+
+// newMatcher method constructs matcher. Empty query matches all objects.
+func newMatcher(query interface{}) (*matcher, error) {
+	q, err := normalize(query)
+	if err != nil {
+		return nil, err
+	}
+	switch v := q.(type) {
+	case nil:
+		return &matcher{}, nil
+	case map[string]interface{}:
+		return &matcher{v}, nil
+	default:
+		return nil, errors.New("search query should be an object")
+	}
+}
+
+// match method checks that object satisfies query.
+func (m *matcher) match(obj interface{}) (bool, error) {
+	if len(m.query) == 0 {
+		return true, nil
+	}
+	doc, err := normalize(obj)
+	if err != nil {
+		return false, err
+	}
+	return matchDocument(doc, m.query)
+}
+
+// normalize converts value to the generic JSON types,
+// so numbers of any kind are compared as float64.
+func normalize(v interface{}) (interface{}, error) {
+	bs, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var res interface{}
+	return res, json.Unmarshal(bs, &res)
+}
+
+func matchDocument(doc interface{}, query map[string]interface{}) (bool, error) {
+	for key, cond := range query {
+		var (
+			ok  bool
+			err error
+		)
+		switch key {
+		case "$and", "$or", "$nor":
+			ok, err = matchLogical(doc, key, cond)
+		default:
+			if strings.HasPrefix(key, "$") {
+				return false, errors.New("unsupported query operator: " + key)
+			}
+			values := lookup(doc, strings.Split(key, "."))
+			if ops, isOps := operators(cond); isOps {
+				ok, err = matchOperators(values, ops)
+			} else {
+				ok = contains(values, cond) || (cond == nil && len(values) == 0)
+			}
+		}
+		if err != nil || !ok {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+func matchLogical(doc interface{}, op string, cond interface{}) (bool, error) {
+	list, ok := cond.([]interface{})
+	if !ok || len(list) == 0 {
+		return false, errors.New(op + " should be a nonempty array")
+	}
+	for _, item := range list {
+		q, ok := item.(map[string]interface{})
+		if !ok {
+			return false, errors.New(op + " should contain objects")
+		}
+		res, err := matchDocument(doc, q)
+		if err != nil {
+			return false, err
+		}
+		switch {
+		case op == "$and" && !res:
+			return false, nil
+		case op == "$or" && res:
+			return true, nil
+		case op == "$nor" && res:
+			return false, nil
+		}
+	}
+	return op != "$or", nil
+}
+
+// operators returns condition as a set of operators if all of its keys are operators.
+func operators(cond interface{}) (map[string]interface{}, bool) {
+	m, ok := cond.(map[string]interface{})
+	if !ok || len(m) == 0 {
+		return nil, false
+	}
+	for k := range m {
+		if !strings.HasPrefix(k, "$") {
+			return nil, false
+		}
+	}
+	return m, true
+}
+
+func matchOperators(values []interface{}, ops map[string]interface{}) (bool, error) {
+	for op, arg := range ops {
+		ok, err := matchOperator(values, op, arg, ops)
+		if err != nil || !ok {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+func matchOperator(values []interface{}, op string, arg interface{}, ops map[string]interface{}) (bool, error) {
+	switch op {
+	case "$eq":
+		return contains(values, arg), nil
+	case "$ne":
+		return !contains(values, arg), nil
+	case "$gt", "$gte", "$lt", "$lte":
+		for _, v := range values {
+			c, ok := compare(v, arg)
+			if !ok {
+				continue
+			}
+			if (op == "$gt" && c > 0) || (op == "$gte" && c >= 0) ||
+				(op == "$lt" && c < 0) || (op == "$lte" && c <= 0) {
+				return true, nil
+			}
+		}
+		return false, nil
+	case "$in", "$nin":
+		list, ok := arg.([]interface{})
+		if !ok {
+			return false, errors.New(op + " should be an array")
+		}
+		found := false
+		for _, item := range list {
+			if contains(values, item) {
+				found = true
+				break
+			}
+		}
+		return found == (op == "$in"), nil
+	case "$exists":
+		exists, ok := arg.(bool)
+		if !ok {
+			return false, errors.New("$exists should be a boolean")
+		}
+		return (len(values) > 0) == exists, nil
+	case "$regex":
+		pattern, ok := arg.(string)
+		if !ok {
+			return false, errors.New("$regex should be a string")
+		}
+		if opts, ok := ops["$options"].(string); ok && opts != "" {
+			pattern = "(?" + opts + ")" + pattern
+		}
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return false, err
+		}
+		for _, v := range values {
+			if s, ok := v.(string); ok && re.MatchString(s) {
+				return true, nil
+			}
+		}
+		return false, nil
+	case "$options":
+		return true, nil
+	case "$not":
+		sub, ok := operators(arg)
+		if !ok {
+			return false, errors.New("$not should contain operators")
+		}
+		res, err := matchOperators(values, sub)
+		return !res, err
+	case "$size":
+		size, ok := arg.(float64)
+		if !ok {
+			return false, errors.New("$size should be a number")
+		}
+		for _, v := range values {
+			if arr, ok := v.([]interface{}); ok && float64(len(arr)) == size {
+				return true, nil
+			}
+		}
+		return false, nil
+	case "$all":
+		list, ok := arg.([]interface{})
+		if !ok {
+			return false, errors.New("$all should be an array")
+		}
+		for _, item := range list {
+			if !contains(values, item) {
+				return false, nil
+			}
+		}
+		return len(list) > 0, nil
+	case "$elemMatch":
+		q, ok := arg.(map[string]interface{})
+		if !ok {
+			return false, errors.New("$elemMatch should be an object")
+		}
+		for _, v := range values {
+			arr, ok := v.([]interface{})
+			if !ok {
+				continue
+			}
+			for _, elem := range arr {
+				var (
+					res bool
+					err error
+				)
+				if sub, isOps := operators(q); isOps {
+					res, err = matchOperators([]interface{}{elem}, sub)
+				} else {
+					res, err = matchDocument(elem, q)
+				}
+				if err != nil {
+					return false, err
+				}
+				if res {
+					return true, nil
+				}
+			}
+		}
+		return false, nil
+	default:
+		return false, errors.New("unsupported query operator: " + op)
+	}
+}
+
+// lookup returns all values found by dotted path.
+// Arrays on the path are traversed element by element and
+// found arrays are returned together with their elements.
+func lookup(v interface{}, path []string) []interface{} {
+	if len(path) == 0 {
+		if arr, ok := v.([]interface{}); ok {
+			return append([]interface{}{v}, arr...)
+		}
+		return []interface{}{v}
+	}
+	switch t := v.(type) {
+	case map[string]interface{}:
+		child, ok := t[path[0]]
+		if !ok {
+			return nil
+		}
+		return lookup(child, path[1:])
+	case []interface{}:
+		if i, err := strconv.Atoi(path[0]); err == nil {
+			if i < 0 || i >= len(t) {
+				return nil
+			}
+			return lookup(t[i], path[1:])
+		}
+		var res []interface{}
+		for _, elem := range t {
+			if _, ok := elem.(map[string]interface{}); ok {
+				res = append(res, lookup(elem, path)...)
+			}
+		}
+		return res
+	}
+	return nil
+}
+
+func contains(values []interface{}, v interface{}) bool {
+	for _, value := range values {
+		if reflect.DeepEqual(value, v) {
+			return true
+		}
+	}
+	return false
+}
+
+// compare returns sign of difference between values of same type.
+func compare(a, b interface{}) (int, bool) {
+	switch x := a.(type) {
+	case float64:
+		y, ok := b.(float64)
+		if !ok {
+			return 0, false
+		}
+		switch {
+		case x < y:
+			return -1, true
+		case x > y:
+			return 1, true
+		}
+		return 0, true
+	case string:
+		y, ok := b.(string)
+		if !ok {
+			return 0, false
+		}
+		return strings.Compare(x, y), true
+	}
+	return 0, false
+}
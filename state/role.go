@@ -0,0 +1,100 @@
+/*
+ * Copyright (C) 2018 eeonevision
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy of
+ * this software and associated documentation files (the "Software"), to deal in
+ * the Software without restriction, including without limitation the rights to
+ * use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+ * the Software, and to permit persons to whom the Software is furnished to do so,
+ * subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+ * FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+ * COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+ * IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+ * CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ */
+
+package state
+
+import (
+	"errors"
+)
+
+//go:generate msgp
+
+// Roles of accounts in permissioned network.
+//   - admin grants and revokes roles, and has all other roles;
+//   - registrar co-signs new accounts;
+//   - writer posts and changes payloads;
+//   - reader only reads data.
+const (
+	RoleAdmin     = "admin"
+	RoleRegistrar = "registrar"
+	RoleWriter    = "writer"
+	RoleReader    = "reader"
+)
+
+// RoleChange struct keeps data of transaction, which grants or revokes role of account.
+type RoleChange struct {
+	AccountID string `msg:"account_id" json:"account_id" mapstructure:"account_id" bson:"account_id"`
+	Role      string `msg:"role" json:"role" mapstructure:"role" bson:"role"`
+}
+
+// IsRole function checks if role is known.
+func IsRole(role string) bool {
+	switch role {
+	case RoleAdmin, RoleRegistrar, RoleWriter, RoleReader:
+		return true
+	}
+	return false
+}
+
+// HasRole method checks if account has given role. Admin has all roles.
+func (a *Account) HasRole(role string) bool {
+	for _, r := range a.Roles {
+		if r == role || r == RoleAdmin {
+			return true
+		}
+	}
+	return false
+}
+
+// GrantRole method adds role to account.
+func (s *State) GrantRole(id, role string) error {
+	acc, err := s.GetAccount(id)
+	if err != nil {
+		return err
+	}
+	for _, r := range acc.Roles {
+		if r == role {
+			return errors.New("account already has role " + role)
+		}
+	}
+	updated := *acc
+	updated.Roles = append(append([]string{}, acc.Roles...), role)
+	return s.SetAccount(&updated)
+}
+
+// RevokeRole method removes role from account.
+func (s *State) RevokeRole(id, role string) error {
+	acc, err := s.GetAccount(id)
+	if err != nil {
+		return err
+	}
+	updated := *acc
+	updated.Roles = nil
+	for _, r := range acc.Roles {
+		if r != role {
+			updated.Roles = append(updated.Roles, r)
+		}
+	}
+	if len(updated.Roles) == len(acc.Roles) {
+		return errors.New("account has no role " + role)
+	}
+	return s.SetAccount(&updated)
+}
@@ -22,15 +22,156 @@
 package state
 
 import (
-	"github.com/globalsign/mgo"
+	"bytes"
+	"errors"
+	"fmt"
 )
 
-// State struct contains pointer to MongoDB instance.
+// State struct contains storage backend, Merkle tree of accounts and payloads
+// and batch of changes made by current block. Changes are visible for reads
+// immediately, but they are written to storage only on commit of block.
 type State struct {
-	DB *mgo.Database
+	store     Store
+	tree      *Tree
+	committed *Tree
+	batch     *Batch
+	lastBlock LastBlockInfo
+	chainID   string
+	params    Params
+	check     bool
+	// Validators and their updates applied by the current block
+	validators       ValidatorSet
+	validatorUpdates []ValidatorUpdate
 }
 
-// NewStateFromDB method constructs MongoDB state.
-func NewStateFromDB(db *mgo.Database) *State {
-	return &State{db}
+// NewState method constructs state over given storage and loads Merkle tree from it.
+// Loaded tree should match the app hash of last committed block. Storage of
+// versions without Merkle tree is rejected, it is not upgraded in place.
+func NewState(store Store) (*State, error) {
+	lastBlock, err := store.GetLastBlock()
+	if err != nil {
+		return nil, err
+	}
+	s := &State{store: store, tree: NewTree(), batch: NewBatch(), lastBlock: *lastBlock, chainID: lastBlock.ChainID}
+	if lastBlock.Params != nil {
+		s.params = *lastBlock.Params
+	}
+	if lastBlock.Validators != nil {
+		s.validators = *lastBlock.Validators
+	}
+	err = store.IterateLeaves(func(key string, hash []byte) {
+		s.tree.Set(key, hash)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if s.tree.Hash() == nil {
+		if err := checkEmptyStore(store); err != nil {
+			return nil, err
+		}
+	}
+	if hash := s.tree.Hash(); !bytes.Equal(hash, lastBlock.AppHash) {
+		return nil, fmt.Errorf("state hash %X does not match app hash %X of last block %d",
+			hash, lastBlock.AppHash, lastBlock.Height)
+	}
+	s.committed = s.tree.Copy()
+	return s, nil
+}
+
+// checkEmptyStore function checks that storage without Merkle tree has no
+// accounts and payloads. They are written by versions, which didn't keep the
+// tree, and can't be upgraded in place, so a new chain should be started with
+// them in genesis.
+func checkEmptyStore(store Store) error {
+	accounts, err := store.SearchAccounts(nil, 1, 0)
+	if err != nil {
+		return err
+	}
+	payloads, err := store.SearchPayloads(nil, 1, 0)
+	if err != nil {
+		return err
+	}
+	if len(accounts) > 0 || len(payloads) > 0 {
+		return errors.New("storage has state without Merkle tree, start a new chain with it in genesis app_state")
+	}
+	return nil
+}
+
+// NewCheckState method returns state for checking of mempool transactions.
+// It reads committed state from the same storage, but keeps own changes,
+// which are never written to storage. Parameters and validators are copied,
+// so changes of check state never reach the state it was made of.
+func (s *State) NewCheckState() *State {
+	return &State{
+		store:      s.store,
+		tree:       s.tree.Copy(),
+		committed:  s.committed,
+		batch:      NewBatch(),
+		lastBlock:  s.lastBlock,
+		chainID:    s.chainID,
+		params:     s.params.copy(),
+		check:      true,
+		validators: s.validators.copy(),
+	}
+}
+
+// Hash method returns root hash of Merkle tree of the state.
+func (s *State) Hash() []byte {
+	return s.tree.Hash()
+}
+
+// Stats method returns statistics of the storage.
+func (s *State) Stats() (map[string]interface{}, error) {
+	return s.store.Stats()
+}
+
+// LastBlock method returns info of last committed block.
+func (s *State) LastBlock() LastBlockInfo {
+	return s.lastBlock
+}
+
+// ChainID method returns id of the chain, which state belongs to.
+func (s *State) ChainID() string {
+	return s.chainID
+}
+
+// SetChainID method defines id of the chain. It is written to
+// the storage together with the next committed block.
+func (s *State) SetChainID(chainID string) {
+	s.chainID = chainID
+}
+
+// Commit method writes all changes of the block together with
+// last block info to the storage and returns app hash of the block.
+func (s *State) Commit(height int64) ([]byte, error) {
+	if s.check {
+		return nil, errors.New("check state can't be committed")
+	}
+	params, validators := s.params, s.validators
+	s.batch.LastBlock = &LastBlockInfo{
+		Height:     height,
+		AppHash:    s.tree.Hash(),
+		ChainID:    s.chainID,
+		Params:     &params,
+		Validators: &validators,
+	}
+	if err := s.store.Commit(s.batch); err != nil {
+		return nil, err
+	}
+	s.lastBlock = *s.batch.LastBlock
+	s.committed = s.tree.Copy()
+	s.batch = NewBatch()
+	s.validatorUpdates = nil
+	return s.lastBlock.AppHash, nil
+}
+
+// setLeaf method updates hash of state object in Merkle tree.
+func (s *State) setLeaf(key string, v interface{}) error {
+	hash, err := ValueHash(v)
+	if err != nil {
+		return err
+	}
+	s.batch.Leaves[key] = hash
+	s.tree.Set(key, hash)
+	return nil
 }
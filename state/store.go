@@ -0,0 +1,87 @@
+/*
+ * Copyright (C) 2018 eeonevision
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy of
+ * this software and associated documentation files (the "Software"), to deal in
+ * the Software without restriction, including without limitation the rights to
+ * use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+ * the Software, and to permit persons to whom the Software is furnished to do so,
+ * subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+ * FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+ * COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+ * IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+ * CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ */
+
+package state
+
+import (
+	"errors"
+)
+
+// Storage backends supported by state.
+const (
+	MongoBackend   = "mongodb"
+	LevelDBBackend = "leveldb"
+	MemoryBackend  = "memory"
+)
+
+// ErrNotFound error returned when a document could not be found.
+var ErrNotFound = errors.New("not found")
+
+// Store interface describes storage backend of the state.
+// Search methods accept query in MongoDB query language,
+// zero limit means that results are not limited.
+// Changes are written only by commit of the whole block.
+type Store interface {
+	GetAccount(id string) (*Account, error)
+	SearchAccounts(query interface{}, limit, offset int) ([]*Account, error)
+
+	GetPayload(id string) (*Payload, error)
+	SearchPayloads(query interface{}, limit, offset int) ([]*Payload, error)
+
+	// Revisions are kept copies of payload, listed in order of revision.
+	GetRevision(id string, revision uint32) (*Payload, error)
+	ListRevisions(id string) ([]*Payload, error)
+
+	GetLastBlock() (*LastBlockInfo, error)
+	IterateLeaves(fn func(key string, hash []byte)) error
+
+	// Commit writes all changes of the batch and its last block info atomically.
+	Commit(batch *Batch) error
+
+	Stats() (map[string]interface{}, error)
+	Close()
+}
+
+// LastBlockInfo struct keeps height and app hash of last committed block
+// together with id, parameters and validators of the chain.
+type LastBlockInfo struct {
+	Height     int64         `bson:"height" json:"height"`
+	AppHash    []byte        `bson:"app_hash" json:"app_hash"`
+	ChainID    string        `bson:"chain_id" json:"chain_id"`
+	Params     *Params       `bson:"params,omitempty" json:"params,omitempty"`
+	Validators *ValidatorSet `bson:"validators,omitempty" json:"validators,omitempty"`
+}
+
+// NewStore method constructs storage by given backend name.
+// For MongoDB host is the address of server and name is database name,
+// for LevelDB host is the directory where database with given name is placed.
+func NewStore(backend, host, name string) (Store, error) {
+	switch backend {
+	case MongoBackend:
+		return NewMongoStore(host, name)
+	case LevelDBBackend:
+		return NewLevelDBStore(host, name)
+	case MemoryBackend:
+		return NewMemoryStore(), nil
+	default:
+		return nil, errors.New("unknown storage backend: " + backend)
+	}
+}
@@ -0,0 +1,276 @@
+/*
+ * Copyright (C) 2018 eeonevision
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy of
+ * this software and associated documentation files (the "Software"), to deal in
+ * the Software without restriction, including without limitation the rights to
+ * use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+ * the Software, and to permit persons to whom the Software is furnished to do so,
+ * subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+ * FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+ * COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+ * IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+ * CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ */
+package tests
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/eeonevision/anychaindb/state"
+)
+
+func newMemoryState(t *testing.T) *state.State {
+	s, err := state.NewState(state.NewMemoryStore())
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	return s
+}
+
+func TestMemoryStateAccounts(t *testing.T) {
+	s := newMemoryState(t)
+	if err := s.AddAccount(&state.Account{ID: "1", PubKey: "key"}); err != nil {
+		t.Errorf("%s", err)
+		return
+	}
+	if err := s.AddAccount(&state.Account{ID: "1", PubKey: "key"}); err == nil {
+		t.Errorf("account was added twice")
+		return
+	}
+	acc, err := s.GetAccount("1")
+	if err != nil || acc.PubKey != "key" {
+		t.Errorf("wrong account: %v, error: %v", acc, err)
+		return
+	}
+	if _, err := s.GetAccount("2"); err != state.ErrNotFound {
+		t.Errorf("expected not found error, got: %v", err)
+		return
+	}
+	if s.Hash() == nil {
+		t.Errorf("state hash was not updated")
+		return
+	}
+}
+
+func TestMemoryStateSearchPayloads(t *testing.T) {
+	s := newMemoryState(t)
+	for i, status := range []string{"A", "B", "D", "A"} {
+		err := s.AddPayload(&state.Payload{
+			ID:              string('a' + rune(i)),
+			SenderAccountID: "1",
+			PublicData:      map[string]interface{}{"status": status, "amount": i * 10},
+			PrivateData:     []*state.PrivateData{{ReceiverAccountID: "2", Data: "secret"}},
+		})
+		if err != nil {
+			t.Errorf("%s", err)
+			return
+		}
+	}
+	if _, err := s.Commit(1); err != nil {
+		t.Errorf("%s", err)
+		return
+	}
+	cases := []struct {
+		query  interface{}
+		limit  int
+		offset int
+		ids    string
+	}{
+		{nil, 0, 0, "abcd"},
+		{map[string]interface{}{"public_data.status": "A"}, 0, 0, "ad"},
+		{map[string]interface{}{"public_data.status": map[string]interface{}{"$in": []string{"A", "D"}}}, 0, 1, "cd"},
+		{map[string]interface{}{"public_data.amount": map[string]interface{}{"$gte": 10, "$lt": 30}}, 0, 0, "bc"},
+		{map[string]interface{}{"private_data.receiver_account_id": "2"}, 2, 0, "ab"},
+		{map[string]interface{}{"$or": []interface{}{
+			map[string]interface{}{"_id": "a"},
+			map[string]interface{}{"public_data.status": map[string]interface{}{"$regex": "^b$", "$options": "i"}},
+		}}, 0, 0, "ab"},
+		{map[string]interface{}{"public_data.missing": map[string]interface{}{"$exists": false}}, 1, 3, "d"},
+	}
+	for _, c := range cases {
+		res, err := s.SearchPayloads(c.query, c.limit, c.offset, false)
+		if err != nil {
+			t.Errorf("query %v: %s", c.query, err)
+			continue
+		}
+		ids := ""
+		for _, p := range res {
+			ids += p.ID
+		}
+		if ids != c.ids {
+			t.Errorf("query %v: expected %s, output: %s", c.query, c.ids, ids)
+		}
+	}
+	if _, err := s.SearchPayloads("not an object", 0, 0, false); err == nil {
+		t.Errorf("expected error for malformed query")
+	}
+}
+
+func TestLevelDBStateCommit(t *testing.T) {
+	dir, err := ioutil.TempDir("", "anychaindb")
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	defer os.RemoveAll(dir)
+	open := func() (state.Store, *state.State) {
+		store, err := state.NewLevelDBStore(dir, "state")
+		if err != nil {
+			t.Fatalf("%s", err)
+		}
+		s, err := state.NewState(store)
+		if err != nil {
+			t.Fatalf("%s", err)
+		}
+		return store, s
+	}
+	store, s := open()
+	if err := s.AddAccount(&state.Account{ID: "1", PubKey: "key"}); err != nil {
+		t.Fatalf("%s", err)
+	}
+	hash, err := s.Commit(1)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	// Changes of the block, which was not committed, should be lost
+	if err := s.AddAccount(&state.Account{ID: "2", PubKey: "key"}); err != nil {
+		t.Fatalf("%s", err)
+	}
+	store.Close()
+
+	store, s = open()
+	if lb := s.LastBlock(); lb.Height != 1 || !bytes.Equal(lb.AppHash, hash) {
+		t.Errorf("wrong last block: %v, expected hash %X", lb, hash)
+	}
+	if !s.HasAccount("1") || s.HasAccount("2") {
+		t.Errorf("state does not match committed block")
+	}
+	// Failed write is not reported as committed
+	store.Close()
+	if _, err := s.Commit(2); err == nil {
+		t.Errorf("block was committed to closed storage")
+	}
+	if s.LastBlock().Height != 1 {
+		t.Errorf("height of block, which was not written, is reported: %d", s.LastBlock().Height)
+	}
+}
+
+func TestStateWithoutTree(t *testing.T) {
+	// Objects of versions, which didn't keep Merkle tree
+	store := state.NewMemoryStore()
+	batch := state.NewBatch()
+	batch.Accounts["1"] = &state.Account{ID: "1", PubKey: "key"}
+	batch.LastBlock = &state.LastBlockInfo{}
+	if err := store.Commit(batch); err != nil {
+		t.Fatalf("%s", err)
+	}
+	if _, err := state.NewState(store); err == nil {
+		t.Errorf("state without Merkle tree was loaded")
+	}
+}
+
+func TestCheckStateCopy(t *testing.T) {
+	s := newMemoryState(t)
+	if err := s.SetParams(state.Params{AccountAdmission: state.AdmissionRegistrar, Registrars: []string{"r"}}); err != nil {
+		t.Fatalf("%s", err)
+	}
+	if err := s.SetValidators([]state.Validator{{PubKey: "v", Power: 10, AccountID: "a"}}); err != nil {
+		t.Fatalf("%s", err)
+	}
+	check := s.NewCheckState()
+	check.Params().Registrars[0] = "changed"
+	check.Validators()[0].Power = 20
+	if s.Params().Registrars[0] != "r" {
+		t.Errorf("registrars of check state are shared: %v", s.Params().Registrars)
+	}
+	if s.Validators()[0].Power != 10 {
+		t.Errorf("validators of check state are shared: %v", s.Validators())
+	}
+}
+
+func TestMemoryStatePayloadRevisions(t *testing.T) {
+	s := newMemoryState(t)
+	err := s.AddPayload(&state.Payload{
+		ID:         "a",
+		PublicData: map[string]interface{}{"status": "pending", "amount": 10},
+	})
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	stale := uint32(1)
+	updates := []*state.PayloadUpdate{
+		{ID: "a", PublicData: map[string]interface{}{"status": "approved", "amount": nil}, MergePatch: true},
+		{ID: "a", PublicData: map[string]interface{}{"status": "paid"}, ExpectedRevision: &stale},
+	}
+	for _, u := range updates {
+		if err := s.UpdatePayload(u, 0); err != nil {
+			t.Fatalf("%s", err)
+		}
+	}
+	if err := s.UpdatePayload(updates[1], 0); err == nil {
+		t.Fatalf("update with stale revision was applied")
+	}
+	if _, err := s.Commit(1); err != nil {
+		t.Fatalf("%s", err)
+	}
+	revs, err := s.ListPayloadRevisions("a")
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	statuses := ""
+	for i, rev := range revs {
+		if rev.Revision != uint32(i) {
+			t.Errorf("wrong order of revisions: %d at %d", rev.Revision, i)
+		}
+		statuses += rev.PublicData.(map[string]interface{})["status"].(string) + " "
+	}
+	if statuses != "pending approved paid " {
+		t.Errorf("wrong revisions: %s", statuses)
+	}
+	rev, err := s.GetPayloadRevision("a", 1)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	if _, ok := rev.PublicData.(map[string]interface{})["amount"]; ok {
+		t.Errorf("merge patch did not remove member: %v", rev.PublicData)
+	}
+}
+
+func TestMemoryStateRevokePayload(t *testing.T) {
+	s := newMemoryState(t)
+	for _, id := range []string{"a", "b"} {
+		if err := s.AddPayload(&state.Payload{ID: id}); err != nil {
+			t.Fatalf("%s", err)
+		}
+	}
+	if err := s.RevokePayload(&state.PayloadRevocation{ID: "a", Reason: "mistake"}, 1); err != nil {
+		t.Fatalf("%s", err)
+	}
+	if err := s.RevokePayload(&state.PayloadRevocation{ID: "a"}, 1); err == nil {
+		t.Fatalf("payload was revoked twice")
+	}
+	if err := s.UpdatePayload(&state.PayloadUpdate{ID: "a"}, 0); err == nil {
+		t.Fatalf("revoked payload was updated")
+	}
+	if _, err := s.Commit(1); err != nil {
+		t.Fatalf("%s", err)
+	}
+	if res, _ := s.SearchPayloads(nil, 0, 0, false); len(res) != 1 || res[0].ID != "b" {
+		t.Errorf("revoked payload was not excluded: %v", res)
+	}
+	if res, _ := s.SearchPayloads(map[string]interface{}{"_id": "a"}, 0, 0, true); len(res) != 1 || res[0].Revoked == nil {
+		t.Errorf("revoked payload was not flagged: %v", res)
+	}
+	if rev, err := s.GetPayloadRevision("a", 0); err != nil || rev.Revoked != nil {
+		t.Errorf("original revision was not kept: %v, error: %v", rev, err)
+	}
+}
@@ -0,0 +1,3 @@
+package tests
+
+// Packages with only test files, required this empty file for godep installation
@@ -0,0 +1,109 @@
+/*
+ * Copyright (C) 2018 eeonevision
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy of
+ * this software and associated documentation files (the "Software"), to deal in
+ * the Software without restriction, including without limitation the rights to
+ * use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+ * the Software, and to permit persons to whom the Software is furnished to do so,
+ * subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+ * FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+ * COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+ * IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+ * CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ */
+package tests
+
+import (
+	"bytes"
+	"fmt"
+	"math/rand"
+	"testing"
+
+	"github.com/eeonevision/anychaindb/state"
+)
+
+func TestTreeHashIndependentOfOrder(t *testing.T) {
+	keys := make([]string, 100)
+	for i := range keys {
+		keys[i] = fmt.Sprintf("payloads/%d", i)
+	}
+	t1 := state.NewTree()
+	for _, k := range keys {
+		t1.Set(k, []byte(k))
+	}
+	t2 := state.NewTree()
+	for _, i := range rand.Perm(len(keys)) {
+		t2.Set(keys[i], []byte("stale"))
+		t2.Set(keys[i], []byte(keys[i]))
+	}
+	if !bytes.Equal(t1.Hash(), t2.Hash()) {
+		t.Errorf("hashes are not equal. Expected: %X, Output: %X", t1.Hash(), t2.Hash())
+		return
+	}
+	for _, k := range keys {
+		if v, ok := t2.Get(k); !ok || string(v) != k {
+			t.Errorf("wrong value for key %s: %s", k, v)
+			return
+		}
+	}
+}
+
+func TestTreeHashChangesWithValue(t *testing.T) {
+	tree := state.NewTree()
+	if tree.Hash() != nil {
+		t.Errorf("empty tree should have nil hash, got %X", tree.Hash())
+		return
+	}
+	tree.Set("accounts/1", []byte("a"))
+	h1 := tree.Hash()
+	tree.Set("accounts/1", []byte("b"))
+	if bytes.Equal(h1, tree.Hash()) {
+		t.Errorf("hash was not changed after update of value")
+		return
+	}
+	if _, ok := tree.Get("accounts/2"); ok {
+		t.Errorf("found value for absent key")
+		return
+	}
+}
+
+func TestTreeProofs(t *testing.T) {
+	tree := state.NewTree()
+	for i := 0; i < 50; i++ {
+		k := fmt.Sprintf("accounts/%d", i)
+		tree.Set(k, []byte(k))
+	}
+	root := tree.Hash()
+	for i := 0; i < 50; i++ {
+		k := fmt.Sprintf("accounts/%d", i)
+		value, proof := tree.Prove(k)
+		if err := proof.Verify(root, k, value); err != nil {
+			t.Errorf("inclusion proof of %s is not valid: %s", k, err.Error())
+			return
+		}
+		if err := proof.Verify(root, k, []byte("forged")); err == nil {
+			t.Errorf("proof of %s with forged value is valid", k)
+			return
+		}
+		if err := proof.Verify(root, k, nil); err == nil {
+			t.Errorf("absence proof of existing %s is valid", k)
+			return
+		}
+	}
+	k := "accounts/missing"
+	value, proof := tree.Prove(k)
+	if value != nil {
+		t.Errorf("value of missing key: %s", value)
+		return
+	}
+	if err := proof.Verify(root, k, nil); err != nil {
+		t.Errorf("absence proof is not valid: %s", err.Error())
+	}
+}
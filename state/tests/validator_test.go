@@ -0,0 +1,64 @@
+/*
+ * Copyright (C) 2018 eeonevision
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy of
+ * this software and associated documentation files (the "Software"), to deal in
+ * the Software without restriction, including without limitation the rights to
+ * use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+ * the Software, and to permit persons to whom the Software is furnished to do so,
+ * subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+ * FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+ * COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+ * IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+ * CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ */
+package tests
+
+import (
+	"encoding/base64"
+	"testing"
+
+	"github.com/eeonevision/anychaindb/state"
+)
+
+func TestValidatorProposalExpiry(t *testing.T) {
+	s := newMemoryState(t)
+	pub := func(b byte) string {
+		key := make([]byte, 32)
+		key[0] = b
+		return base64.StdEncoding.EncodeToString(key)
+	}
+	err := s.SetValidators([]state.Validator{
+		{PubKey: pub(1), Power: 10, AccountID: "v1"},
+		{PubKey: pub(2), Power: 10, AccountID: "v2"},
+		{PubKey: pub(3), Power: 10, AccountID: "v3"},
+	})
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	update := &state.ValidatorUpdate{PubKey: pub(9), Power: 5}
+	if applied, err := s.VoteValidatorUpdate(update, "v1"); err != nil || applied {
+		t.Fatalf("update was applied by one vote: %v", err)
+	}
+	if _, err := s.Commit(state.ValidatorProposalPeriod - 1); err != nil {
+		t.Fatalf("%s", err)
+	}
+	if !s.HasVoted(update, "v1") {
+		t.Fatalf("vote was dropped before expiry")
+	}
+	if _, err := s.Commit(state.ValidatorProposalPeriod); err != nil {
+		t.Fatalf("%s", err)
+	}
+	if s.HasVoted(update, "v1") {
+		t.Errorf("vote of expired proposal is kept")
+	}
+	if applied, err := s.VoteValidatorUpdate(update, "v2"); err != nil || applied {
+		t.Errorf("update was applied by vote for expired proposal: %v", err)
+	}
+}
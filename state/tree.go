@@ -0,0 +1,316 @@
+/*
+ * Copyright (C) 2018 eeonevision
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy of
+ * this software and associated documentation files (the "Software"), to deal in
+ * the Software without restriction, including without limitation the rights to
+ * use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+ * the Software, and to permit persons to whom the Software is furnished to do so,
+ * subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+ * FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+ * COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+ * IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+ * CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ */
+
+package state
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+)
+
+// Tree is a sparse Merkle tree over hashed keys of the state objects.
+// Every leaf is placed by SHA-256 of its key and subtrees holding a single
+// leaf are collapsed into that leaf, so the root hash depends only on the
+// set of keys and values and never on the order they were inserted in.
+// Nodes are immutable, updates copy the path from the root to the leaf.
+type Tree struct {
+	root *node
+}
+
+type node struct {
+	hash  []byte
+	left  *node
+	right *node
+	path  []byte
+	value []byte
+}
+
+// Prefixes of the hashed nodes for domain separation of leaves and inner nodes.
+const (
+	leafPrefix  byte = 0
+	innerPrefix byte = 1
+)
+
+var emptyHash = make([]byte, sha256.Size)
+
+// NewTree method constructs empty tree.
+func NewTree() *Tree {
+	return &Tree{}
+}
+
+// Copy method returns independent copy of the tree.
+// Nodes are immutable, so the copy shares all of them.
+func (t *Tree) Copy() *Tree {
+	return &Tree{root: t.root}
+}
+
+// Hash method returns root hash of the tree or nil if tree is empty.
+func (t *Tree) Hash() []byte {
+	if t.root == nil {
+		return nil
+	}
+	return t.root.hash
+}
+
+// Set method inserts or replaces value hash by given key.
+func (t *Tree) Set(key string, value []byte) {
+	t.root = insert(t.root, 0, keyPath(key), value)
+}
+
+// Get method returns value hash by given key.
+func (t *Tree) Get(key string) ([]byte, bool) {
+	path := keyPath(key)
+	n := t.root
+	for depth := 0; n != nil; depth++ {
+		if n.isLeaf() {
+			if bytes.Equal(n.path, path) {
+				return n.value, true
+			}
+			return nil, false
+		}
+		if bit(path, depth) == 0 {
+			n = n.left
+		} else {
+			n = n.right
+		}
+	}
+	return nil, false
+}
+
+// Prove method returns value hash by given key and proof of its inclusion.
+// If key is absent value is nil and proof proves its absence.
+func (t *Tree) Prove(key string) ([]byte, *Proof) {
+	path := keyPath(key)
+	proof := &Proof{Siblings: [][]byte{}}
+	n := t.root
+	for depth := 0; n != nil && !n.isLeaf(); depth++ {
+		if bit(path, depth) == 0 {
+			proof.Siblings = append(proof.Siblings, nodeHash(n.right))
+			n = n.left
+		} else {
+			proof.Siblings = append(proof.Siblings, nodeHash(n.left))
+			n = n.right
+		}
+	}
+	if n == nil {
+		return nil, proof
+	}
+	if bytes.Equal(n.path, path) {
+		return n.value, proof
+	}
+	proof.LeafPath, proof.LeafValue = n.path, n.value
+	return nil, proof
+}
+
+// Proof struct proves that key has given value in Merkle tree or that key is absent.
+// Siblings are hashes of sibling nodes on the path from the root to the leaf.
+// Absence of key is proved by empty subtree placed on the path of key
+// or by other leaf which shares path of key up to its depth.
+type Proof struct {
+	Siblings  [][]byte `json:"siblings"`
+	LeafPath  []byte   `json:"leaf_path,omitempty"`
+	LeafValue []byte   `json:"leaf_value,omitempty"`
+}
+
+// Verify method checks that key has value hash in tree with given root hash.
+// Nil value means that proof should prove absence of key.
+func (p *Proof) Verify(root []byte, key string, value []byte) error {
+	path := keyPath(key)
+	if len(p.Siblings) > len(path)*8 {
+		return errors.New("proof is too long")
+	}
+	var hash []byte
+	switch {
+	case value != nil:
+		hash = leafHash(path, value)
+	case p.LeafPath != nil:
+		if len(p.LeafPath) != len(path) || bytes.Equal(p.LeafPath, path) {
+			return errors.New("malformed absence proof")
+		}
+		for depth := range p.Siblings {
+			if bit(p.LeafPath, depth) != bit(path, depth) {
+				return errors.New("leaf of absence proof is not on the path of key")
+			}
+		}
+		hash = leafHash(p.LeafPath, p.LeafValue)
+	case len(p.Siblings) == 0:
+		if len(root) != 0 {
+			return errors.New("tree is not empty")
+		}
+		return nil
+	default:
+		hash = emptyHash
+	}
+	for depth := len(p.Siblings) - 1; depth >= 0; depth-- {
+		if bit(path, depth) == 0 {
+			hash = innerHash(hash, p.Siblings[depth])
+		} else {
+			hash = innerHash(p.Siblings[depth], hash)
+		}
+	}
+	if !bytes.Equal(hash, root) {
+		return errors.New("proof does not match root hash")
+	}
+	return nil
+}
+
+// ValueHash returns canonical hash of state object.
+// Object is encoded to canonical JSON before hashing.
+func ValueHash(v interface{}) ([]byte, error) {
+	bs, err := CanonicalJSON(v)
+	if err != nil {
+		return nil, err
+	}
+	return EncodedValueHash(bs), nil
+}
+
+// EncodedValueHash returns hash of canonical JSON encoded state object,
+// e.g. value of query response.
+func EncodedValueHash(bs []byte) []byte {
+	hash := sha256.Sum256(bs)
+	return hash[:]
+}
+
+// CanonicalJSON function encodes state object to JSON, which does not depend
+// on storage backend the object was loaded from. Map keys are sorted and null
+// values, empty arrays and empty objects are omitted, because backends do not
+// keep difference between them, e.g. MongoDB returns empty array for nil slice.
+func CanonicalJSON(v interface{}) ([]byte, error) {
+	bs, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	d := json.NewDecoder(bytes.NewReader(bs))
+	d.UseNumber()
+	var obj interface{}
+	if err := d.Decode(&obj); err != nil {
+		return nil, err
+	}
+	return json.Marshal(omitEmpty(obj))
+}
+
+// omitEmpty function removes empty fields from decoded JSON objects recursively.
+func omitEmpty(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for k, e := range v {
+			if e = omitEmpty(e); isEmpty(e) {
+				delete(v, k)
+			} else {
+				v[k] = e
+			}
+		}
+	case []interface{}:
+		for i, e := range v {
+			v[i] = omitEmpty(e)
+		}
+	}
+	return v
+}
+
+func isEmpty(v interface{}) bool {
+	switch v := v.(type) {
+	case nil:
+		return true
+	case map[string]interface{}:
+		return len(v) == 0
+	case []interface{}:
+		return len(v) == 0
+	}
+	return false
+}
+
+func keyPath(key string) []byte {
+	hash := sha256.Sum256([]byte(key))
+	return hash[:]
+}
+
+func bit(path []byte, depth int) byte {
+	return (path[depth/8] >> uint(7-depth%8)) & 1
+}
+
+func (n *node) isLeaf() bool {
+	return n.path != nil
+}
+
+func nodeHash(n *node) []byte {
+	if n == nil {
+		return emptyHash
+	}
+	return n.hash
+}
+
+func newLeaf(path, value []byte) *node {
+	return &node{hash: leafHash(path, value), path: path, value: value}
+}
+
+func newInner(left, right *node) *node {
+	return &node{hash: innerHash(nodeHash(left), nodeHash(right)), left: left, right: right}
+}
+
+func leafHash(path, value []byte) []byte {
+	h := sha256.New()
+	h.Write([]byte{leafPrefix})
+	h.Write(path)
+	h.Write(value)
+	return h.Sum(nil)
+}
+
+func innerHash(left, right []byte) []byte {
+	h := sha256.New()
+	h.Write([]byte{innerPrefix})
+	h.Write(left)
+	h.Write(right)
+	return h.Sum(nil)
+}
+
+func insert(n *node, depth int, path, value []byte) *node {
+	if n == nil {
+		return newLeaf(path, value)
+	}
+	if n.isLeaf() {
+		if bytes.Equal(n.path, path) {
+			return newLeaf(path, value)
+		}
+		return split(n, newLeaf(path, value), depth)
+	}
+	if bit(path, depth) == 0 {
+		return newInner(insert(n.left, depth+1, path, value), n.right)
+	}
+	return newInner(n.left, insert(n.right, depth+1, path, value))
+}
+
+// split places two leaves with different paths under common inner nodes.
+func split(a, b *node, depth int) *node {
+	ba, bb := bit(a.path, depth), bit(b.path, depth)
+	switch {
+	case ba == bb && ba == 0:
+		return newInner(split(a, b, depth+1), nil)
+	case ba == bb:
+		return newInner(nil, split(a, b, depth+1))
+	case ba == 0:
+		return newInner(a, b)
+	default:
+		return newInner(b, a)
+	}
+}
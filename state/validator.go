@@ -0,0 +1,245 @@
+/*
+ * Copyright (C) 2018 eeonevision
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy of
+ * this software and associated documentation files (the "Software"), to deal in
+ * the Software without restriction, including without limitation the rights to
+ * use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+ * the Software, and to permit persons to whom the Software is furnished to do so,
+ * subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+ * FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+ * COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+ * IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+ * CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ */
+
+package state
+
+import (
+	"encoding/base64"
+	"errors"
+)
+
+//go:generate msgp
+
+// ValidatorsKey is key of validator set in Merkle tree.
+const ValidatorsKey = "validators"
+
+// ValidatorProposalPeriod is number of blocks, during which validators vote
+// for proposal. Proposal, which did not get enough votes, expires after it.
+const ValidatorProposalPeriod = 1000
+
+// Validator struct keeps validator of the chain.
+//   - PubKey is base64 encoded Ed25519 public key of validator;
+//   - Power is voting power of validator;
+//   - AccountID is account of validator's operator, which votes for validator updates.
+type Validator struct {
+	PubKey    string `msg:"pub_key" json:"pub_key" mapstructure:"pub_key" bson:"pub_key"`
+	Power     int64  `msg:"power" json:"power" mapstructure:"power" bson:"power"`
+	AccountID string `msg:"account_id" json:"account_id,omitempty" mapstructure:"account_id" bson:"account_id,omitempty"`
+}
+
+// ValidatorUpdate struct keeps data of transaction, which adds validator,
+// changes its power or removes it with zero power.
+type ValidatorUpdate struct {
+	PubKey    string `msg:"pub_key" json:"pub_key" mapstructure:"pub_key" bson:"pub_key"`
+	Power     int64  `msg:"power" json:"power" mapstructure:"power" bson:"power"`
+	AccountID string `msg:"account_id" json:"account_id,omitempty" mapstructure:"account_id" bson:"account_id,omitempty"`
+}
+
+// ValidatorProposal struct keeps update of validator, which is not applied
+// yet, together with accounts of validators, which voted for it, and the last
+// height of block, where votes for it are accepted.
+type ValidatorProposal struct {
+	Update    ValidatorUpdate `msg:"update" json:"update" bson:"update"`
+	Votes     []string        `msg:"votes" json:"votes" bson:"votes"`
+	ExpiresAt int64           `msg:"expires_at" json:"expires_at" bson:"expires_at"`
+}
+
+// ValidatorSet struct keeps current validators and pending proposals of their updates.
+type ValidatorSet struct {
+	Validators []Validator         `msg:"validators" json:"validators" bson:"validators"`
+	Proposals  []ValidatorProposal `msg:"proposals" json:"proposals,omitempty" bson:"proposals,omitempty"`
+}
+
+// Validate method checks public key and power of update.
+func (u *ValidatorUpdate) Validate() error {
+	pub, err := base64.StdEncoding.DecodeString(u.PubKey)
+	if err != nil || len(pub) != 32 {
+		return errors.New("invalid public key of validator")
+	}
+	if u.Power < 0 {
+		return errors.New("power of validator should not be negative")
+	}
+	return nil
+}
+
+// copy method returns validator set, which shares neither validators
+// nor proposals and their votes with set.
+func (set ValidatorSet) copy() ValidatorSet {
+	c := ValidatorSet{Validators: append([]Validator(nil), set.Validators...)}
+	for _, p := range set.Proposals {
+		p.Votes = append([]string(nil), p.Votes...)
+		c.Proposals = append(c.Proposals, p)
+	}
+	return c
+}
+
+// Validators method returns current validators of the chain.
+func (s *State) Validators() []Validator {
+	return s.validators.Validators
+}
+
+// AccountPower method returns total power of validators, which are operated
+// by account.
+func (s *State) AccountPower(id string) int64 {
+	var power int64
+	for _, v := range s.validators.Validators {
+		if v.AccountID == id {
+			power += v.Power
+		}
+	}
+	return power
+}
+
+// ValidatorUpdates method returns updates of validators, which were applied
+// by the current block.
+func (s *State) ValidatorUpdates() []ValidatorUpdate {
+	return s.validatorUpdates
+}
+
+// SetValidators method defines validators of the chain on its initialization.
+func (s *State) SetValidators(validators []Validator) error {
+	return s.setValidatorSet(ValidatorSet{Validators: validators})
+}
+
+// CheckValidatorUpdate method checks that update can be applied to the current
+// validators: removed validator exists and the chain keeps at least one validator.
+func (s *State) CheckValidatorUpdate(update *ValidatorUpdate) error {
+	if err := update.Validate(); err != nil {
+		return err
+	}
+	_, total := applyValidatorUpdate(s.validators.Validators, update)
+	if update.Power == 0 && total == s.totalPower() {
+		return errors.New("validator is not found")
+	}
+	if total <= 0 {
+		return errors.New("the last validator can't be removed")
+	}
+	return nil
+}
+
+// UpdateValidator method applies update of validator. Pending proposals are
+// dropped, because their votes were given by powers of previous validators.
+func (s *State) UpdateValidator(update *ValidatorUpdate) error {
+	validators, _ := applyValidatorUpdate(s.validators.Validators, update)
+	if err := s.setValidatorSet(ValidatorSet{Validators: validators}); err != nil {
+		return err
+	}
+	s.validatorUpdates = append(s.validatorUpdates, *update)
+	return nil
+}
+
+// HasVoted method checks if account voted for update already.
+func (s *State) HasVoted(update *ValidatorUpdate, id string) bool {
+	for _, p := range s.pendingProposals() {
+		if p.Update != *update {
+			continue
+		}
+		for _, v := range p.Votes {
+			if v == id {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// VoteValidatorUpdate method keeps vote of validator's operator for update.
+// Update is applied, when validators with more than 2/3 of total power voted
+// for it before the proposal expired. Expired proposals are dropped.
+func (s *State) VoteValidatorUpdate(update *ValidatorUpdate, id string) (applied bool, err error) {
+	var proposals []ValidatorProposal
+	var votes []string
+	expiresAt := s.lastBlock.Height + ValidatorProposalPeriod
+	for _, p := range s.pendingProposals() {
+		if p.Update == *update {
+			votes, expiresAt = p.Votes, p.ExpiresAt
+			continue
+		}
+		proposals = append(proposals, p)
+	}
+	votes = append(append([]string{}, votes...), id)
+	var power int64
+	for _, v := range votes {
+		power += s.AccountPower(v)
+	}
+	if 3*power > 2*s.totalPower() {
+		return true, s.UpdateValidator(update)
+	}
+	proposals = append(proposals, ValidatorProposal{Update: *update, Votes: votes, ExpiresAt: expiresAt})
+	return false, s.setValidatorSet(ValidatorSet{Validators: s.validators.Validators, Proposals: proposals})
+}
+
+// pendingProposals method returns proposals, which are not expired
+// at height of the current block.
+func (s *State) pendingProposals() []ValidatorProposal {
+	var proposals []ValidatorProposal
+	for _, p := range s.validators.Proposals {
+		if p.ExpiresAt >= s.lastBlock.Height+1 {
+			proposals = append(proposals, p)
+		}
+	}
+	return proposals
+}
+
+// totalPower method returns total voting power of validators.
+func (s *State) totalPower() int64 {
+	var total int64
+	for _, v := range s.validators.Validators {
+		total += v.Power
+	}
+	return total
+}
+
+// setValidatorSet method replaces validator set. It is included into Merkle tree
+// and written to the storage together with the next committed block.
+func (s *State) setValidatorSet(set ValidatorSet) error {
+	if err := s.setLeaf(ValidatorsKey, set); err != nil {
+		return err
+	}
+	s.validators = set
+	return nil
+}
+
+// applyValidatorUpdate function returns copy of validators with applied update
+// and their total power.
+func applyValidatorUpdate(validators []Validator, update *ValidatorUpdate) ([]Validator, int64) {
+	var result []Validator
+	var total int64
+	found := false
+	for _, v := range validators {
+		if v.PubKey == update.PubKey {
+			found = true
+			v.Power = update.Power
+			if update.AccountID != "" {
+				v.AccountID = update.AccountID
+			}
+		}
+		if v.Power > 0 {
+			result = append(result, v)
+			total += v.Power
+		}
+	}
+	if !found && update.Power > 0 {
+		result = append(result, Validator{PubKey: update.PubKey, Power: update.Power, AccountID: update.AccountID})
+		total += update.Power
+	}
+	return result, total
+}
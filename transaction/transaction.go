@@ -22,7 +22,6 @@
 package transaction
 
 import (
-	"math/rand"
 	"time"
 
 	"github.com/tinylib/msgp/msgp"
@@ -46,8 +45,15 @@ type Transaction struct {
 type TransactionType string
 
 const (
-	AccountAdd TransactionType = "add-account"
-	PayloadAdd TransactionType = "add-payload"
+	AccountAdd       TransactionType = "add-account"
+	PayloadAdd       TransactionType = "add-payload"
+	PayloadUpdate    TransactionType = "update-payload"
+	PayloadRevoke    TransactionType = "revoke-payload"
+	PrivateDataGrant TransactionType = "grant-private-data"
+	KeyRotate        TransactionType = "rotate-key"
+	RoleGrant        TransactionType = "grant-role"
+	RoleRevoke       TransactionType = "revoke-role"
+	ValidatorUpdate  TransactionType = "update-validator"
 )
 
 func (t *Transaction) FromBytes(bs []byte) error {
@@ -59,9 +65,13 @@ func (t *Transaction) ToBytes() ([]byte, error) {
 	return t.MarshalMsg(nil)
 }
 
-func (t *Transaction) Hash() []byte {
+// Hash method returns hash of transaction for signing.
+// Chain id is included into hash, so signed transaction
+// can't be replayed on other network.
+func (t *Transaction) Hash(chainID string) []byte {
 	hash := sha3.New512()
 	w := msgp.NewWriter(hash)
+	w.WriteString(chainID)
 	w.WriteString(string(t.Type))
 	w.WriteInt64(t.Timestamp)
 	w.WriteString(t.Signer)
@@ -71,8 +81,8 @@ func (t *Transaction) Hash() []byte {
 	return hash.Sum(nil)
 }
 
-func (t *Transaction) Sign(key *crypto.Key) error {
-	hash := t.Hash()
+func (t *Transaction) Sign(key *crypto.Key, chainID string) error {
+	hash := t.Hash(chainID)
 	signature, err := key.Sign(hash)
 	if err != nil {
 		return err
@@ -81,13 +91,16 @@ func (t *Transaction) Sign(key *crypto.Key) error {
 	return nil
 }
 
-func (t *Transaction) Verify(key *crypto.Key) error {
-	hash := t.Hash()
+// Verify method checks signature of transaction by given key. Signatures
+// with non-canonical encoding or high S value are rejected, so signed
+// transaction can't be re-encoded with other valid signature.
+func (t *Transaction) Verify(key *crypto.Key, chainID string) error {
+	hash := t.Hash(chainID)
 	return key.Verify(hash, t.Signature)
 }
 
+// New method constructs transaction with current timestamp.
+// Nonce of signed transaction should be set to the next nonce of signer.
 func New(t TransactionType, signer string, data []byte) *Transaction {
-	now := time.Now().UnixNano()
-	rand.Seed(now)
-	return &Transaction{t, now, signer, "", rand.Uint32(), data}
+	return &Transaction{t, time.Now().UnixNano(), signer, "", 0, data}
 }